@@ -2,31 +2,90 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
 
 	"github.com/sbilibin2017/cs2/internal/apps"
 	"github.com/sbilibin2017/cs2/internal/flags"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
 )
 
+const traceShutdownTimeout = 5 * time.Second
+
 func main() {
-	err := run()
+	err := run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
 	}
-
 }
 
-func run() error {
-	config := flags.ParseAppFlags()
+func run(args []string) error {
+	cmd, err := flags.ParseCommand(args)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Name == "config" {
+		return cmd.Config.Print(os.Stdout)
+	}
 
-	app, err := apps.NewApp(config)
+	logger, err := logging.New(os.Stderr, cmd.Config.LogLevel, cmd.Config.LogFormat)
 	if err != nil {
 		return err
 	}
+	slog.SetDefault(logger)
 
-	err = app.Run(context.Background())
+	shutdownTracing, err := tracing.Setup(context.Background(),
+		cmd.Config.TraceExporter,
+		cmd.Config.TraceEndpoint,
+		cmd.Config.TraceSampleRatio,
+		os.Stdout,
+	)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("failed to flush spans", logging.Err(err))
+		}
+	}()
 
-	return nil
+	app, err := apps.NewApp(cmd.Config)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	ctx := logging.WithLogger(context.Background(), logger)
+
+	switch cmd.Name {
+	case "migrate":
+		return app.Migrate(ctx, cmd.Args[0])
+	case "validate":
+		return app.Validate(ctx)
+	case "stats":
+		return app.Stats(ctx)
+	case "export":
+		return app.Export(ctx)
+	case "replay":
+		return app.Replay(ctx)
+	case "dlq":
+		return app.DLQ(ctx, cmd.Args[0], cmd.Args[1:])
+	default:
+		if cmd.Config.DryRun {
+			return app.DryRun(ctx)
+		}
+		return app.Run(ctx)
+	}
 }
@@ -2,16 +2,21 @@ package apps
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/url"
+	"io"
+	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/metrics"
 	"github.com/sbilibin2017/cs2/internal/repositories"
 	"github.com/sbilibin2017/cs2/internal/workers"
 )
@@ -19,62 +24,197 @@ import (
 type App struct {
 	config *configs.Config
 
-	db clickhouse.Conn
+	// sinks[0] is the primary sink. Reads go to the first ClickHouse sink.
+	sinks []*sink
+	db    clickhouse.Conn
 
-	gameParserRepository *repositories.GameParserRepository
-	gameSaverRepository  *repositories.GameSaverRepository
+	gameParserRepository      *repositories.GameParserRepository
+	gameSaverRepository       *repositories.GameSaverRepository
+	gameFanOutSaverRepository *repositories.GameFanOutSaverRepository
+	gameReaderRepository      *repositories.GameReaderRepository
+	gameRawRepository         *repositories.GameRawRepository
+	gameRoundEventRepository  *repositories.GameRoundEventRepository
+
+	// deadLetters is nil unless a dead-letter store is configured. The
+	// ClickHouse store has its own connection, so that it outlives Run.
+	deadLetters deadLetterStore
+	dlqDB       clickhouse.Conn
+
+	metrics *metrics.Metrics
+	health  healthState
 
 	Workers []func(ctx context.Context) error
+
+	Out io.Writer
+
+	closed bool
 }
 
+const pingTimeout = 5 * time.Second
+
+var errInvalidGameFiles = errors.New("invalid game files")
+
 func NewApp(config *configs.Config) (*App, error) {
 	var app App
 	app.config = config
+	app.Out = os.Stdout
+	app.metrics = metrics.New()
 
-	app.gameParserRepository = repositories.NewGameParserRepository(
+	// A dry run only reads and flattens, see DryRun.
+	if config.DryRun {
+		return &app, nil
+	}
+
+	parserOpts := []repositories.GameParserOption{
 		repositories.WithPathToDir(config.ParserDir),
-	)
-	app.gameSaverRepository = repositories.NewGameSaverRepository(
-		repositories.WithDB(app.db),
-	)
+		repositories.WithStrictDecode(config.StrictDecode),
+		repositories.WithParserObserver(app.metrics),
+	}
+	if config.Mode == configs.ModeOnce {
+		parserOpts = append(parserOpts, repositories.WithSinglePass())
+	} else {
+		parserOpts = append(parserOpts, repositories.WithPollInterval(config.PollInterval))
+	}
+	app.gameParserRepository = repositories.NewGameParserRepository(parserOpts...)
+
+	var fanOutOpts []repositories.GameFanOutSaverOption
+	// dbRetry retries the writes to app.db, sharing its circuit breaker.
+	var dbRetry *repositories.GameRetrySaverRepository
+	for i, cfg := range config.SinkConfigs() {
+		s, err := app.openSink(cfg, i == 0)
+		if err != nil {
+			_ = app.Close()
+			return nil, fmt.Errorf("sink %s: %w", cfg.Name, err)
+		}
+		app.sinks = append(app.sinks, s)
+		fanOutOpts = append(fanOutOpts, repositories.WithFanOutSaver(s.gameBatchSaverRepository))
+
+		if s.gameSaverRepository != nil && app.gameSaverRepository == nil {
+			app.db = s.db
+			dbRetry = s.gameRetrySaverRepository
+			app.gameSaverRepository = s.gameSaverRepository
+			app.gameReaderRepository = repositories.NewGameReaderRepository(
+				repositories.WithReaderDB(app.db),
+			)
+		}
+	}
+	app.gameFanOutSaverRepository = repositories.NewGameFanOutSaverRepository(fanOutOpts...)
+
+	if config.StoreRaw && app.db != nil {
+		app.gameRawRepository = repositories.NewGameRawRepository(
+			repositories.WithRawDB(app.db),
+			repositories.WithRawRetry(dbRetry),
+		)
+	}
+	if config.RoundEvents && app.db != nil {
+		app.gameRoundEventRepository = repositories.NewGameRoundEventRepository(
+			repositories.WithRoundEventDB(app.db),
+			repositories.WithRoundEventRetry(dbRetry),
+		)
+	}
+
+	if err := app.openDeadLetters(); err != nil {
+		_ = app.Close()
+		return nil, fmt.Errorf("dlq: %w", err)
+	}
 
 	app.Workers = []func(ctx context.Context) error{
-		workers.NewParserWorker(
-			workers.WithParser(app.gameParserRepository),
-			workers.WithSaver(app.gameSaverRepository),
-		),
+		app.newParserWorker(app.gameParserRepository),
 	}
 
 	return &app, nil
 }
 
+func (app *App) newParserWorker(parser workers.Parser) func(ctx context.Context) error {
+	workerOpts := []workers.ParserOpt{
+		workers.WithParser(parser),
+		workers.WithSaver(app.gameFanOutSaverRepository),
+		workers.WithParseConcurrency(app.config.ParseWorkers),
+		workers.WithFlattenConcurrency(app.config.FlattenWorkers),
+		workers.WithSaveConcurrency(app.config.SaveWorkers),
+		workers.WithObserver(healthObserver{Observer: app.metrics, health: &app.health}),
+		workers.WithGracePeriod(app.config.ShutdownGracePeriod),
+	}
+	// Reading pauses while the primary sink is unavailable.
+	if breaker := app.sinks[0].circuitBreaker; breaker != nil {
+		workerOpts = append(workerOpts, workers.WithGate(breaker))
+	}
+	if app.config.Ordered {
+		workerOpts = append(workerOpts, workers.WithOrdered(app.config.OrderWindow))
+	}
+	if app.deadLetters != nil {
+		workerOpts = append(workerOpts, workers.WithDeadLetter(app.deadLetters))
+	}
+	if app.gameRawRepository != nil {
+		workerOpts = append(workerOpts, workers.WithRawStore(app.gameRawRepository))
+	}
+	if app.gameRoundEventRepository != nil {
+		workerOpts = append(workerOpts, workers.WithRoundEventSaver(app.gameRoundEventRepository))
+	}
+
+	return workers.NewParserWorker(workerOpts...)
+}
+
 func (app *App) Run(ctx context.Context) error {
-	opts, err := parseClickhouseDSN(app.config.DatabaseDSN)
-	if err != nil {
-		return err
+	defer app.closeSinks()
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+	// Once the first signal starts the drain, a second one kills the process.
+	defer context.AfterFunc(ctx, stop)()
+
+	// Probes are served while migrating and verifying, reporting not ready,
+	// and until the remaining rows are flushed.
+	if app.config.HTTPAddr != "" {
+		ln, err := listenHTTP(app.config.HTTPAddr)
+		if err != nil {
+			return err
+		}
+		defer app.serveHTTP(ctx, ln)()
 	}
+	defer context.AfterFunc(ctx, func() { app.health.draining.Store(true) })()
 
-	app.db, err = clickhouse.Open(opts)
-	if err != nil {
-		return err
+	if app.config.AutoMigrate && slices.ContainsFunc(app.sinks, (*sink).hasSchema) {
+		if err := app.Migrate(ctx, "up"); err != nil {
+			return fmt.Errorf("auto-migrate failed: %w", err)
+		}
 	}
-	defer app.db.Close()
+
+	for _, s := range app.sinks {
+		if s.gameSaverRepository == nil {
+			continue
+		}
+		if err := s.gameSaverRepository.Verify(ctx); err != nil {
+			return fmt.Errorf("sink %s: %w", s.config.Name, err)
+		}
+	}
+	if app.gameRawRepository != nil {
+		if err := app.gameRawRepository.Verify(ctx); err != nil {
+			return err
+		}
+	}
+	if app.gameRoundEventRepository != nil {
+		if err := app.gameRoundEventRepository.Verify(ctx); err != nil {
+			return err
+		}
+	}
+	app.health.schemaVerified.Store(true)
 
 	if len(app.Workers) == 0 {
 		return nil
 	}
 
-	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	defer stop()
-
 	var wg sync.WaitGroup
 	errCh := make(chan error, len(app.Workers))
 
+	app.health.workersStarted.Store(int32(len(app.Workers)))
 	for _, worker := range app.Workers {
 		wg.Add(1)
+		app.health.workersRunning.Add(1)
 
 		go func(w func(ctx context.Context) error) {
 			defer wg.Done()
+			defer app.health.workersRunning.Add(-1)
 
 			if err := w(ctx); err != nil {
 				errCh <- err
@@ -84,45 +224,132 @@ func (app *App) Run(ctx context.Context) error {
 
 	wg.Wait()
 	close(errCh)
+	app.health.draining.Store(true)
+
+	logger := logging.FromContext(ctx)
 
+	var failed bool
 	for err := range errCh {
 		if err != nil {
-			log.Printf("worker error: %v", err)
+			failed = true
+			logger.Error("worker failed", logging.Err(err))
+		}
+	}
+
+	// A sink that is down must not hold the shutdown forever: once a signal
+	// arrived, the final flush gets the grace period and no more. No
+	// checkpoint is kept: after a restart the directory is read again, and
+	// the games already saved replace themselves, except in file sinks,
+	// which write them again.
+	flushCtx, cancelFlush := finalFlushContext(ctx, app.config.ShutdownGracePeriod)
+	defer cancelFlush()
+
+	var stats repositories.GameBatchStats
+	var retries int64
+	for _, s := range app.sinks {
+		if err := s.flush(flushCtx); err != nil {
+			failed = true
+			logger.Error("final flush failed", logging.Stage(logging.StageSave), "sink", s.config.Name, logging.Err(err))
+		}
+
+		sinkStats := s.gameBatchSaverRepository.Stats()
+		stats.Rows += sinkStats.Rows
+		stats.Flushes += sinkStats.Flushes
+		stats.FailedFlush += sinkStats.FailedFlush
+		stats.MaxLatency = max(stats.MaxLatency, sinkStats.MaxLatency)
+		retries += s.gameRetrySaverRepository.Retries()
+
+		if len(app.sinks) > 1 {
+			logger.Info("sink finished",
+				"sink", s.config.Name,
+				"rows", sinkStats.Rows,
+				"flushes", sinkStats.Flushes,
+				"failed_flushes", sinkStats.FailedFlush,
+			)
+		}
+	}
+
+	files := app.gameParserRepository.Stats()
+	logger.Info("ingest finished",
+		"mode", app.config.Mode,
+		"files", files.Files,
+		"failed_files", files.Failed,
+		"rows", stats.Rows,
+		"flushes", stats.Flushes,
+		"failed_flushes", stats.FailedFlush,
+		"retries", retries,
+		"max_flush_latency", stats.MaxLatency,
+	)
+
+	// In once mode the exit status tells the scheduler whether every pending
+	// row made it to the sinks that fail the run.
+	if app.config.Mode == configs.ModeOnce {
+		if stats.FailedFlush > 0 {
+			return fmt.Errorf("%d of %d flushes failed", stats.FailedFlush, stats.Flushes+stats.FailedFlush)
+		}
+		// Invalid files are skipped so the others are saved, but they still
+		// need fixing.
+		if files.Failed > 0 {
+			return fmt.Errorf("%w: %d of %d", errInvalidGameFiles, files.Failed, files.Files)
+		}
+		if failed {
+			return errors.New("ingest finished with errors")
 		}
 	}
 
 	return nil
 }
 
-func parseClickhouseDSN(dsn string) (*clickhouse.Options, error) {
-	u, err := url.Parse(dsn)
-	if err != nil {
-		return nil, fmt.Errorf("invalid DSN: %w", err)
+func (app *App) Close() error {
+	err := app.closeSinks()
+	if app.dlqDB != nil {
+		err = errors.Join(err, app.dlqDB.Close())
+		app.dlqDB = nil
+	}
+	return err
+}
+
+func (app *App) closeSinks() error {
+	if app.closed {
+		return nil
+	}
+	app.closed = true
+
+	var errs []error
+	for _, s := range app.sinks {
+		errs = append(errs, s.close(context.Background()))
+	}
+	app.db = nil
+	return errors.Join(errs...)
+}
+
+// requireClickhouse fails commands that query ClickHouse when rows are
+// written elsewhere.
+func (app *App) requireClickhouse() error {
+	if app.gameSaverRepository == nil {
+		return fmt.Errorf("not supported without a %s sink", configs.SinkClickhouse)
 	}
+	return nil
+}
 
-	if u.Scheme != "clickhouse" {
-		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+func openClickhouse(dsn string) (clickhouse.Conn, error) {
+	opts, err := parseClickhouseDSN(dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	host := u.Host
-	if !strings.Contains(host, ":") {
-		host += ":9000"
+	db, err := clickhouse.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open clickhouse connection: %w", err)
 	}
 
-	user := u.User.Username()
-	password, _ := u.User.Password()
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
 
-	database := strings.TrimPrefix(u.Path, "/")
-	if database == "" {
-		database = "default"
+	if err := db.Ping(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("clickhouse is unreachable at %s: %w", strings.Join(opts.Addr, ","), err)
 	}
 
-	return &clickhouse.Options{
-		Addr: []string{host},
-		Auth: clickhouse.Auth{
-			Database: database,
-			Username: user,
-			Password: password,
-		},
-	}, nil
+	return db, nil
 }
@@ -0,0 +1,114 @@
+package apps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// Validate checks the games schema and decodes every file in the parser
+// directory once, reporting the files that cannot be read.
+func (app *App) Validate(ctx context.Context) error {
+	if err := app.requireClickhouse(); err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx)
+
+	schemaErr := app.gameSaverRepository.Verify(ctx)
+	if schemaErr != nil {
+		logger.Error("games schema does not match", logging.Err(schemaErr))
+	}
+
+	parser := repositories.NewGameParserRepository(
+		repositories.WithPathToDir(app.config.ParserDir),
+		repositories.WithSinglePass(),
+		repositories.WithStrictDecode(app.config.StrictDecode),
+	)
+
+	var valid, invalid int
+	for {
+		_, err := parser.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			invalid++
+			logger.Warn("invalid game file", logging.Err(err))
+			continue
+		}
+		valid++
+	}
+
+	fmt.Fprintf(app.Out, "%d valid, %d invalid game files in %s\n", valid, invalid, app.config.ParserDir)
+
+	if invalid > 0 {
+		return errors.Join(schemaErr, fmt.Errorf("%d invalid game files", invalid))
+	}
+	return schemaErr
+}
+
+// Stats prints how many games and rows are stored per month.
+func (app *App) Stats(ctx context.Context) error {
+	if err := app.requireClickhouse(); err != nil {
+		return err
+	}
+
+	stats, err := app.gameReaderRepository.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "games\t%d\n", stats.Games)
+	fmt.Fprintf(w, "rows\t%d\n", stats.Rows)
+	if stats.Games > 0 {
+		fmt.Fprintf(w, "first begin_at\t%s\n", stats.FirstBeginAt.UTC().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "last begin_at\t%s\n", stats.LastBeginAt.UTC().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "month\tgames\trows\n")
+	for _, m := range stats.Months {
+		fmt.Fprintf(w, "%d\t%d\t%d\n", m.Month, m.Games, m.Rows)
+	}
+
+	return w.Flush()
+}
+
+// Export writes the stored rows in the configured date range as JSON lines.
+func (app *App) Export(ctx context.Context) error {
+	if err := app.requireClickhouse(); err != nil {
+		return err
+	}
+
+	out := app.Out
+	if app.config.ExportPath != "" && app.config.ExportPath != "-" {
+		f, err := os.Create(app.config.ExportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var rows int
+	enc := json.NewEncoder(out)
+	err := app.gameReaderRepository.Export(ctx, app.config.From, app.config.Until(), func(g types.GameDB) error {
+		rows++
+		return enc.Encode(g)
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("export finished", "rows", rows, logging.File(app.config.ExportPath))
+	return nil
+}
@@ -0,0 +1,176 @@
+package apps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+type deadLetterStore interface {
+	Put(ctx context.Context, entries ...types.DeadLetter) error
+	List(ctx context.Context) ([]types.DeadLetter, error)
+	Get(ctx context.Context, gameID int64) (*types.DeadLetter, error)
+	Delete(ctx context.Context, gameID int64) error
+}
+
+func (app *App) openDeadLetters() error {
+	switch app.config.DLQ {
+	case configs.DLQDirectory:
+		app.deadLetters = repositories.NewGameDeadLetterDirRepository(
+			repositories.WithDeadLetterDir(app.config.DLQDir),
+		)
+	case configs.DLQClickhouse:
+		s := app.clickhouseSink()
+		if s == nil {
+			return fmt.Errorf("the %s store needs a %s sink", configs.DLQClickhouse, configs.SinkClickhouse)
+		}
+		db, err := openClickhouse(s.config.DSN)
+		if err != nil {
+			return err
+		}
+		app.dlqDB = db
+		app.deadLetters = repositories.NewGameDeadLetterRepository(
+			repositories.WithDeadLetterDB(app.dlqDB),
+		)
+	}
+	return nil
+}
+
+// DLQ runs a dead-letter command: list, inspect with one game ID, or replay
+// with the game IDs to replay, all of them if none.
+func (app *App) DLQ(ctx context.Context, command string, args []string) error {
+	if app.deadLetters == nil {
+		return errors.New("no dead-letter store configured, use -dlq dir or -dlq clickhouse")
+	}
+
+	gameIDs := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid game id %q", arg)
+		}
+		gameIDs[i] = id
+	}
+
+	switch command {
+	case "list":
+		return app.listDeadLetters(ctx)
+	case "inspect":
+		if len(gameIDs) != 1 {
+			return errors.New("expected one game id to inspect")
+		}
+		entry, err := app.deadLetters.Get(ctx, gameIDs[0])
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(app.Out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entry)
+	case "replay":
+		return app.replayDeadLetters(ctx, gameIDs)
+	default:
+		return fmt.Errorf("unknown dlq command %q, expected list, inspect or replay", command)
+	}
+}
+
+func (app *App) listDeadLetters(ctx context.Context) error {
+	entries, err := app.deadLetters.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "game id\tstage\tattempts\tfailed at\tfile\terror\n")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n",
+			e.GameID, e.Stage, e.Attempts, e.FailedAt.UTC().Format("2006-01-02 15:04:05"), e.File, e.Error)
+	}
+	return w.Flush()
+}
+
+// replayDeadLetters feeds the stored payloads through the pipeline once, as
+// in once mode. A game is removed from the store once its rows are saved; a
+// game rejected again stays with one more attempt.
+func (app *App) replayDeadLetters(ctx context.Context, gameIDs []int64) error {
+	var entries []types.DeadLetter
+	if len(gameIDs) == 0 {
+		var err error
+		if entries, err = app.deadLetters.List(ctx); err != nil {
+			return err
+		}
+	}
+	for _, id := range gameIDs {
+		entry, err := app.deadLetters.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, *entry)
+	}
+
+	parser := &deadLetterParser{games: make([]*types.GameParser, len(entries))}
+	for i, e := range entries {
+		var game types.GameParser
+		if err := json.Unmarshal(e.Payload, &game); err != nil {
+			return fmt.Errorf("game %d: invalid payload: %w", e.GameID, err)
+		}
+		game.File = e.File
+		game.Raw = e.Payload
+		parser.games[i] = &game
+	}
+
+	app.config.Mode = configs.ModeOnce
+	app.Workers = []func(ctx context.Context) error{
+		app.newParserWorker(parser),
+	}
+	if err := app.Run(ctx); err != nil {
+		return fmt.Errorf("replay failed, dead letters kept: %w", err)
+	}
+
+	var replayed, rejected int
+	for _, e := range entries {
+		current, err := app.deadLetters.Get(ctx, e.GameID)
+		switch {
+		case err == nil && !current.FailedAt.Equal(e.FailedAt):
+			rejected++
+			continue
+		case err != nil && !errors.Is(err, repositories.ErrDeadLetterNotFound):
+			return err
+		}
+		if err := app.deadLetters.Delete(ctx, e.GameID); err != nil {
+			return err
+		}
+		replayed++
+	}
+
+	logging.FromContext(ctx).Info("dead letters replayed", "replayed", replayed, "rejected", rejected)
+	fmt.Fprintf(app.Out, "%d replayed, %d rejected again\n", replayed, rejected)
+	return nil
+}
+
+// deadLetterParser hands out the replayed games, then io.EOF.
+type deadLetterParser struct {
+	mu    sync.Mutex
+	games []*types.GameParser
+}
+
+func (p *deadLetterParser) Next(ctx context.Context) (*types.GameParser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.games) == 0 {
+		return nil, io.EOF
+	}
+	game := p.games[0]
+	p.games = p.games[1:]
+	return game, nil
+}
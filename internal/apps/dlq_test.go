@@ -0,0 +1,118 @@
+package apps_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sbilibin2017/cs2/internal/apps"
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+func TestApp_DLQ(t *testing.T) {
+	dir := t.TempDir()
+	parserDir := filepath.Join(dir, "raw")
+	dlqDir := filepath.Join(dir, "dlq")
+	path := filepath.Join(dir, "games.db")
+
+	// Every player on one team: the game is dropped while flattening.
+	data, err := os.ReadFile("./testdata/game_1.json")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(parserDir, 0o755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(parserDir, "game_1.json"),
+		[]byte(strings.ReplaceAll(string(data), `"id": 2000`, `"id": 1000`)),
+		0o644,
+	))
+
+	cfg := configs.NewConfig(
+		configs.WithParserDir(parserDir),
+		configs.WithMode(configs.ModeOnce),
+		configs.WithSink(configs.SinkSQLite),
+		configs.WithDatabaseDSN("sqlite://"+path),
+		configs.WithAutoMigrate(true),
+		configs.WithDLQ(configs.DLQDirectory),
+		configs.WithDLQDir(dlqDir),
+		configs.WithParseWorkers(1),
+		configs.WithFlattenWorkers(1),
+		configs.WithSaveWorkers(1),
+		configs.WithRetryMaxAttempts(1),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	app, err := apps.NewApp(cfg)
+	require.NoError(t, err)
+	require.NoError(t, app.Run(ctx))
+
+	dlq := func(command string, args ...string) string {
+		t.Helper()
+		app, err := apps.NewApp(cfg)
+		require.NoError(t, err)
+		defer app.Close()
+
+		var out bytes.Buffer
+		app.Out = &out
+		require.NoError(t, app.DLQ(ctx, command, args))
+		return out.String()
+	}
+
+	list := dlq("list")
+	assert.Contains(t, list, "game has 1 teams, expected 2")
+	assert.Contains(t, list, filepath.Join(parserDir, "game_1.json"))
+
+	var entry types.DeadLetter
+	require.NoError(t, json.Unmarshal([]byte(dlq("inspect", "101")), &entry))
+	assert.Equal(t, "flatten", entry.Stage)
+	assert.Equal(t, int64(1), entry.Attempts)
+
+	// Replaying the uncorrected game rejects it again.
+	assert.Equal(t, "0 replayed, 1 rejected again\n", dlq("replay"))
+	require.NoError(t, json.Unmarshal([]byte(dlq("inspect", "101")), &entry))
+	assert.Equal(t, int64(2), entry.Attempts)
+
+	// Correct the payload in place, as an operator would, and replay it.
+	var game types.GameParser
+	require.NoError(t, json.Unmarshal(entry.Payload, &game))
+	game.Players[2].Team.ID = 2000
+	game.Players[3].Team.ID = 2000
+	entry.Payload, err = json.Marshal(game)
+	require.NoError(t, err)
+	corrected, err := json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dlqDir, "101.json"), corrected, 0o644))
+
+	assert.Equal(t, "1 replayed, 0 rejected again\n", dlq("replay", "101"))
+	assert.Equal(t, "game id  stage  attempts  failed at  file  error\n", dlq("list"))
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var rows int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM games").Scan(&rows))
+	assert.Equal(t, 24, rows)
+}
+
+func TestApp_DLQ_NotConfigured(t *testing.T) {
+	app, err := apps.NewApp(configs.NewConfig(
+		configs.WithSink("csv"),
+		configs.WithSinkDir(t.TempDir()),
+	))
+	require.NoError(t, err)
+	defer app.Close()
+
+	assert.EqualError(t, app.DLQ(context.Background(), "list", nil),
+		"no dead-letter store configured, use -dlq dir or -dlq clickhouse")
+}
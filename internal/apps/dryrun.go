@@ -0,0 +1,182 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/sbilibin2017/cs2/internal/workers"
+)
+
+// DryRun parses and flattens every file in the parser directory once, as
+// ingest would, and prints what would have been inserted. Nothing is written
+// and no database connection is needed.
+func (app *App) DryRun(ctx context.Context) error {
+	report := newDryRunReport()
+
+	parser := repositories.NewGameParserRepository(
+		repositories.WithPathToDir(app.config.ParserDir),
+		repositories.WithSinglePass(),
+		repositories.WithStrictDecode(app.config.StrictDecode),
+		repositories.WithParserObserver(report),
+	)
+	worker := workers.NewParserWorker(
+		workers.WithParser(skipInvalidGames{parser}),
+		workers.WithSaver(nopSaver{}),
+		workers.WithParseConcurrency(app.config.ParseWorkers),
+		workers.WithFlattenConcurrency(app.config.FlattenWorkers),
+		workers.WithObserver(report),
+	)
+	if err := worker(ctx); err != nil {
+		return err
+	}
+
+	if err := report.print(app.Out); err != nil {
+		return err
+	}
+	if report.failed > 0 {
+		return fmt.Errorf("%d invalid game files", report.failed)
+	}
+	return nil
+}
+
+// skipInvalidGames keeps reading past invalid files, which the report has
+// already recorded, instead of stopping the pipeline.
+type skipInvalidGames struct {
+	parser workers.Parser
+}
+
+func (p skipInvalidGames) Next(ctx context.Context) (*types.GameParser, error) {
+	for {
+		game, err := p.parser.Next(ctx)
+		if !errors.Is(err, repositories.ErrInvalidGameFile) {
+			return game, err
+		}
+	}
+}
+
+type nopSaver struct{}
+
+func (nopSaver) Save(ctx context.Context, games []types.GameDB) error { return nil }
+
+type dryRunFile struct {
+	err     error
+	rows    int
+	dropped []string
+	unknown []string
+}
+
+// dryRunReport collects the outcome of every file. It implements both
+// repositories.GameParserObserver and workers.Observer.
+type dryRunReport struct {
+	mu     sync.Mutex
+	files  map[string]*dryRunFile
+	failed int
+}
+
+func newDryRunReport() *dryRunReport {
+	return &dryRunReport{files: make(map[string]*dryRunFile)}
+}
+
+func (r *dryRunReport) file(path string) *dryRunFile {
+	f, ok := r.files[path]
+	if !ok {
+		f = &dryRunFile{}
+		r.files[path] = f
+	}
+	return f
+}
+
+func (r *dryRunReport) ObserveScan(files int) {}
+
+func (r *dryRunReport) ObserveFile(path string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file(path).err = err
+	if err != nil {
+		r.failed++
+	}
+}
+
+func (r *dryRunReport) ObserveUnknownFields(path string, fields []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(path)
+	for _, field := range fields {
+		f.unknown = append(f.unknown, "field "+field)
+	}
+}
+
+func (r *dryRunReport) ObserveGameDropped(file string, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(file)
+	f.dropped = append(f.dropped, reason)
+}
+
+func (r *dryRunReport) ObserveFlattened(file string, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file(file).rows += rows
+}
+
+func (r *dryRunReport) ObserveUnknownValue(file string, field string, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(file)
+	f.unknown = append(f.unknown, fmt.Sprintf("%s=%q", field, value))
+}
+
+func (r *dryRunReport) ObserveSaved(games []types.GameDB)            {}
+func (r *dryRunReport) ObserveQueue(stage string, length func() int) {}
+func (r *dryRunReport) ForgetQueues()                                {}
+func (r *dryRunReport) ObserveStage(stage string) func(err error)    { return func(error) {} }
+
+// print writes one line per file followed by the totals.
+func (r *dryRunReport) print(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rows int
+	dropped := make(map[string]int)
+	unknown := make(map[string]int)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "file\trows\tdropped\tunknown\n")
+	for _, path := range slices.Sorted(maps.Keys(r.files)) {
+		f := r.files[path]
+		if f.err != nil {
+			fmt.Fprintf(w, "%s\t-\t\terror: %v\n", filepath.Base(path), f.err)
+			continue
+		}
+		rows += f.rows
+		for _, reason := range f.dropped {
+			dropped[reason]++
+		}
+		for _, value := range f.unknown {
+			unknown[value]++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", filepath.Base(path), f.rows, strings.Join(f.dropped, ", "), strings.Join(f.unknown, ", "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d files, %d invalid, %d rows would be inserted\n", len(r.files), r.failed, rows)
+	for _, reason := range slices.Sorted(maps.Keys(dropped)) {
+		fmt.Fprintf(out, "dropped %s: %d games\n", reason, dropped[reason])
+	}
+	for _, value := range slices.Sorted(maps.Keys(unknown)) {
+		fmt.Fprintf(out, "unknown %s: %d games\n", value, unknown[value])
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package apps
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_DryRun(t *testing.T) {
+	game, err := os.ReadFile("testdata/game_1.json")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "0_broken.json"), []byte(`{`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a_game.json"), game, 0o644))
+	unknown := strings.NewReplacer(`"tier": "a"`, `"tier": "z"`, `"id": 101,`, `"id": 101, "forfeit": false,`).Replace(string(game))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b_unknown.json"), []byte(unknown), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c_one_team.json"), []byte(`{"id": 3, "players": [{"team": {"id": 1}}]}`), 0o644))
+
+	// No database: NewApp must not try to connect.
+	app, err := NewApp(configs.NewConfig(
+		configs.WithParserDir(dir),
+		configs.WithDryRun(true),
+	))
+	require.NoError(t, err)
+	defer app.Close()
+
+	var out bytes.Buffer
+	app.Out = &out
+	err = app.DryRun(context.Background())
+	assert.EqualError(t, err, "1 invalid game files")
+
+	lines := strings.Split(out.String(), "\n")
+	// Files are listed by name; the broken one does not stop the run.
+	assert.Regexp(t, `^0_broken\.json\s+-\s+error: .*invalid game file`, lines[1])
+	assert.Regexp(t, `^a_game\.json\s+24\s*$`, lines[2])
+	assert.Regexp(t, `^b_unknown\.json\s+24\s+field forfeit, tier="z"$`, lines[3])
+	assert.Regexp(t, `^c_one_team\.json\s+0\s+not_two_teams\s*$`, lines[4])
+	assert.Contains(t, out.String(), "4 files, 1 invalid, 48 rows would be inserted\n")
+	assert.Contains(t, out.String(), "dropped not_two_teams: 1 games\n")
+	assert.Contains(t, out.String(), "unknown field forfeit: 1 games\n")
+	assert.Contains(t, out.String(), "unknown tier=\"z\": 1 games\n")
+}
@@ -0,0 +1,140 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/handlers"
+	"github.com/sbilibin2017/cs2/internal/workers"
+)
+
+// healthState is updated by Run and read by the probe handlers.
+type healthState struct {
+	schemaVerified atomic.Bool
+	draining       atomic.Bool
+	workersStarted atomic.Int32
+	workersRunning atomic.Int32
+
+	// stagesFailed holds, per pipeline stage, the error that stopped one of
+	// its goroutines last.
+	stagesMu     sync.Mutex
+	stagesFailed map[string]error
+}
+
+func (h *healthState) stageFailed(stage string, err error) {
+	h.stagesMu.Lock()
+	defer h.stagesMu.Unlock()
+	if h.stagesFailed == nil {
+		h.stagesFailed = make(map[string]error)
+	}
+	h.stagesFailed[stage] = err
+}
+
+// failedStages describes the stages that lost a goroutine, in stage order.
+func (h *healthState) failedStages() string {
+	h.stagesMu.Lock()
+	defer h.stagesMu.Unlock()
+	var failed []string
+	for _, stage := range slices.Sorted(maps.Keys(h.stagesFailed)) {
+		failed = append(failed, fmt.Sprintf("%s stopped: %v", stage, h.stagesFailed[stage]))
+	}
+	return strings.Join(failed, "; ")
+}
+
+// healthObserver passes the pipeline events on and records the stage
+// goroutines stopped by an error: the other goroutines keep the worker
+// running, so only the stages tell that the pipeline lost capacity.
+type healthObserver struct {
+	workers.Observer
+	health *healthState
+}
+
+func (o healthObserver) ObserveStage(stage string) func(err error) {
+	stopped := o.Observer.ObserveStage(stage)
+	return func(err error) {
+		stopped(err)
+		if err != nil {
+			o.health.stageFailed(stage, err)
+		}
+	}
+}
+
+// livenessChecks fail when a worker, or a goroutine of a pipeline stage,
+// has stopped while the others are still meant to be running.
+func (app *App) livenessChecks() []handlers.Check {
+	return []handlers.Check{
+		{Name: "workers", Check: func(ctx context.Context) error {
+			started := app.health.workersStarted.Load()
+			running := app.health.workersRunning.Load()
+			if running < started && !app.health.draining.Load() {
+				return fmt.Errorf("%d of %d workers stopped", started-running, started)
+			}
+			return nil
+		}},
+		{Name: "stages", Check: func(ctx context.Context) error {
+			if failed := app.health.failedStages(); failed != "" && !app.health.draining.Load() {
+				return errors.New(failed)
+			}
+			return nil
+		}},
+	}
+}
+
+// readinessChecks pass once the parser directory can be read and every sink
+// database answers, for ClickHouse once the schema has been verified too.
+// They fail again while shutting down.
+func (app *App) readinessChecks() []handlers.Check {
+	checks := []handlers.Check{
+		{Name: "pipeline", Check: func(ctx context.Context) error {
+			switch {
+			case app.health.draining.Load():
+				return errors.New("shutting down")
+			case app.health.workersStarted.Load() == 0:
+				return errors.New("starting")
+			}
+			return nil
+		}},
+		{Name: "input", Check: func(ctx context.Context) error {
+			return checkInputDir(app.config.ParserDir)
+		}},
+	}
+	for _, s := range app.sinks {
+		if s.hasSchema() {
+			checks = append(checks, handlers.Check{Name: s.config.Name, Check: s.ping})
+		}
+	}
+	if slices.ContainsFunc(app.sinks, func(s *sink) bool { return s.config.Type == configs.SinkClickhouse }) {
+		checks = append(checks, handlers.Check{Name: "schema", Check: func(ctx context.Context) error {
+			if !app.health.schemaVerified.Load() {
+				return errors.New("games schema not verified yet")
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+func checkInputDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/handlers"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runChecks(checks []handlers.Check) map[string]string {
+	results := make(map[string]string, len(checks))
+	for _, c := range checks {
+		results[c.Name] = "ok"
+		if err := c.Check(context.Background()); err != nil {
+			results[c.Name] = err.Error()
+		}
+	}
+	return results
+}
+
+func TestApp_LivenessChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  int32
+		running  int32
+		draining bool
+		expected string
+	}{
+		{name: "Not started", expected: "ok"},
+		{name: "All running", started: 2, running: 2, expected: "ok"},
+		{name: "Worker stopped", started: 2, running: 1, expected: "1 of 2 workers stopped"},
+		{name: "Stopped while draining", started: 2, running: 0, draining: true, expected: "ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{}
+			app.health.workersStarted.Store(tt.started)
+			app.health.workersRunning.Store(tt.running)
+			app.health.draining.Store(tt.draining)
+
+			assert.Equal(t, tt.expected, runChecks(app.livenessChecks())["workers"])
+		})
+	}
+}
+
+func TestApp_LivenessChecks_Stages(t *testing.T) {
+	app := &App{}
+	observer := healthObserver{Observer: metrics.New(), health: &app.health}
+
+	save := observer.ObserveStage(logging.StageSave)
+	parse := observer.ObserveStage(logging.StageParse)
+	observer.ObserveStage(logging.StageFlatten)
+	assert.Equal(t, "ok", runChecks(app.livenessChecks())["stages"])
+
+	// A stage that stops once its input is done is not a failure.
+	save(nil)
+	assert.Equal(t, "ok", runChecks(app.livenessChecks())["stages"])
+
+	parse(errors.New("disk gone"))
+	assert.Equal(t, "parse stopped: disk gone", runChecks(app.livenessChecks())["stages"])
+
+	app.health.draining.Store(true)
+	assert.Equal(t, "ok", runChecks(app.livenessChecks())["stages"])
+}
+
+func TestApp_ReadinessChecks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "game.json")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0o644))
+
+	app := &App{
+		config: configs.NewConfig(configs.WithParserDir(dir)),
+		sinks:  []*sink{{config: configs.SinkConfig{Name: "clickhouse", Type: configs.SinkClickhouse}}},
+	}
+
+	assert.Equal(t, map[string]string{
+		"pipeline":   "starting",
+		"clickhouse": "connection closed",
+		"schema":     "games schema not verified yet",
+		"input":      "ok",
+	}, runChecks(app.readinessChecks()))
+
+	app.health.schemaVerified.Store(true)
+	app.health.workersStarted.Store(1)
+	results := runChecks(app.readinessChecks())
+	assert.Equal(t, "ok", results["pipeline"])
+	assert.Equal(t, "ok", results["schema"])
+
+	app.health.draining.Store(true)
+	assert.Equal(t, "shutting down", runChecks(app.readinessChecks())["pipeline"])
+
+	app.config.ParserDir = file
+	assert.Equal(t, file+" is not a directory", runChecks(app.readinessChecks())["input"])
+
+	app.config.ParserDir = filepath.Join(dir, "missing")
+	assert.Contains(t, runChecks(app.readinessChecks())["input"], "no such file or directory")
+}
+
+func TestApp_ReadinessChecks_FileSink(t *testing.T) {
+	app := &App{
+		config: configs.NewConfig(configs.WithParserDir(t.TempDir())),
+		sinks:  []*sink{{config: configs.SinkConfig{Name: "csv", Type: "csv"}}},
+	}
+	app.health.workersStarted.Store(1)
+
+	assert.Equal(t, map[string]string{
+		"pipeline": "ok",
+		"input":    "ok",
+	}, runChecks(app.readinessChecks()))
+}
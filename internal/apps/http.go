@@ -0,0 +1,59 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/handlers"
+	"github.com/sbilibin2017/cs2/internal/logging"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// listenHTTP opens the listener up front, so that a busy port fails the
+// command instead of being logged from the server goroutine.
+func listenHTTP(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// serveHTTP serves /metrics, /healthz and /readyz on ln until the returned
+// shutdown function is called.
+func (app *App) serveHTTP(ctx context.Context, ln net.Listener) func() {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", app.metrics.Handler())
+	mux.Handle("GET /healthz", handlers.NewHealthHandler(app.livenessChecks()...))
+	mux.Handle("GET /readyz", handlers.NewHealthHandler(app.readinessChecks()...))
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("serving metrics and probes", "addr", ln.Addr().String())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("http server failed", logging.Err(err))
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warn("http server shutdown failed", logging.Err(err))
+		}
+		<-done
+	}
+}
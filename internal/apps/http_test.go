@@ -0,0 +1,70 @@
+package apps
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_ServeHTTP_Metrics(t *testing.T) {
+	app := &App{metrics: metrics.New()}
+	app.metrics.ObserveFlattened("game_1.json", 24)
+
+	ln, err := listenHTTP("127.0.0.1:0")
+	require.NoError(t, err)
+	shutdown := app.serveHTTP(context.Background(), ln)
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "cs2_rows_flattened_total 24")
+
+	shutdown()
+
+	_, err = http.Get("http://" + ln.Addr().String() + "/metrics")
+	assert.Error(t, err)
+}
+
+func TestApp_ServeHTTP_Probes(t *testing.T) {
+	app := &App{
+		config:  configs.NewConfig(configs.WithParserDir(t.TempDir())),
+		metrics: metrics.New(),
+	}
+
+	ln, err := listenHTTP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer app.serveHTTP(context.Background(), ln)()
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + ln.Addr().String() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+
+	app.health.workersStarted.Store(1)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/healthz"))
+}
+
+func TestListenHTTP_AddressInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	_, err = listenHTTP(busy.Addr().String())
+	assert.ErrorContains(t, err, "failed to listen on "+busy.Addr().String())
+}
@@ -0,0 +1,145 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/pressly/goose/v3"
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/migrations"
+	"github.com/sbilibin2017/cs2/migrations/postgres"
+	"github.com/sbilibin2017/cs2/migrations/sqlite"
+)
+
+// Migrate applies the embedded migrations of every database sink to its
+// DSN. The command is one of up, down, status or redo.
+func (app *App) Migrate(ctx context.Context, command string) error {
+	var targets []configs.SinkConfig
+	for _, cfg := range app.config.SinkConfigs() {
+		if !slices.Contains(configs.FileSinks, cfg.Type) {
+			targets = append(targets, cfg)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("%s sink has no schema to migrate", app.config.SinkConfigs()[0].Type)
+	}
+
+	for _, cfg := range targets {
+		if len(targets) > 1 && command == "status" {
+			fmt.Fprintf(app.Out, "%s:\n", cfg.Name)
+		}
+		if err := app.migrate(ctx, cfg, command); err != nil {
+			if len(targets) > 1 {
+				return fmt.Errorf("sink %s: %w", cfg.Name, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *App) migrate(ctx context.Context, cfg configs.SinkConfig, command string) error {
+	dialect, db, fsys, err := migrationTarget(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var opts []goose.ProviderOption
+	if dialect == goose.DialectClickHouse {
+		opts = append(opts, goose.WithGoMigrations(migrations.GoMigrations()...))
+	}
+	provider, err := goose.NewProvider(dialect, db, fsys, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	defer provider.Close()
+
+	switch command {
+	case "up":
+		results, err := provider.Up(ctx)
+		logMigrationResults(ctx, results...)
+		return err
+	case "down":
+		result, err := provider.Down(ctx)
+		logMigrationResults(ctx, result)
+		return err
+	case "redo":
+		result, err := provider.Down(ctx)
+		logMigrationResults(ctx, result)
+		if err != nil {
+			return err
+		}
+		result, err = provider.UpByOne(ctx)
+		logMigrationResults(ctx, result)
+		return err
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "applied at\tmigration\n")
+		for _, s := range statuses {
+			appliedAt := "Pending"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\n", appliedAt, s.Source.Path)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or redo", command)
+	}
+}
+
+// migrationTarget opens a connection for goose to the sink's database.
+func migrationTarget(cfg configs.SinkConfig) (goose.Dialect, *sql.DB, fs.FS, error) {
+	switch cfg.Type {
+	case configs.SinkPostgres:
+		if err := checkPostgresDSN(cfg.DSN); err != nil {
+			return "", nil, nil, err
+		}
+		db, err := sql.Open("pgx", cfg.DSN)
+		return goose.DialectPostgres, db, postgres.FS, err
+	case configs.SinkSQLite:
+		path, err := sqlitePath(cfg.DSN)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		db, err := sql.Open("sqlite", path)
+		return goose.DialectSQLite3, db, sqlite.FS, err
+	}
+
+	opts, err := parseClickhouseDSN(cfg.DSN)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return goose.DialectClickHouse, clickhouse.OpenDB(opts), migrations.FS, nil
+}
+
+func logMigrationResults(ctx context.Context, results ...*goose.MigrationResult) {
+	logger := logging.FromContext(ctx)
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		attrs := []any{
+			"version", r.Source.Version,
+			logging.File(r.Source.Path),
+			"direction", r.Direction,
+			logging.Latency(r.Duration),
+		}
+		if r.Error != nil {
+			logger.Error("migration failed", append(attrs, logging.Err(r.Error))...)
+			continue
+		}
+		logger.Info("migration applied", attrs...)
+	}
+}
@@ -0,0 +1,378 @@
+package apps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/sbilibin2017/cs2/internal/workers"
+)
+
+const replayProgressInterval = 10 * time.Second
+
+// replayState is kept in the state file while a replay runs. Version is the
+// row version the replay started at: rows saved by the replay are newer.
+// SkippedFiles are the files out of its scope and InvalidFiles those that are
+// not valid games, which a resumed replay does not read again.
+type replayState struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	GameIDs []int64   `json:"game_ids,omitempty"`
+	Version uint64    `json:"version"`
+
+	SkippedFiles []string `json:"skipped_files,omitempty"`
+	InvalidFiles []string `json:"invalid_files,omitempty"`
+}
+
+// Replay re-ingests the games of the parser directory that begin in the
+// configured range and, if set, have one of the configured IDs. Once they are
+// saved, the rows ClickHouse kept from before the replay for those games are
+// deleted, including rows the current flattening no longer produces.
+//
+// An interrupted replay is resumed by running it again with the same range
+// and IDs: the games already saved since it started are skipped, and so are
+// the files it found out of range or invalid. A replay with invalid files
+// still finishes, and then fails listing them.
+func (app *App) Replay(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+
+	state, resumed, err := app.loadReplayState()
+	if err != nil {
+		return err
+	}
+
+	done := make(map[int64]bool)
+	if resumed && app.gameReaderRepository != nil {
+		ids, err := app.gameReaderRepository.GameIDsSince(ctx, state.Version)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			done[id] = true
+		}
+		logger.Info("resuming replay", "saved_games", len(done), logging.File(app.config.ReplayState))
+	}
+
+	parser := newReplayParser(state, done, app.metrics)
+	files := repositories.NewGameParserRepository(
+		repositories.WithPathToDir(app.config.ParserDir),
+		repositories.WithSinglePass(),
+		repositories.WithStrictDecode(app.config.StrictDecode),
+		repositories.WithSkipFile(parser.skipFile),
+		repositories.WithParserObserver(parser),
+	)
+	parser.parser = files
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(replayProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				logger.Info("replay progress", parser.progress(files)...)
+				if err := app.saveReplayState(parser.state()); err != nil {
+					logger.Warn("failed to save the replay state", logging.Err(err))
+				}
+			}
+		}
+	}()
+
+	// Failed flushes must fail the replay, as in once mode.
+	app.config.Mode = configs.ModeOnce
+	app.gameParserRepository = files
+	app.Workers = []func(ctx context.Context) error{
+		app.newParserWorker(parser),
+	}
+	err = app.Run(ctx)
+	close(stop)
+	wg.Wait()
+
+	// Invalid files are recorded rather than failing the replay.
+	if errors.Is(err, errInvalidGameFiles) {
+		err = nil
+	}
+	if err == nil && !parser.finished.Load() {
+		err = errors.New("interrupted")
+	}
+	if err != nil {
+		if err := app.saveReplayState(parser.state()); err != nil {
+			logger.Warn("failed to save the replay state", logging.Err(err))
+		}
+		return fmt.Errorf("replay incomplete, run it again to resume: %w", err)
+	}
+
+	if err := app.deleteStaleRows(ctx, parser.matchedIDs(), state.Version); err != nil {
+		return fmt.Errorf("failed to delete the rows saved before the replay, run it again to resume: %w", err)
+	}
+
+	if app.config.ReplayState != "" {
+		if err := os.Remove(app.config.ReplayState); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	logger.Info("replay finished", parser.progress(files)...)
+
+	if invalid := parser.state().InvalidFiles; len(invalid) > 0 {
+		return fmt.Errorf("%w: %s", errInvalidGameFiles, strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// loadReplayState resumes the replay recorded in the state file if it has
+// the same range and IDs, and otherwise records a new one.
+func (app *App) loadReplayState() (state replayState, resumed bool, err error) {
+	scope := replayState{
+		From:    app.config.From,
+		To:      app.config.To,
+		GameIDs: app.config.GameIDs,
+		Version: uint64(time.Now().UnixMilli()),
+	}
+	path := app.config.ReplayState
+	if path == "" {
+		return scope, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return state, false, fmt.Errorf("%s: %w", path, err)
+		}
+		if state.From.Equal(scope.From) && state.To.Equal(scope.To) && slices.Equal(state.GameIDs, scope.GameIDs) {
+			return state, true, nil
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return state, false, err
+	}
+
+	return scope, false, app.saveReplayState(scope)
+}
+
+// saveReplayState replaces the state file, so that an interrupted write
+// leaves the previous state.
+func (app *App) saveReplayState(state replayState) error {
+	path := app.config.ReplayState
+	if path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// deleteStaleRows removes the rows older than version of the replayed games
+// from the ClickHouse sink, and their round events if kept. It relies on the
+// replay having inserted every game again: the deduplication token includes
+// the version, so an unchanged game is not dropped as a duplicate of its
+// ingested rows. The sinks are closed once Run returns, so it opens its own
+// connection. Other sinks upsert by key and have nothing to delete.
+func (app *App) deleteStaleRows(ctx context.Context, gameIDs []int64, version uint64) error {
+	s := app.clickhouseSink()
+	if s == nil || len(gameIDs) == 0 {
+		return nil
+	}
+
+	db, err := openClickhouse(s.config.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	start := time.Now()
+	saver := repositories.NewGameSaverRepository(repositories.WithDB(db))
+	if err := saver.DeleteStale(ctx, gameIDs, version); err != nil {
+		return err
+	}
+	if app.config.RoundEvents {
+		events := repositories.NewGameRoundEventRepository(repositories.WithRoundEventDB(db))
+		if err := events.DeleteStale(ctx, gameIDs, version); err != nil {
+			return err
+		}
+	}
+
+	logging.FromContext(ctx).Info("stale rows deleted",
+		"games", len(gameIDs),
+		logging.Latency(time.Since(start)),
+	)
+	return nil
+}
+
+// replayParser hands out the games in the scope of a replay, skipping those
+// already saved by the replay being resumed. As the observer of the files it
+// reads, it records the invalid ones.
+type replayParser struct {
+	parser   workers.Parser
+	observer repositories.GameParserObserver
+	scope    replayState
+	from     time.Time
+	until    time.Time
+	gameIDs  map[int64]bool
+	done     map[int64]bool
+
+	mu      sync.Mutex
+	matched map[int64]bool
+	skipped map[string]bool
+	invalid map[string]bool
+
+	replayed   atomic.Int64
+	resumed    atomic.Int64
+	outOfRange atomic.Int64
+	finished   atomic.Bool
+}
+
+func newReplayParser(state replayState, done map[int64]bool, observer repositories.GameParserObserver) *replayParser {
+	p := &replayParser{
+		observer: observer,
+		scope:    state,
+		from:     state.From,
+		done:     done,
+		matched:  make(map[int64]bool),
+		skipped:  make(map[string]bool),
+		invalid:  make(map[string]bool),
+	}
+	for _, file := range state.SkippedFiles {
+		p.skipped[file] = true
+	}
+	for _, file := range state.InvalidFiles {
+		p.invalid[file] = true
+	}
+	// To is the last day replayed.
+	if !state.To.IsZero() {
+		p.until = state.To.AddDate(0, 0, 1)
+	}
+	if len(state.GameIDs) > 0 {
+		p.gameIDs = make(map[int64]bool, len(state.GameIDs))
+		for _, id := range state.GameIDs {
+			p.gameIDs[id] = true
+		}
+	}
+	return p
+}
+
+func (p *replayParser) Next(ctx context.Context) (*types.GameParser, error) {
+	for {
+		game, err := p.parser.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			p.finished.Store(true)
+		}
+		if err != nil || game == nil {
+			return game, err
+		}
+
+		if !p.inScope(game) {
+			p.outOfRange.Add(1)
+			p.mu.Lock()
+			p.skipped[game.File] = true
+			p.mu.Unlock()
+			continue
+		}
+
+		p.mu.Lock()
+		p.matched[game.ID] = true
+		p.mu.Unlock()
+
+		if p.done[game.ID] {
+			p.resumed.Add(1)
+			continue
+		}
+		p.replayed.Add(1)
+		return game, nil
+	}
+}
+
+func (p *replayParser) inScope(game *types.GameParser) bool {
+	if !p.from.IsZero() && game.BeginAt.Before(p.from) {
+		return false
+	}
+	if !p.until.IsZero() && !game.BeginAt.Before(p.until) {
+		return false
+	}
+	return p.gameIDs == nil || p.gameIDs[game.ID]
+}
+
+// skipFile tells whether a file was out of scope or invalid when the replay
+// being resumed read it.
+func (p *replayParser) skipFile(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.skipped[path] || p.invalid[path]
+}
+
+func (p *replayParser) ObserveScan(files int) {
+	p.observer.ObserveScan(files)
+}
+
+func (p *replayParser) ObserveFile(path string, err error) {
+	if errors.Is(err, repositories.ErrInvalidGameFile) {
+		p.mu.Lock()
+		p.invalid[path] = true
+		p.mu.Unlock()
+	}
+	p.observer.ObserveFile(path, err)
+}
+
+func (p *replayParser) ObserveUnknownFields(path string, fields []string) {
+	p.observer.ObserveUnknownFields(path, fields)
+}
+
+// state returns the scope of the replay with the files found so far.
+func (p *replayParser) state() replayState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.scope
+	state.SkippedFiles = slices.Sorted(maps.Keys(p.skipped))
+	state.InvalidFiles = slices.Sorted(maps.Keys(p.invalid))
+	return state
+}
+
+func (p *replayParser) matchedIDs() []int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Sorted(maps.Keys(p.matched))
+}
+
+func (p *replayParser) progress(files *repositories.GameParserRepository) []any {
+	stats := files.Stats()
+	return []any{
+		slog.Int64("files", stats.Files),
+		slog.Int64("total_files", stats.Scanned),
+		slog.Int64("failed_files", stats.Failed),
+		slog.Int64("replayed", p.replayed.Load()),
+		slog.Int64("already_saved", p.resumed.Load()),
+		slog.Int64("out_of_range", p.outOfRange.Load()),
+	}
+}
@@ -0,0 +1,171 @@
+package apps_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sbilibin2017/cs2/internal/apps"
+	"github.com/sbilibin2017/cs2/internal/configs"
+)
+
+func TestApp_Replay(t *testing.T) {
+	dir := t.TempDir()
+	parserDir := filepath.Join(dir, "raw")
+	statePath := filepath.Join(dir, "state", "replay.json")
+	path := filepath.Join(dir, "games.db")
+
+	// Game 101 begins on 2024-03-01, game 102 a month later.
+	data, err := os.ReadFile("./testdata/game_1.json")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(parserDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(parserDir, "game_1.json"), data, 0o644))
+	later := strings.NewReplacer(`"id": 101`, `"id": 102`, "2024-03-01", "2024-04-01").Replace(string(data))
+	require.NoError(t, os.WriteFile(filepath.Join(parserDir, "game_2.json"), []byte(later), 0o644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	replay := func(opts ...configs.Opt) error {
+		t.Helper()
+		app, err := apps.NewApp(configs.NewConfig(append([]configs.Opt{
+			configs.WithParserDir(parserDir),
+			configs.WithSink(configs.SinkSQLite),
+			configs.WithDatabaseDSN("sqlite://" + path),
+			configs.WithAutoMigrate(true),
+			configs.WithReplayState(statePath),
+			configs.WithParseWorkers(1),
+			configs.WithFlattenWorkers(1),
+			configs.WithSaveWorkers(1),
+		}, opts...)...))
+		require.NoError(t, err)
+		err = app.Replay(ctx)
+
+		_, statErr := os.Stat(statePath)
+		assert.ErrorIs(t, statErr, os.ErrNotExist)
+		return err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	gameIDs := func() []int64 {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, "SELECT DISTINCT game_id FROM games ORDER BY game_id")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			require.NoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+		require.NoError(t, rows.Err())
+		return ids
+	}
+
+	// The range includes the day it ends on.
+	require.NoError(t, replay(
+		configs.WithFrom(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)),
+		configs.WithTo(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)),
+	))
+	assert.Equal(t, []int64{101}, gameIDs())
+
+	// A state file left by a replay of another scope does not skip any game.
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"game_ids":[101],"version":1}`), 0o644))
+	require.NoError(t, replay(configs.WithGameIDs(102)))
+	assert.Equal(t, []int64{101, 102}, gameIDs())
+}
+
+func TestApp_Replay_InvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	parserDir := filepath.Join(dir, "raw")
+	statePath := filepath.Join(dir, "replay.json")
+	path := filepath.Join(dir, "games.db")
+
+	// The broken file is read between games 101 and 103; game 102 is out of
+	// the range.
+	data, err := os.ReadFile("./testdata/game_1.json")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(parserDir, 0o755))
+	games := map[string]string{
+		"game_1.json": string(data),
+		"game_2.json": "{",
+		"game_3.json": strings.NewReplacer(`"id": 101`, `"id": 102`, "2024-03-01", "2024-05-01").Replace(string(data)),
+		"game_4.json": strings.NewReplacer(`"id": 101`, `"id": 103`).Replace(string(data)),
+	}
+	for name, game := range games {
+		require.NoError(t, os.WriteFile(filepath.Join(parserDir, name), []byte(game), 0o644))
+	}
+	broken := filepath.Join(parserDir, "game_2.json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	replay := func() error {
+		t.Helper()
+		app, err := apps.NewApp(configs.NewConfig(
+			configs.WithParserDir(parserDir),
+			configs.WithSink(configs.SinkSQLite),
+			configs.WithDatabaseDSN("sqlite://"+path),
+			configs.WithAutoMigrate(true),
+			configs.WithReplayState(statePath),
+			configs.WithFrom(from),
+			configs.WithTo(to),
+			configs.WithParseWorkers(1),
+			configs.WithFlattenWorkers(1),
+			configs.WithSaveWorkers(1),
+		))
+		require.NoError(t, err)
+		return app.Replay(ctx)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	gameIDs := func() []int64 {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, "SELECT DISTINCT game_id FROM games ORDER BY game_id")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			require.NoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+		require.NoError(t, rows.Err())
+		return ids
+	}
+
+	// The replay reads past the broken file and finishes, failing with it.
+	assert.EqualError(t, replay(), "invalid game files: "+broken)
+	assert.Equal(t, []int64{101, 103}, gameIDs())
+	_, err = os.Stat(statePath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// A resumed replay does not read the files its state records again.
+	state := fmt.Sprintf(`{"from":%q,"to":%q,"version":%d,"skipped_files":[%q],"invalid_files":[%q]}`,
+		from.Format(time.RFC3339), to.Format(time.RFC3339), time.Now().UnixMilli(),
+		filepath.Join(parserDir, "game_4.json"), broken)
+	require.NoError(t, os.WriteFile(statePath, []byte(state), 0o644))
+	_, err = db.ExecContext(ctx, "DELETE FROM games WHERE game_id = 103")
+	require.NoError(t, err)
+
+	assert.EqualError(t, replay(), "invalid game files: "+broken)
+	assert.Equal(t, []int64{101}, gameIDs())
+}
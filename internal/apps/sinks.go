@@ -0,0 +1,202 @@
+package apps
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sbilibin2017/cs2/internal/configs"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+)
+
+// sink is one destination rows are fanned out to, with its own batching,
+// retries and error policy.
+type sink struct {
+	config configs.SinkConfig
+
+	db       clickhouse.Conn
+	pgPool   *pgxpool.Pool
+	sqliteDB *sql.DB
+
+	gameSaverRepository      *repositories.GameSaverRepository
+	gameFileSaverRepository  *repositories.GameFileSaverRepository
+	deadLetterRepository     *repositories.GameFileSaverRepository
+	gameRetrySaverRepository *repositories.GameRetrySaverRepository
+	gameBatchSaverRepository *repositories.GameBatchSaverRepository
+	circuitBreaker           *repositories.CircuitBreaker
+}
+
+// openSink connects to the sink's database and builds its saver chain:
+// batch, error policy, retry, then the sink itself. Only the primary sink
+// reports to the batch metrics, which predate fan-out.
+func (app *App) openSink(cfg configs.SinkConfig, primary bool) (*sink, error) {
+	s := &sink{config: cfg}
+
+	var saver repositories.GameSaver
+	switch cfg.Type {
+	case repositories.FileFormatJSONL, repositories.FileFormatCSV, repositories.FileFormatParquet:
+		s.gameFileSaverRepository = repositories.NewGameFileSaverRepository(
+			repositories.WithFileDir(cfg.Dir),
+			repositories.WithFileFormat(cfg.Type),
+			repositories.WithFileCompression(cfg.Compression),
+			repositories.WithFileMaxBytes(int64(cfg.MaxBytes)),
+			repositories.WithFileMaxAge(cfg.MaxAge),
+		)
+		saver = s.gameFileSaverRepository
+	case configs.SinkPostgres:
+		pool, err := openPostgres(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		s.pgPool = pool
+		saver = repositories.NewGamePostgresSaverRepository(
+			repositories.WithPostgresPool(s.pgPool),
+		)
+	case configs.SinkSQLite:
+		db, err := openSQLite(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		s.sqliteDB = db
+		saver = repositories.NewGameSQLiteSaverRepository(
+			repositories.WithSQLiteDB(s.sqliteDB),
+		)
+	default:
+		db, err := openClickhouse(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		s.db = db
+		s.gameSaverRepository = repositories.NewGameSaverRepository(
+			repositories.WithDB(s.db),
+		)
+		saver = s.gameSaverRepository
+	}
+
+	retryOpts := []repositories.GameRetrySaverOption{
+		repositories.WithRetrySaver(saver),
+		repositories.WithRetryMaxAttempts(cfg.RetryMaxAttempts),
+		repositories.WithRetryInitialBackoff(app.config.RetryInitialBackoff),
+		repositories.WithRetryMaxBackoff(app.config.RetryMaxBackoff),
+		repositories.WithRetryObserver(app.metrics),
+	}
+	if app.config.BreakerThreshold > 0 {
+		s.circuitBreaker = repositories.NewCircuitBreaker(
+			repositories.WithBreakerThreshold(app.config.BreakerThreshold),
+			repositories.WithBreakerCooldown(app.config.BreakerCooldown),
+		)
+		retryOpts = append(retryOpts, repositories.WithRetryCircuitBreaker(s.circuitBreaker))
+	}
+	s.gameRetrySaverRepository = repositories.NewGameRetrySaverRepository(retryOpts...)
+
+	sinkOpts := []repositories.GameSinkSaverOption{
+		repositories.WithSinkName(cfg.Name),
+		repositories.WithSinkSaver(s.gameRetrySaverRepository),
+		repositories.WithSinkPolicy(cmp.Or(cfg.OnError, repositories.SinkPolicyFail)),
+		repositories.WithSinkObserver(app.metrics),
+	}
+	if cfg.OnError == repositories.SinkPolicyDeadLetter {
+		s.deadLetterRepository = repositories.NewGameFileSaverRepository(
+			repositories.WithFileDir(filepath.Join(app.config.DeadLetterDir, cfg.Name)),
+			repositories.WithFileFormat(repositories.FileFormatJSONL),
+		)
+		sinkOpts = append(sinkOpts, repositories.WithSinkDeadLetter(s.deadLetterRepository))
+	}
+
+	batchOpts := []repositories.GameBatchSaverOption{
+		repositories.WithBatchSaver(repositories.NewGameSinkSaverRepository(sinkOpts...)),
+		repositories.WithBatchMaxRows(cfg.BatchMaxRows),
+		repositories.WithBatchMaxBytes(cfg.BatchMaxBytes),
+		repositories.WithBatchFlushInterval(cfg.BatchFlushInterval),
+	}
+	if primary {
+		batchOpts = append(batchOpts, repositories.WithBatchObserver(app.metrics))
+	}
+	s.gameBatchSaverRepository = repositories.NewGameBatchSaverRepository(batchOpts...)
+
+	return s, nil
+}
+
+// clickhouseSink returns the first ClickHouse sink, or nil.
+func (app *App) clickhouseSink() *sink {
+	for _, s := range app.sinks {
+		if s.config.Type == configs.SinkClickhouse {
+			return s
+		}
+	}
+	return nil
+}
+
+// hasSchema reports whether the sink writes to a database table.
+func (s *sink) hasSchema() bool {
+	return !slices.Contains(configs.FileSinks, s.config.Type)
+}
+
+func (s *sink) ping(ctx context.Context) error {
+	switch {
+	case s.db != nil:
+		return s.db.Ping(ctx)
+	case s.pgPool != nil:
+		return s.pgPool.Ping(ctx)
+	case s.sqliteDB != nil:
+		return s.sqliteDB.PingContext(ctx)
+	}
+	return errors.New("connection closed")
+}
+
+// flush writes out the buffered rows and completes the open files.
+func (s *sink) flush(ctx context.Context) error {
+	errs := []error{s.gameBatchSaverRepository.Close(ctx)}
+	if s.gameFileSaverRepository != nil {
+		errs = append(errs, s.gameFileSaverRepository.Close(ctx))
+	}
+	if s.deadLetterRepository != nil {
+		errs = append(errs, s.deadLetterRepository.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// finalFlushContext returns a context that is not cancelled with ctx, but
+// expires the grace period after it.
+func finalFlushContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	flushCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-flushCtx.Done():
+		case <-timer.C:
+			logging.FromContext(ctx).Warn("grace period expired, abandoning the final flush", "grace_period", grace)
+			cancel()
+		}
+	})
+
+	return flushCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (s *sink) close(ctx context.Context) error {
+	errs := []error{s.flush(ctx)}
+	if s.db != nil {
+		errs = append(errs, s.db.Close())
+		s.db = nil
+	}
+	if s.pgPool != nil {
+		s.pgPool.Close()
+		s.pgPool = nil
+	}
+	if s.sqliteDB != nil {
+		errs = append(errs, s.sqliteDB.Close())
+		s.sqliteDB = nil
+	}
+	return errors.Join(errs...)
+}
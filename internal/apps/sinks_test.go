@@ -0,0 +1,26 @@
+package apps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinalFlushContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	flushCtx, cancelFlush := finalFlushContext(ctx, 20*time.Millisecond)
+	defer cancelFlush()
+
+	// Without a signal the flush takes as long as it needs.
+	select {
+	case <-flushCtx.Done():
+		t.Fatal("final flush context done before shutdown")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	cancel()
+	assert.NoError(t, flushCtx.Err())
+	assert.Eventually(t, func() bool { return flushCtx.Err() != nil }, time.Second, time.Millisecond)
+}
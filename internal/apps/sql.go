@@ -0,0 +1,85 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// checkPostgresDSN rejects DSNs meant for another sink, which pgx would
+// otherwise report as a parse error.
+func checkPostgresDSN(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return fmt.Errorf("invalid DSN: %w", err)
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	return nil
+}
+
+func openPostgres(dsn string) (*pgxpool.Pool, error) {
+	if err := checkPostgresDSN(dsn); err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres connection: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("postgres is unreachable at %s: %w", pool.Config().ConnConfig.Host, err)
+	}
+
+	return pool, nil
+}
+
+// sqlitePath turns sqlite://<path>[?param=value] into the driver's
+// <path>[?param=value].
+func sqlitePath(dsn string) (string, error) {
+	path, ok := strings.CutPrefix(dsn, "sqlite://")
+	if !ok {
+		scheme, _, _ := strings.Cut(dsn, "://")
+		return "", fmt.Errorf("unsupported scheme: %s", scheme)
+	}
+	if path == "" {
+		return "", errors.New("invalid DSN: missing sqlite file path")
+	}
+	return path, nil
+}
+
+// openSQLite opens the database with a single connection, as SQLite allows
+// one writer at a time.
+func openSQLite(dsn string) (*sql.DB, error) {
+	path, err := sqlitePath(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+
+	return db, nil
+}
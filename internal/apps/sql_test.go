@@ -0,0 +1,38 @@
+package apps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLitePath(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		expected string
+		err      string
+	}{
+		{dsn: "sqlite://./data/games.db", expected: "./data/games.db"},
+		{dsn: "sqlite:///var/lib/cs2/games.db?_pragma=busy_timeout(5000)", expected: "/var/lib/cs2/games.db?_pragma=busy_timeout(5000)"},
+		{dsn: "sqlite://", err: "invalid DSN: missing sqlite file path"},
+		{dsn: "clickhouse://default@localhost:9000/default", err: "unsupported scheme: clickhouse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			path, err := sqlitePath(tt.dsn)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, path)
+		})
+	}
+}
+
+func TestCheckPostgresDSN(t *testing.T) {
+	assert.NoError(t, checkPostgresDSN("postgres://cs2@localhost:5432/cs2"))
+	assert.NoError(t, checkPostgresDSN("postgresql://cs2@localhost/cs2?sslmode=disable"))
+	assert.EqualError(t, checkPostgresDSN("clickhouse://default@localhost:9000/default"), "unsupported scheme: clickhouse")
+}
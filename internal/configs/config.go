@@ -1,9 +1,65 @@
 package configs
 
+import "time"
+
 type Config struct {
-	ParserDir   string
-	DatabaseDSN string
-	LogLevel    string
+	ConfigFile string `yaml:"-" toml:"-"`
+
+	ParserDir    string `yaml:"parser_dir" toml:"parser_dir"`
+	StrictDecode bool   `yaml:"strict_decode" toml:"strict_decode"`
+	DatabaseDSN  string `yaml:"database_dsn" toml:"database_dsn" secret:"true"`
+	LogLevel     string `yaml:"log_level" toml:"log_level"`
+	LogFormat    string `yaml:"log_format" toml:"log_format"`
+	AutoMigrate  bool   `yaml:"auto_migrate" toml:"auto_migrate"`
+	HTTPAddr     string `yaml:"http_addr" toml:"http_addr"`
+
+	Mode         string        `yaml:"mode" toml:"mode"`
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+
+	TraceExporter    string  `yaml:"trace_exporter" toml:"trace_exporter"`
+	TraceEndpoint    string  `yaml:"trace_endpoint" toml:"trace_endpoint"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio" toml:"trace_sample_ratio"`
+
+	ParseWorkers   int  `yaml:"parse_workers" toml:"parse_workers"`
+	FlattenWorkers int  `yaml:"flatten_workers" toml:"flatten_workers"`
+	SaveWorkers    int  `yaml:"save_workers" toml:"save_workers"`
+	Ordered        bool `yaml:"ordered" toml:"ordered"`
+	OrderWindow    int  `yaml:"order_window" toml:"order_window"`
+
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period" toml:"shutdown_grace_period"`
+
+	Sink            string        `yaml:"sink" toml:"sink"`
+	SinkDir         string        `yaml:"sink_dir" toml:"sink_dir"`
+	SinkCompression string        `yaml:"sink_compression" toml:"sink_compression"`
+	SinkMaxBytes    int           `yaml:"sink_max_bytes" toml:"sink_max_bytes"`
+	SinkMaxAge      time.Duration `yaml:"sink_max_age" toml:"sink_max_age"`
+	SinkOnError     string        `yaml:"sink_on_error" toml:"sink_on_error"`
+	DeadLetterDir   string        `yaml:"dead_letter_dir" toml:"dead_letter_dir"`
+	Sinks           []SinkConfig  `yaml:"sinks,omitempty" toml:"sinks,omitempty"`
+
+	StoreRaw    bool `yaml:"store_raw" toml:"store_raw"`
+	RoundEvents bool `yaml:"round_events" toml:"round_events"`
+
+	DLQ    string `yaml:"dlq" toml:"dlq"`
+	DLQDir string `yaml:"dlq_dir" toml:"dlq_dir"`
+
+	ReplayState string `yaml:"replay_state" toml:"replay_state"`
+
+	BatchMaxRows       int           `yaml:"batch_max_rows" toml:"batch_max_rows"`
+	BatchMaxBytes      int           `yaml:"batch_max_bytes" toml:"batch_max_bytes"`
+	BatchFlushInterval time.Duration `yaml:"batch_flush_interval" toml:"batch_flush_interval"`
+
+	RetryMaxAttempts    int           `yaml:"retry_max_attempts" toml:"retry_max_attempts"`
+	RetryInitialBackoff time.Duration `yaml:"retry_initial_backoff" toml:"retry_initial_backoff"`
+	RetryMaxBackoff     time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+	BreakerThreshold    int           `yaml:"breaker_threshold" toml:"breaker_threshold"`
+	BreakerCooldown     time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown"`
+
+	DryRun     bool      `yaml:"-" toml:"-"`
+	ExportPath string    `yaml:"-" toml:"-"`
+	From       time.Time `yaml:"-" toml:"-"`
+	To         time.Time `yaml:"-" toml:"-"`
+	GameIDs    []int64   `yaml:"-" toml:"-"`
 }
 
 type Opt func(*Config)
@@ -16,12 +72,25 @@ func NewConfig(opts ...Opt) *Config {
 	return cfg
 }
 
+func WithConfigFile(path string) Opt {
+	return func(c *Config) {
+		c.ConfigFile = path
+	}
+}
+
 func WithParserDir(dir string) Opt {
 	return func(c *Config) {
 		c.ParserDir = dir
 	}
 }
 
+// WithStrictDecode rejects the game files with fields that are not decoded.
+func WithStrictDecode(strict bool) Opt {
+	return func(c *Config) {
+		c.StrictDecode = strict
+	}
+}
+
 func WithDatabaseDSN(dsn string) Opt {
 	return func(c *Config) {
 		c.DatabaseDSN = dsn
@@ -33,3 +102,257 @@ func WithLogLevel(level string) Opt {
 		c.LogLevel = level
 	}
 }
+
+func WithLogFormat(format string) Opt {
+	return func(c *Config) {
+		c.LogFormat = format
+	}
+}
+
+func WithHTTPAddr(addr string) Opt {
+	return func(c *Config) {
+		c.HTTPAddr = addr
+	}
+}
+
+func WithMode(mode string) Opt {
+	return func(c *Config) {
+		c.Mode = mode
+	}
+}
+
+func WithPollInterval(interval time.Duration) Opt {
+	return func(c *Config) {
+		c.PollInterval = interval
+	}
+}
+
+func WithTraceExporter(exporter string) Opt {
+	return func(c *Config) {
+		c.TraceExporter = exporter
+	}
+}
+
+func WithTraceEndpoint(endpoint string) Opt {
+	return func(c *Config) {
+		c.TraceEndpoint = endpoint
+	}
+}
+
+func WithTraceSampleRatio(ratio float64) Opt {
+	return func(c *Config) {
+		c.TraceSampleRatio = ratio
+	}
+}
+
+func WithAutoMigrate(autoMigrate bool) Opt {
+	return func(c *Config) {
+		c.AutoMigrate = autoMigrate
+	}
+}
+
+func WithParseWorkers(n int) Opt {
+	return func(c *Config) {
+		c.ParseWorkers = n
+	}
+}
+
+func WithFlattenWorkers(n int) Opt {
+	return func(c *Config) {
+		c.FlattenWorkers = n
+	}
+}
+
+func WithSaveWorkers(n int) Opt {
+	return func(c *Config) {
+		c.SaveWorkers = n
+	}
+}
+
+func WithOrdered(ordered bool) Opt {
+	return func(c *Config) {
+		c.Ordered = ordered
+	}
+}
+
+func WithOrderWindow(window int) Opt {
+	return func(c *Config) {
+		c.OrderWindow = window
+	}
+}
+
+func WithShutdownGracePeriod(d time.Duration) Opt {
+	return func(c *Config) {
+		c.ShutdownGracePeriod = d
+	}
+}
+
+func WithDryRun(dryRun bool) Opt {
+	return func(c *Config) {
+		c.DryRun = dryRun
+	}
+}
+
+func WithSink(sink string) Opt {
+	return func(c *Config) {
+		c.Sink = sink
+	}
+}
+
+func WithSinkDir(dir string) Opt {
+	return func(c *Config) {
+		c.SinkDir = dir
+	}
+}
+
+func WithSinkCompression(compression string) Opt {
+	return func(c *Config) {
+		c.SinkCompression = compression
+	}
+}
+
+func WithSinkMaxBytes(n int) Opt {
+	return func(c *Config) {
+		c.SinkMaxBytes = n
+	}
+}
+
+func WithSinkMaxAge(d time.Duration) Opt {
+	return func(c *Config) {
+		c.SinkMaxAge = d
+	}
+}
+
+func WithSinkOnError(policy string) Opt {
+	return func(c *Config) {
+		c.SinkOnError = policy
+	}
+}
+
+func WithDeadLetterDir(dir string) Opt {
+	return func(c *Config) {
+		c.DeadLetterDir = dir
+	}
+}
+
+func WithSinks(sinks ...SinkConfig) Opt {
+	return func(c *Config) {
+		c.Sinks = sinks
+	}
+}
+
+// WithStoreRaw keeps every source game in the games_raw table of the
+// ClickHouse sink, if any.
+func WithStoreRaw(storeRaw bool) Opt {
+	return func(c *Config) {
+		c.StoreRaw = storeRaw
+	}
+}
+
+// WithRoundEvents saves the kill feed, clutches, economy and bomb plants of
+// every round in the round_events table of the ClickHouse sink, if any.
+func WithRoundEvents(roundEvents bool) Opt {
+	return func(c *Config) {
+		c.RoundEvents = roundEvents
+	}
+}
+
+func WithDLQ(store string) Opt {
+	return func(c *Config) {
+		c.DLQ = store
+	}
+}
+
+func WithDLQDir(dir string) Opt {
+	return func(c *Config) {
+		c.DLQDir = dir
+	}
+}
+
+func WithReplayState(path string) Opt {
+	return func(c *Config) {
+		c.ReplayState = path
+	}
+}
+
+func WithBatchMaxRows(rows int) Opt {
+	return func(c *Config) {
+		c.BatchMaxRows = rows
+	}
+}
+
+func WithBatchMaxBytes(bytes int) Opt {
+	return func(c *Config) {
+		c.BatchMaxBytes = bytes
+	}
+}
+
+func WithBatchFlushInterval(interval time.Duration) Opt {
+	return func(c *Config) {
+		c.BatchFlushInterval = interval
+	}
+}
+
+func WithRetryMaxAttempts(attempts int) Opt {
+	return func(c *Config) {
+		c.RetryMaxAttempts = attempts
+	}
+}
+
+func WithRetryInitialBackoff(backoff time.Duration) Opt {
+	return func(c *Config) {
+		c.RetryInitialBackoff = backoff
+	}
+}
+
+func WithRetryMaxBackoff(backoff time.Duration) Opt {
+	return func(c *Config) {
+		c.RetryMaxBackoff = backoff
+	}
+}
+
+func WithBreakerThreshold(failures int) Opt {
+	return func(c *Config) {
+		c.BreakerThreshold = failures
+	}
+}
+
+func WithBreakerCooldown(cooldown time.Duration) Opt {
+	return func(c *Config) {
+		c.BreakerCooldown = cooldown
+	}
+}
+
+func WithExportPath(path string) Opt {
+	return func(c *Config) {
+		c.ExportPath = path
+	}
+}
+
+func WithFrom(from time.Time) Opt {
+	return func(c *Config) {
+		c.From = from
+	}
+}
+
+func WithTo(to time.Time) Opt {
+	return func(c *Config) {
+		c.To = to
+	}
+}
+
+// Until is the end of the range selected by From and To. To is the last day
+// included, so the range ends at the start of the next day; without To it
+// is zero.
+func (c *Config) Until() time.Time {
+	if c.To.IsZero() {
+		return time.Time{}
+	}
+	return c.To.AddDate(0, 0, 1)
+}
+
+func WithGameIDs(ids ...int64) Opt {
+	return func(c *Config) {
+		c.GameIDs = ids
+	}
+}
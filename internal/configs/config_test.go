@@ -2,6 +2,7 @@ package configs
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -44,6 +45,208 @@ func TestNewConfig(t *testing.T) {
 				LogLevel: "debug",
 			},
 		},
+		{
+			name: "With LogFormat",
+			options: []Opt{
+				WithLogFormat("json"),
+			},
+			expected: &Config{
+				LogFormat: "json",
+			},
+		},
+		{
+			name: "With HTTPAddr",
+			options: []Opt{
+				WithHTTPAddr(":9090"),
+			},
+			expected: &Config{
+				HTTPAddr: ":9090",
+			},
+		},
+		{
+			name: "With Mode",
+			options: []Opt{
+				WithMode("once"),
+				WithPollInterval(time.Minute),
+			},
+			expected: &Config{
+				Mode:         "once",
+				PollInterval: time.Minute,
+			},
+		},
+		{
+			name: "With Tracing",
+			options: []Opt{
+				WithTraceExporter("otlp-grpc"),
+				WithTraceEndpoint("http://collector:4317"),
+				WithTraceSampleRatio(0.25),
+			},
+			expected: &Config{
+				TraceExporter:    "otlp-grpc",
+				TraceEndpoint:    "http://collector:4317",
+				TraceSampleRatio: 0.25,
+			},
+		},
+		{
+			name: "With AutoMigrate",
+			options: []Opt{
+				WithAutoMigrate(true),
+			},
+			expected: &Config{
+				AutoMigrate: true,
+			},
+		},
+		{
+			name: "With Workers",
+			options: []Opt{
+				WithParseWorkers(4),
+				WithFlattenWorkers(2),
+				WithSaveWorkers(3),
+			},
+			expected: &Config{
+				ParseWorkers:   4,
+				FlattenWorkers: 2,
+				SaveWorkers:    3,
+			},
+		},
+		{
+			name: "With Ordered",
+			options: []Opt{
+				WithOrdered(true),
+				WithOrderWindow(500),
+			},
+			expected: &Config{
+				Ordered:     true,
+				OrderWindow: 500,
+			},
+		},
+		{
+			name: "With ShutdownGracePeriod",
+			options: []Opt{
+				WithShutdownGracePeriod(time.Minute),
+			},
+			expected: &Config{
+				ShutdownGracePeriod: time.Minute,
+			},
+		},
+		{
+			name: "With Batching",
+			options: []Opt{
+				WithBatchMaxRows(1000),
+				WithBatchMaxBytes(1 << 20),
+				WithBatchFlushInterval(time.Second),
+			},
+			expected: &Config{
+				BatchMaxRows:       1000,
+				BatchMaxBytes:      1 << 20,
+				BatchFlushInterval: time.Second,
+			},
+		},
+		{
+			name: "With Retry",
+			options: []Opt{
+				WithRetryMaxAttempts(3),
+				WithRetryInitialBackoff(time.Millisecond),
+				WithRetryMaxBackoff(time.Second),
+				WithBreakerThreshold(4),
+				WithBreakerCooldown(time.Minute),
+			},
+			expected: &Config{
+				RetryMaxAttempts:    3,
+				RetryInitialBackoff: time.Millisecond,
+				RetryMaxBackoff:     time.Second,
+				BreakerThreshold:    4,
+				BreakerCooldown:     time.Minute,
+			},
+		},
+		{
+			name: "With ConfigFile",
+			options: []Opt{
+				WithConfigFile("/etc/cs2.yaml"),
+			},
+			expected: &Config{
+				ConfigFile: "/etc/cs2.yaml",
+			},
+		},
+		{
+			name: "With Sink",
+			options: []Opt{
+				WithSink("parquet"),
+				WithSinkDir("/out"),
+				WithSinkCompression("zstd"),
+				WithSinkMaxBytes(1 << 20),
+				WithSinkMaxAge(time.Hour),
+			},
+			expected: &Config{
+				Sink:            "parquet",
+				SinkDir:         "/out",
+				SinkCompression: "zstd",
+				SinkMaxBytes:    1 << 20,
+				SinkMaxAge:      time.Hour,
+			},
+		},
+		{
+			name: "With fan out",
+			options: []Opt{
+				WithSinkOnError("dead-letter"),
+				WithDeadLetterDir("/dead"),
+				WithSinks(SinkConfig{Type: "clickhouse"}, SinkConfig{Type: "parquet"}),
+			},
+			expected: &Config{
+				SinkOnError:   "dead-letter",
+				DeadLetterDir: "/dead",
+				Sinks:         []SinkConfig{{Type: "clickhouse"}, {Type: "parquet"}},
+			},
+		},
+		{
+			name: "With StrictDecode",
+			options: []Opt{
+				WithStrictDecode(true),
+			},
+			expected: &Config{
+				StrictDecode: true,
+			},
+		},
+		{
+			name: "With StoreRaw",
+			options: []Opt{
+				WithStoreRaw(true),
+			},
+			expected: &Config{
+				StoreRaw: true,
+			},
+		},
+		{
+			name: "With RoundEvents",
+			options: []Opt{
+				WithRoundEvents(true),
+			},
+			expected: &Config{
+				RoundEvents: true,
+			},
+		},
+		{
+			name: "With DryRun",
+			options: []Opt{
+				WithDryRun(true),
+			},
+			expected: &Config{
+				DryRun: true,
+			},
+		},
+		{
+			name: "With Export",
+			options: []Opt{
+				WithExportPath("games.jsonl"),
+				WithFrom(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+				WithTo(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)),
+			},
+			expected: &Config{
+				ExportPath: "games.jsonl",
+				From:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:         time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
 		{
 			name: "With All Options",
 			options: []Opt{
@@ -66,3 +269,10 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Until(t *testing.T) {
+	assert.True(t, NewConfig().Until().IsZero())
+
+	cfg := NewConfig(WithTo(time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), cfg.Until())
+}
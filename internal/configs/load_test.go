@@ -0,0 +1,185 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfig_LoadFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected *Config
+	}{
+		{
+			name: "YAML",
+			file: "cs2.yaml",
+			content: `
+parser_dir: /data
+database_dsn: clickhouse://localhost:9000/db
+save_workers: 3
+ordered: true
+batch_flush_interval: 10s
+`,
+			expected: &Config{
+				ParserDir:          "/data",
+				DatabaseDSN:        "clickhouse://localhost:9000/db",
+				LogLevel:           "info",
+				SaveWorkers:        3,
+				Ordered:            true,
+				BatchFlushInterval: 10 * time.Second,
+			},
+		},
+		{
+			name: "TOML",
+			file: "cs2.toml",
+			content: `
+parser_dir = "/data"
+log_level = "debug"
+retry_max_attempts = 7
+breaker_cooldown = "1m"
+`,
+			expected: &Config{
+				ParserDir:        "/data",
+				LogLevel:         "debug",
+				RetryMaxAttempts: 7,
+				BreakerCooldown:  time.Minute,
+			},
+		},
+		{
+			name: "YAML sinks",
+			file: "cs2.yaml",
+			content: `
+sinks:
+  - type: clickhouse
+  - name: archive
+    type: parquet
+    dir: /archive
+    max_age: 24h
+    on_error: dead-letter
+`,
+			expected: &Config{
+				LogLevel: "info",
+				Sinks: []SinkConfig{
+					{Type: "clickhouse"},
+					{Name: "archive", Type: "parquet", Dir: "/archive", MaxAge: 24 * time.Hour, OnError: "dead-letter"},
+				},
+			},
+		},
+		{
+			name: "TOML sinks",
+			file: "cs2.toml",
+			content: `
+[[sinks]]
+type = "clickhouse"
+
+[[sinks]]
+type = "jsonl"
+on_error = "skip"
+`,
+			expected: &Config{
+				LogLevel: "info",
+				Sinks:    []SinkConfig{{Type: "clickhouse"}, {Type: "jsonl", OnError: "skip"}},
+			},
+		},
+		{
+			name:     "Empty YAML keeps current values",
+			file:     "cs2.yml",
+			content:  "",
+			expected: &Config{LogLevel: "info"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig(WithLogLevel("info"))
+			require.NoError(t, cfg.LoadFile(writeFile(t, tt.file, tt.content)))
+			assert.Equal(t, tt.expected, cfg)
+		})
+	}
+}
+
+func TestConfig_LoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		errMsg  string
+	}{
+		{name: "Unknown YAML key", file: "cs2.yaml", content: "parse_wrokers: 2\n", errMsg: "field parse_wrokers not found"},
+		{name: "Unknown TOML key", file: "cs2.toml", content: "parse_wrokers = 2\n", errMsg: "unknown keys [parse_wrokers]"},
+		{name: "Invalid duration", file: "cs2.toml", content: "breaker_cooldown = \"soon\"\n", errMsg: "invalid config file"},
+		{name: "Unsupported format", file: "cs2.json", content: "{}", errMsg: "unsupported config file format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewConfig().LoadFile(writeFile(t, tt.file, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+
+	err := NewConfig().LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestConfig_LoadEnv(t *testing.T) {
+	env := map[string]string{
+		"CS2_DATABASE_DSN":          "clickhouse://env:9000/db",
+		"CS2_PARSE_WORKERS":         "6",
+		"CS2_AUTO_MIGRATE":          "true",
+		"CS2_RETRY_INITIAL_BACKOFF": "1s",
+		"CS2_EXPORT_PATH":           "ignored.jsonl",
+		"CS2_TRACE_SAMPLE_RATIO":    "0.5",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	cfg := NewConfig(WithDatabaseDSN("file-dsn"), WithLogLevel("info"))
+	require.NoError(t, cfg.LoadEnv(lookup))
+
+	assert.Equal(t, &Config{
+		DatabaseDSN:         "clickhouse://env:9000/db",
+		LogLevel:            "info",
+		AutoMigrate:         true,
+		ParseWorkers:        6,
+		RetryInitialBackoff: time.Second,
+		TraceSampleRatio:    0.5,
+	}, cfg)
+}
+
+func TestConfig_LoadEnv_InvalidValues(t *testing.T) {
+	env := map[string]string{
+		"CS2_PARSE_WORKERS":      "many",
+		"CS2_ORDERED":            "sometimes",
+		"CS2_BREAKER_COOLDOWN":   "later",
+		"CS2_TRACE_SAMPLE_RATIO": "most",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	err := NewConfig().LoadEnv(lookup)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `CS2_PARSE_WORKERS: invalid integer "many"`)
+	assert.Contains(t, err.Error(), `CS2_ORDERED: invalid boolean "sometimes"`)
+	assert.Contains(t, err.Error(), `CS2_BREAKER_COOLDOWN: invalid duration "later"`)
+	assert.Contains(t, err.Error(), `CS2_TRACE_SAMPLE_RATIO: invalid number "most"`)
+}
@@ -0,0 +1,88 @@
+package configs
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "xxxxx"
+
+// Redacted returns a copy of c with the secrets in fields tagged secret
+// masked, including those of the sinks.
+func (c *Config) Redacted() *Config {
+	cp := *c
+	redactFields(reflect.ValueOf(&cp).Elem())
+
+	cp.Sinks = slices.Clone(c.Sinks)
+	for i := range cp.Sinks {
+		redactFields(reflect.ValueOf(&cp.Sinks[i]).Elem())
+	}
+
+	return &cp
+}
+
+func redactFields(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("secret") == "true" {
+			v.Field(i).SetString(redactDSN(v.Field(i).String()))
+		}
+	}
+}
+
+// Print writes the redacted configuration as YAML, in the format LoadFile
+// accepts.
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// secretParams are the DSN query parameters whose values are secrets.
+var secretParams = []string{"password", "secret"}
+
+func redactDSN(dsn string) string {
+	base, query, hasQuery := strings.Cut(dsn, "?")
+	if hasQuery {
+		return redactUserinfo(base) + "?" + redactQuery(query)
+	}
+	return redactUserinfo(dsn)
+}
+
+func redactUserinfo(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+		return dsn
+	}
+
+	if at := strings.LastIndex(dsn, "@"); at >= 0 {
+		user, _, hasPassword := strings.Cut(dsn[:at], ":")
+		if hasPassword {
+			return user + ":" + redacted + dsn[at:]
+		}
+	}
+
+	return dsn
+}
+
+// redactQuery masks the values of the secretParams of a DSN query, matching
+// their keys case-insensitively.
+func redactQuery(query string) string {
+	params := strings.Split(query, "&")
+	for i, p := range params {
+		key, _, ok := strings.Cut(p, "=")
+		if ok && slices.Contains(secretParams, strings.ToLower(key)) {
+			params[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,77 @@
+package configs
+
+import (
+	"cmp"
+	"time"
+)
+
+// SinkConfig is one of the sinks rows are fanned out to, set in the sinks
+// list of the config file. Unset fields fall back to the top-level sink,
+// batch and retry settings.
+type SinkConfig struct {
+	Name        string        `yaml:"name,omitempty" toml:"name,omitempty"`
+	Type        string        `yaml:"type" toml:"type"`
+	DSN         string        `yaml:"dsn,omitempty" toml:"dsn,omitempty" secret:"true"`
+	Dir         string        `yaml:"dir,omitempty" toml:"dir,omitempty"`
+	Compression string        `yaml:"compression,omitempty" toml:"compression,omitempty"`
+	MaxBytes    int           `yaml:"max_bytes,omitempty" toml:"max_bytes,omitempty"`
+	MaxAge      time.Duration `yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+	OnError     string        `yaml:"on_error,omitempty" toml:"on_error,omitempty"`
+
+	BatchMaxRows       int           `yaml:"batch_max_rows,omitempty" toml:"batch_max_rows,omitempty"`
+	BatchMaxBytes      int           `yaml:"batch_max_bytes,omitempty" toml:"batch_max_bytes,omitempty"`
+	BatchFlushInterval time.Duration `yaml:"batch_flush_interval,omitempty" toml:"batch_flush_interval,omitempty"`
+	RetryMaxAttempts   int           `yaml:"retry_max_attempts,omitempty" toml:"retry_max_attempts,omitempty"`
+}
+
+// SinkConfigs returns the sinks with the fallbacks applied. Without a sinks
+// list it is the single sink set by the top-level settings, ClickHouse if
+// unset.
+func (c *Config) SinkConfigs() []SinkConfig {
+	if len(c.Sinks) == 0 {
+		return []SinkConfig{c.resolveSink(SinkConfig{Type: cmp.Or(c.Sink, SinkClickhouse)})}
+	}
+
+	sinks := make([]SinkConfig, len(c.Sinks))
+	for i, s := range c.Sinks {
+		sinks[i] = c.resolveSink(s)
+	}
+	return sinks
+}
+
+func (c *Config) resolveSink(s SinkConfig) SinkConfig {
+	if s.Name == "" {
+		s.Name = s.Type
+	}
+	if s.DSN == "" {
+		s.DSN = c.DatabaseDSN
+	}
+	if s.Dir == "" {
+		s.Dir = c.SinkDir
+	}
+	if s.Compression == "" {
+		s.Compression = c.SinkCompression
+	}
+	if s.MaxBytes == 0 {
+		s.MaxBytes = c.SinkMaxBytes
+	}
+	if s.MaxAge == 0 {
+		s.MaxAge = c.SinkMaxAge
+	}
+	if s.OnError == "" {
+		s.OnError = c.SinkOnError
+	}
+	if s.BatchMaxRows == 0 {
+		s.BatchMaxRows = c.BatchMaxRows
+	}
+	if s.BatchMaxBytes == 0 {
+		s.BatchMaxBytes = c.BatchMaxBytes
+	}
+	if s.BatchFlushInterval == 0 {
+		s.BatchFlushInterval = c.BatchFlushInterval
+	}
+	if s.RetryMaxAttempts == 0 {
+		s.RetryMaxAttempts = c.RetryMaxAttempts
+	}
+	return s
+}
@@ -0,0 +1,57 @@
+package configs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_SinkConfigs(t *testing.T) {
+	cfg := NewConfig(
+		WithDatabaseDSN("clickhouse://localhost:9000/default"),
+		WithSink("clickhouse"),
+		WithSinkDir("/out"),
+		WithSinkCompression("none"),
+		WithSinkOnError("fail"),
+		WithBatchMaxRows(1000),
+		WithBatchFlushInterval(5*time.Second),
+		WithRetryMaxAttempts(5),
+	)
+
+	fallback := SinkConfig{
+		Type:               "clickhouse",
+		DSN:                "clickhouse://localhost:9000/default",
+		Dir:                "/out",
+		Compression:        "none",
+		OnError:            "fail",
+		BatchMaxRows:       1000,
+		BatchFlushInterval: 5 * time.Second,
+		RetryMaxAttempts:   5,
+	}
+
+	t.Run("Top-level sink", func(t *testing.T) {
+		expected := fallback
+		expected.Name = "clickhouse"
+		assert.Equal(t, []SinkConfig{expected}, cfg.SinkConfigs())
+	})
+
+	t.Run("Sinks list", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Sinks = []SinkConfig{
+			{Type: "clickhouse"},
+			{Name: "archive", Type: "parquet", Compression: "zstd", OnError: "skip", BatchMaxRows: 50000},
+		}
+
+		clickhouse := fallback
+		clickhouse.Name = "clickhouse"
+		archive := fallback
+		archive.Name = "archive"
+		archive.Type = "parquet"
+		archive.Compression = "zstd"
+		archive.OnError = "skip"
+		archive.BatchMaxRows = 50000
+
+		assert.Equal(t, []SinkConfig{clickhouse, archive}, cfg.SinkConfigs())
+	})
+}
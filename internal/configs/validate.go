@@ -0,0 +1,114 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+)
+
+const (
+	ModeOnce   = "once"
+	ModeDaemon = "daemon"
+
+	SinkClickhouse = "clickhouse"
+	SinkPostgres   = "postgres"
+	SinkSQLite     = "sqlite"
+
+	SinkPolicyDeadLetter = "dead-letter"
+
+	DLQNone       = "none"
+	DLQDirectory  = "dir"
+	DLQClickhouse = "clickhouse"
+)
+
+var (
+	LogLevels = []string{"debug", "info", "warn", "error"}
+
+	Modes            = []string{ModeOnce, ModeDaemon}
+	FileSinks        = []string{"jsonl", "csv", "parquet"}
+	Sinks            = append([]string{SinkClickhouse, SinkPostgres, SinkSQLite}, FileSinks...)
+	SinkCompressions = []string{"none", "gzip", "zstd"}
+	SinkPolicies     = []string{"fail", "skip", SinkPolicyDeadLetter}
+	DLQs             = []string{DLQNone, DLQDirectory, DLQClickhouse}
+	TraceExporters   = []string{"none", "stdout", "otlp-grpc", "otlp-http"}
+)
+
+// Validate reports every invalid setting at once, naming settings by their
+// config file key.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+
+	check(c.ParserDir != "", "parser_dir", "must not be empty")
+	check(c.DryRun || slices.Contains(FileSinks, c.Sink) || c.DatabaseDSN != "", "database_dsn", "must not be empty")
+	check(slices.Contains(LogLevels, c.LogLevel), "log_level", "must be one of %v, got %q", LogLevels, c.LogLevel)
+
+	check(slices.Contains(logging.Formats, c.LogFormat), "log_format", "must be one of %v, got %q", logging.Formats, c.LogFormat)
+
+	check(slices.Contains(Modes, c.Mode), "mode", "must be one of %v, got %q", Modes, c.Mode)
+	check(c.Mode != ModeDaemon || c.PollInterval > 0, "poll_interval", "must be positive in daemon mode, got %s", c.PollInterval)
+
+	check(slices.Contains(TraceExporters, c.TraceExporter), "trace_exporter", "must be one of %v, got %q", TraceExporters, c.TraceExporter)
+	check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "trace_sample_ratio", "must be between 0 and 1, got %g", c.TraceSampleRatio)
+
+	check(c.ParseWorkers >= 1, "parse_workers", "must be at least 1, got %d", c.ParseWorkers)
+	check(c.FlattenWorkers >= 1, "flatten_workers", "must be at least 1, got %d", c.FlattenWorkers)
+	check(c.SaveWorkers >= 1, "save_workers", "must be at least 1, got %d", c.SaveWorkers)
+	check(!c.Ordered || c.OrderWindow >= 1, "order_window", "must be at least 1 when ordered, got %d", c.OrderWindow)
+
+	check(slices.Contains(Sinks, c.Sink), "sink", "must be one of %v, got %q", Sinks, c.Sink)
+	if slices.Contains(FileSinks, c.Sink) {
+		check(c.SinkDir != "", "sink_dir", "must not be empty")
+		check(slices.Contains(SinkCompressions, c.SinkCompression), "sink_compression", "must be one of %v, got %q", SinkCompressions, c.SinkCompression)
+	}
+	check(c.SinkMaxBytes >= 0, "sink_max_bytes", "must not be negative, got %d", c.SinkMaxBytes)
+	check(c.SinkMaxAge >= 0, "sink_max_age", "must not be negative, got %s", c.SinkMaxAge)
+	check(slices.Contains(SinkPolicies, c.SinkOnError), "sink_on_error", "must be one of %v, got %q", SinkPolicies, c.SinkOnError)
+
+	names := make(map[string]bool)
+	for i, s := range c.SinkConfigs() {
+		check(s.OnError != SinkPolicyDeadLetter || c.DeadLetterDir != "", "dead_letter_dir", "must not be empty when sink %s dead-letters", s.Name)
+		if len(c.Sinks) == 0 {
+			continue
+		}
+
+		key := fmt.Sprintf("sinks[%d].", i)
+		check(slices.Contains(Sinks, s.Type), key+"type", "must be one of %v, got %q", Sinks, s.Type)
+		check(!names[s.Name], key+"name", "must be unique, got %q", s.Name)
+		names[s.Name] = true
+		check(slices.Contains(SinkPolicies, s.OnError), key+"on_error", "must be one of %v, got %q", SinkPolicies, s.OnError)
+		if slices.Contains(FileSinks, s.Type) {
+			check(s.Dir != "", key+"dir", "must not be empty")
+			check(slices.Contains(SinkCompressions, s.Compression), key+"compression", "must be one of %v, got %q", SinkCompressions, s.Compression)
+		} else {
+			check(c.DryRun || s.DSN != "", key+"dsn", "must not be empty")
+		}
+	}
+
+	check(slices.Contains(DLQs, c.DLQ), "dlq", "must be one of %v, got %q", DLQs, c.DLQ)
+	check(c.DLQ != DLQDirectory || c.DLQDir != "", "dlq_dir", "must not be empty when dlq is %s", DLQDirectory)
+	check(c.DLQ != DLQClickhouse || slices.ContainsFunc(c.SinkConfigs(), func(s SinkConfig) bool { return s.Type == SinkClickhouse }),
+		"dlq", "must have a %s sink to be %s", SinkClickhouse, DLQClickhouse)
+
+	check(c.ShutdownGracePeriod >= 0, "shutdown_grace_period", "must not be negative, got %s", c.ShutdownGracePeriod)
+
+	check(c.BatchMaxRows >= 0, "batch_max_rows", "must not be negative, got %d", c.BatchMaxRows)
+	check(c.BatchMaxBytes >= 0, "batch_max_bytes", "must not be negative, got %d", c.BatchMaxBytes)
+	check(c.BatchFlushInterval >= 0, "batch_flush_interval", "must not be negative, got %s", c.BatchFlushInterval)
+
+	check(c.RetryMaxAttempts >= 1, "retry_max_attempts", "must be at least 1, got %d", c.RetryMaxAttempts)
+	check(c.RetryInitialBackoff >= 0, "retry_initial_backoff", "must not be negative, got %s", c.RetryInitialBackoff)
+	check(c.RetryMaxBackoff >= c.RetryInitialBackoff, "retry_max_backoff", "must not be below retry_initial_backoff (%s), got %s", c.RetryInitialBackoff, c.RetryMaxBackoff)
+	check(c.BreakerThreshold >= 0, "breaker_threshold", "must not be negative, got %d", c.BreakerThreshold)
+	check(c.BreakerThreshold == 0 || c.BreakerCooldown > 0, "breaker_cooldown", "must be positive when the breaker is enabled, got %s", c.BreakerCooldown)
+
+	check(c.From.IsZero() || c.To.IsZero() || !c.To.Before(c.From), "to", "must not be before from")
+
+	return errors.Join(errs...)
+}
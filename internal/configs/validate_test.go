@@ -0,0 +1,191 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig(opts ...Opt) *Config {
+	return NewConfig(append([]Opt{
+		WithParserDir("./data/raw"),
+		WithDatabaseDSN("clickhouse://localhost:9000/db"),
+		WithLogLevel("info"),
+		WithLogFormat("text"),
+		WithMode("daemon"),
+		WithSink("clickhouse"),
+		WithSinkOnError("fail"),
+		WithDLQ("none"),
+		WithPollInterval(10 * time.Second),
+		WithTraceExporter("none"),
+		WithTraceSampleRatio(1),
+		WithParseWorkers(1),
+		WithFlattenWorkers(1),
+		WithSaveWorkers(1),
+		WithRetryMaxAttempts(5),
+		WithRetryInitialBackoff(200 * time.Millisecond),
+		WithRetryMaxBackoff(30 * time.Second),
+		WithBreakerThreshold(5),
+		WithBreakerCooldown(30 * time.Second),
+	}, opts...)...)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *Config
+		errors []string
+	}{
+		{
+			name: "Valid",
+			cfg:  validConfig(),
+		},
+		{
+			name: "Breaker disabled without cooldown",
+			cfg:  validConfig(WithBreakerThreshold(0), WithBreakerCooldown(0)),
+		},
+		{
+			name: "Dry run without database",
+			cfg:  validConfig(WithDryRun(true), WithDatabaseDSN("")),
+		},
+		{
+			name:   "Unknown log level",
+			cfg:    validConfig(WithLogLevel("verbose")),
+			errors: []string{`log_level: must be one of [debug info warn error], got "verbose"`},
+		},
+		{
+			name:   "Unknown log format",
+			cfg:    validConfig(WithLogFormat("xml")),
+			errors: []string{`log_format: must be one of [text json], got "xml"`},
+		},
+		{
+			name: "File sink without database",
+			cfg:  validConfig(WithSink("csv"), WithSinkDir("./out"), WithSinkCompression("gzip"), WithDatabaseDSN("")),
+		},
+		{
+			name:   "SQLite sink without database",
+			cfg:    validConfig(WithSink("sqlite"), WithDatabaseDSN("")),
+			errors: []string{"database_dsn: must not be empty"},
+		},
+		{
+			name: "Invalid file sink",
+			cfg:  validConfig(WithSink("parquet"), WithSinkCompression("lz4"), WithSinkMaxAge(-time.Second)),
+			errors: []string{
+				"sink_dir: must not be empty",
+				`sink_compression: must be one of [none gzip zstd], got "lz4"`,
+				"sink_max_age: must not be negative, got -1s",
+			},
+		},
+		{
+			name: "Fan out",
+			cfg: validConfig(WithSinks(
+				SinkConfig{Type: "clickhouse"},
+				SinkConfig{Name: "archive", Type: "parquet", Dir: "./archive", Compression: "zstd", OnError: "dead-letter"},
+			), WithDeadLetterDir("./dead")),
+		},
+		{
+			name: "Invalid fan out",
+			cfg: validConfig(WithSinks(
+				SinkConfig{Type: "clickhouse", OnError: "retry"},
+				SinkConfig{Type: "clickhouse", DSN: "clickhouse://other:9000"},
+				SinkConfig{Name: "archive", Type: "parquet", Compression: "gzip", OnError: "dead-letter"},
+			), WithSinkDir("")),
+			errors: []string{
+				`sinks[0].on_error: must be one of [fail skip dead-letter], got "retry"`,
+				`sinks[1].name: must be unique, got "clickhouse"`,
+				"dead_letter_dir: must not be empty when sink archive dead-letters",
+				"sinks[2].dir: must not be empty",
+			},
+		},
+		{
+			name: "Dead-letter store",
+			cfg:  validConfig(WithDLQ("clickhouse")),
+		},
+		{
+			name:   "Unknown dead-letter store",
+			cfg:    validConfig(WithDLQ("s3")),
+			errors: []string{`dlq: must be one of [none dir clickhouse], got "s3"`},
+		},
+		{
+			name:   "Dead-letter directory missing",
+			cfg:    validConfig(WithDLQ("dir")),
+			errors: []string{"dlq_dir: must not be empty when dlq is dir"},
+		},
+		{
+			name:   "Dead-letter table without ClickHouse",
+			cfg:    validConfig(WithDLQ("clickhouse"), WithSink("csv"), WithSinkDir("./out"), WithSinkCompression("none")),
+			errors: []string{"dlq: must have a clickhouse sink to be clickhouse"},
+		},
+		{
+			name:   "Unknown sink",
+			cfg:    validConfig(WithSink("kafka")),
+			errors: []string{`sink: must be one of [clickhouse postgres sqlite jsonl csv parquet], got "kafka"`},
+		},
+		{
+			name:   "Unknown mode",
+			cfg:    validConfig(WithMode("cron")),
+			errors: []string{`mode: must be one of [once daemon], got "cron"`},
+		},
+		{
+			name: "Once without poll interval",
+			cfg:  validConfig(WithMode("once"), WithPollInterval(0)),
+		},
+		{
+			name:   "Daemon without poll interval",
+			cfg:    validConfig(WithPollInterval(0)),
+			errors: []string{"poll_interval: must be positive in daemon mode, got 0s"},
+		},
+		{
+			name:   "Unknown trace exporter",
+			cfg:    validConfig(WithTraceExporter("jaeger")),
+			errors: []string{`trace_exporter: must be one of [none stdout otlp-grpc otlp-http], got "jaeger"`},
+		},
+		{
+			name:   "Trace sample ratio out of range",
+			cfg:    validConfig(WithTraceSampleRatio(1.5)),
+			errors: []string{"trace_sample_ratio: must be between 0 and 1, got 1.5"},
+		},
+		{
+			name:   "Ordered without window",
+			cfg:    validConfig(WithOrdered(true), WithOrderWindow(0)),
+			errors: []string{"order_window: must be at least 1 when ordered, got 0"},
+		},
+		{
+			name:   "Inverted date range",
+			cfg:    validConfig(WithFrom(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)), WithTo(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))),
+			errors: []string{"to: must not be before from"},
+		},
+		{
+			name: "Reports every invalid field",
+			cfg: validConfig(
+				WithDatabaseDSN(""),
+				WithParseWorkers(0),
+				WithBatchMaxRows(-1),
+				WithRetryMaxBackoff(time.Millisecond),
+				WithBreakerCooldown(0),
+			),
+			errors: []string{
+				"database_dsn: must not be empty",
+				"parse_workers: must be at least 1, got 0",
+				"batch_max_rows: must not be negative, got -1",
+				"retry_max_backoff: must not be below retry_initial_backoff (200ms), got 1ms",
+				"breaker_cooldown: must be positive when the breaker is enabled, got 0s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if len(tt.errors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.errors, strings.Split(err.Error(), "\n"))
+		})
+	}
+}
@@ -1,33 +1,403 @@
 package flags
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sbilibin2017/cs2/internal/configs"
 )
 
-var (
-	parserDir string
-	dsn       string
-	logLevel  string
-)
-
-func ParseAppFlags() *configs.Config {
-	config := parseAppFlags()
-	return config
+// Command is a parsed command line: the subcommand name, its positional
+// arguments and the resulting configuration.
+type Command struct {
+	Name   string
+	Args   []string
+	Config *configs.Config
+}
 
+type command struct {
+	name    string
+	usage   string
+	summary string
+	flags   func(fs *flag.FlagSet, cfg *configs.Config)
+	args    func(args []string) error
 }
 
-func parseAppFlags() *configs.Config {
-	flag.StringVar(&parserDir, "p", "./data/raw", "Directory for parser files")
-	flag.StringVar(&dsn, "d", "user:pass@localhost:5432/db", "Database DSN")
-	flag.StringVar(&logLevel, "l", "info", "Logging level (e.g. debug, info, warn, error)")
+const defaultCommand = "ingest"
 
-	flag.Parse()
+var output io.Writer = os.Stderr
 
+var commands = []command{
+	{
+		name:    "ingest",
+		usage:   "cs2 [ingest] [flags]",
+		summary: "Parse game files and write flattened rows to ClickHouse (default)",
+		flags:   ingestFlags,
+		args:    noArgs,
+	},
+	{
+		name:    "migrate",
+		usage:   "cs2 migrate [flags] up|down|status|redo",
+		summary: "Apply or inspect the embedded migrations of the database sinks",
+		flags:   sinkFlags,
+		args: func(args []string) error {
+			migrateCommands := []string{"up", "down", "status", "redo"}
+			if len(args) != 1 || !slices.Contains(migrateCommands, args[0]) {
+				return fmt.Errorf("expected one migrate command of %v", migrateCommands)
+			}
+			return nil
+		},
+	},
+	{
+		name:    "validate",
+		usage:   "cs2 validate [flags]",
+		summary: "Check the games schema and decode every game file without writing",
+		flags:   parserFlags,
+		args:    noArgs,
+	},
+	{
+		name:    "config",
+		usage:   "cs2 config [flags] print",
+		summary: "Print the effective configuration with secrets redacted",
+		flags:   ingestFlags,
+		args: func(args []string) error {
+			if len(args) != 1 || args[0] != "print" {
+				return errors.New("expected the config command print")
+			}
+			return nil
+		},
+	},
+	{
+		name:    "stats",
+		usage:   "cs2 stats [flags]",
+		summary: "Print games and rows stored in ClickHouse per month",
+		flags:   sinkFlags,
+		args:    noArgs,
+	},
+	{
+		name:    "export",
+		usage:   "cs2 export [flags]",
+		summary: "Write stored rows as JSON lines",
+		flags: func(fs *flag.FlagSet, cfg *configs.Config) {
+			fs.StringVar(&cfg.ExportPath, "o", cfg.ExportPath, "Output file (- for stdout)")
+			sinkFlags(fs, cfg)
+			rangeFlags(fs, cfg)
+		},
+		args: noArgs,
+	},
+	{
+		name:    "replay",
+		usage:   "cs2 replay [flags]",
+		summary: "Re-ingest the archived games in a date range or with the given IDs, replacing their rows",
+		flags: func(fs *flag.FlagSet, cfg *configs.Config) {
+			parserFlags(fs, cfg)
+			pipelineFlags(fs, cfg)
+			sinkFlags(fs, cfg)
+			dlqFlags(fs, cfg)
+			telemetryFlags(fs, cfg)
+			rangeFlags(fs, cfg)
+			fs.Var((*int64ListValue)(&cfg.GameIDs), "game-ids", "Only replay these games (comma-separated IDs)")
+			fs.StringVar(&cfg.ReplayState, "state", cfg.ReplayState, "File recording the replay in progress, so that an interrupted replay resumes")
+		},
+		args: noArgs,
+	},
+	{
+		name:    "dlq",
+		usage:   "cs2 dlq [flags] list|inspect <game id>|replay [game id...]",
+		summary: "List, inspect or replay the games in the dead-letter store",
+		flags: func(fs *flag.FlagSet, cfg *configs.Config) {
+			pipelineFlags(fs, cfg)
+			sinkFlags(fs, cfg)
+			dlqFlags(fs, cfg)
+		},
+		args: dlqArgs,
+	},
+}
+
+func defaultConfig() *configs.Config {
 	return configs.NewConfig(
-		configs.WithParserDir(parserDir),
-		configs.WithDatabaseDSN(dsn),
-		configs.WithLogLevel(logLevel),
+		configs.WithParserDir("./data/raw"),
+		configs.WithDatabaseDSN("clickhouse://default@localhost:9000/default"),
+		configs.WithLogLevel("info"),
+		configs.WithLogFormat("text"),
+		configs.WithTraceExporter("none"),
+		configs.WithTraceSampleRatio(1),
+		configs.WithParseWorkers(runtime.NumCPU()),
+		configs.WithFlattenWorkers(runtime.NumCPU()),
+		configs.WithSaveWorkers(2),
+		configs.WithOrderWindow(1000),
+		configs.WithMode("daemon"),
+		configs.WithPollInterval(10*time.Second),
+		configs.WithShutdownGracePeriod(30*time.Second),
+		configs.WithSink(configs.SinkClickhouse),
+		configs.WithSinkDir("./data/out"),
+		configs.WithSinkCompression("none"),
+		configs.WithSinkMaxBytes(256<<20),
+		configs.WithSinkMaxAge(time.Hour),
+		configs.WithSinkOnError("fail"),
+		configs.WithDeadLetterDir("./data/dead-letter"),
+		configs.WithDLQ("none"),
+		configs.WithDLQDir("./data/dlq"),
+		configs.WithReplayState("./data/replay-state.json"),
+		configs.WithBatchMaxRows(100000),
+		configs.WithBatchMaxBytes(64<<20),
+		configs.WithBatchFlushInterval(5*time.Second),
+		configs.WithRetryMaxAttempts(5),
+		configs.WithRetryInitialBackoff(200*time.Millisecond),
+		configs.WithRetryMaxBackoff(30*time.Second),
+		configs.WithBreakerThreshold(5),
+		configs.WithBreakerCooldown(30*time.Second),
+		configs.WithExportPath("-"),
 	)
 }
+
+// ParseCommand parses the command line (without the program name). Arguments
+// that do not start with a known command are parsed as the ingest command.
+// It returns flag.ErrHelp when help was requested.
+func ParseCommand(args []string) (*Command, error) {
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		if len(args) == 0 {
+			printUsage()
+			return nil, flag.ErrHelp
+		}
+		name, args = args[0], []string{"-h"}
+	}
+
+	idx := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if idx < 0 {
+		printUsage()
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+	cmd := commands[idx]
+
+	// The config file is located with a first pass over the flags, so that
+	// the second pass can apply flags on top of file and environment.
+	scratch := defaultConfig()
+	if newFlagSet(cmd, scratch, io.Discard).Parse(args) != nil {
+		scratch.ConfigFile = ""
+	}
+
+	cfg := defaultConfig()
+	if err := loadConfig(cfg, scratch.ConfigFile); err != nil {
+		return nil, err
+	}
+
+	fs := newFlagSet(cmd, cfg, output)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cmd.args(fs.Args()); err != nil {
+		fs.Usage()
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return &Command{
+		Name:   cmd.name,
+		Args:   fs.Args(),
+		Config: cfg,
+	}, nil
+}
+
+func newFlagSet(cmd command, cfg *configs.Config, w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "%s\n\nUsage: %s\n\nFlags:\n", cmd.summary, cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	globalFlags(fs, cfg)
+	cmd.flags(fs, cfg)
+
+	return fs
+}
+
+// loadConfig overlays the config file, if any, and then CS2_* environment
+// variables onto cfg. Without -config the file is taken from CS2_CONFIG.
+func loadConfig(cfg *configs.Config, path string) error {
+	if path == "" {
+		path = os.Getenv(configs.EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return err
+		}
+		cfg.ConfigFile = path
+	}
+	return cfg.LoadEnv(os.LookupEnv)
+}
+
+func printUsage() {
+	fmt.Fprintf(output, "Usage: cs2 <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(output, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(output, "\nRun 'cs2 help <command>' for the flags of a command.\n")
+}
+
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	return nil
+}
+
+func dlqArgs(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected one dlq command of [list inspect replay]")
+	}
+
+	ids := args[1:]
+	switch args[0] {
+	case "list":
+		return noArgs(ids)
+	case "inspect":
+		if len(ids) != 1 {
+			return errors.New("expected one game id to inspect")
+		}
+	case "replay":
+	default:
+		return fmt.Errorf("unknown dlq command %q, expected list, inspect or replay", args[0])
+	}
+
+	for _, id := range ids {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			return fmt.Errorf("invalid game id %q", id)
+		}
+	}
+	return nil
+}
+
+func globalFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "YAML or TOML config file (env: CS2_CONFIG)")
+	fs.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "Database DSN: clickhouse://, postgres:// or sqlite://<path>, matching -sink")
+	fs.StringVar(&cfg.LogLevel, "l", cfg.LogLevel, "Logging level (e.g. debug, info, warn, error)")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log record format (text or json)")
+}
+
+func ingestFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	parserFlags(fs, cfg)
+	pipelineFlags(fs, cfg)
+	sinkFlags(fs, cfg)
+	dlqFlags(fs, cfg)
+	telemetryFlags(fs, cfg)
+	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "once processes the pending game files and exits, daemon keeps polling for new ones")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", cfg.PollInterval, "Pause between directory scans in daemon mode")
+	fs.BoolVar(&cfg.AutoMigrate, "auto-migrate", cfg.AutoMigrate, "Apply pending migrations before starting the workers")
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "Parse and flatten every game file once and print per-file stats without connecting to ClickHouse")
+}
+
+func sinkFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.StringVar(&cfg.Sink, "sink", cfg.Sink, "Where rows are written: clickhouse, postgres, sqlite, jsonl, csv or parquet")
+	fs.StringVar(&cfg.SinkDir, "sink-dir", cfg.SinkDir, "Directory for the files of the jsonl, csv and parquet sinks")
+	fs.StringVar(&cfg.SinkCompression, "sink-compression", cfg.SinkCompression, "Compression of sink files: none, gzip or zstd")
+	fs.IntVar(&cfg.SinkMaxBytes, "sink-max-bytes", cfg.SinkMaxBytes, "Start a new sink file after this many bytes (0 disables)")
+	fs.DurationVar(&cfg.SinkMaxAge, "sink-max-age", cfg.SinkMaxAge, "Start a new sink file once the current one is this old (0 disables)")
+	fs.StringVar(&cfg.SinkOnError, "sink-on-error", cfg.SinkOnError, "What to do with a batch the sink failed to save: fail, skip or dead-letter. Only fail hands the games to the -dlq store")
+	fs.StringVar(&cfg.DeadLetterDir, "dead-letter-dir", cfg.DeadLetterDir, "Directory for the batches of dead-letter sinks")
+	fs.BoolVar(&cfg.StoreRaw, "store-raw", cfg.StoreRaw, "Keep every source game verbatim in the games_raw table of the clickhouse sink, created by the migrations")
+	fs.BoolVar(&cfg.RoundEvents, "round-events", cfg.RoundEvents, "Save the kill feed, clutches, economy and bomb plants of every round in the round_events table of the clickhouse sink, created by the migrations")
+}
+
+func dlqFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.StringVar(&cfg.DLQ, "dlq", cfg.DLQ, "Where games rejected by flattening or saving are kept: none, dir or clickhouse (dead_letters table). Saves only reach it from sinks that fail on error")
+	fs.StringVar(&cfg.DLQDir, "dlq-dir", cfg.DLQDir, "Directory of the dir dead-letter store")
+}
+
+func parserFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.StringVar(&cfg.ParserDir, "p", cfg.ParserDir, "Directory for parser files")
+	fs.BoolVar(&cfg.StrictDecode, "strict", cfg.StrictDecode, "Reject game files with fields that are not decoded instead of reporting them")
+}
+
+func pipelineFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.IntVar(&cfg.ParseWorkers, "parse-workers", cfg.ParseWorkers, "Number of goroutines reading and decoding game files")
+	fs.IntVar(&cfg.FlattenWorkers, "flatten-workers", cfg.FlattenWorkers, "Number of goroutines flattening games into rows")
+	fs.IntVar(&cfg.SaveWorkers, "save-workers", cfg.SaveWorkers, "Maximum number of batches saved concurrently")
+	fs.BoolVar(&cfg.Ordered, "ordered", cfg.Ordered, "Save games ordered by begin_at (forces a single saver)")
+	fs.IntVar(&cfg.OrderWindow, "order-window", cfg.OrderWindow, "Number of games buffered to restore begin_at order")
+	fs.DurationVar(&cfg.ShutdownGracePeriod, "shutdown-grace", cfg.ShutdownGracePeriod, "Time given to in-flight games, then to the final flush, to be saved after SIGINT or SIGTERM. No checkpoint is kept: a restart reads every file again")
+	fs.IntVar(&cfg.BatchMaxRows, "batch-rows", cfg.BatchMaxRows, "Flush an insert batch once it holds this many rows")
+	fs.IntVar(&cfg.BatchMaxBytes, "batch-bytes", cfg.BatchMaxBytes, "Flush an insert batch once its rows take this many bytes in the insert (213 per row)")
+	fs.DurationVar(&cfg.BatchFlushInterval, "batch-interval", cfg.BatchFlushInterval, "Flush an insert batch at least this often")
+	fs.IntVar(&cfg.RetryMaxAttempts, "retry-attempts", cfg.RetryMaxAttempts, "Attempts per insert before giving up when the circuit breaker is disabled")
+	fs.DurationVar(&cfg.RetryInitialBackoff, "retry-backoff", cfg.RetryInitialBackoff, "Initial backoff between insert retries")
+	fs.DurationVar(&cfg.RetryMaxBackoff, "retry-max-backoff", cfg.RetryMaxBackoff, "Maximum backoff between insert retries")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", cfg.BreakerThreshold, "Consecutive insert failures that pause reading (0 disables the breaker)")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", cfg.BreakerCooldown, "Pause before probing ClickHouse again once the breaker is open")
+}
+
+func telemetryFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", cfg.HTTPAddr, "Serve /metrics, /healthz and /readyz on this address (e.g. :9090, empty disables)")
+	fs.StringVar(&cfg.TraceExporter, "trace-exporter", cfg.TraceExporter, "Span exporter (none, stdout, otlp-grpc or otlp-http)")
+	fs.StringVar(&cfg.TraceEndpoint, "trace-endpoint", cfg.TraceEndpoint, "OTLP collector URL (default from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", cfg.TraceSampleRatio, "Fraction of games traced, between 0 and 1")
+}
+
+func rangeFlags(fs *flag.FlagSet, cfg *configs.Config) {
+	fs.Var((*dateValue)(&cfg.From), "from", "Only include games starting on or after this date (YYYY-MM-DD)")
+	fs.Var((*dateValue)(&cfg.To), "to", "Only include games starting on or before this date (YYYY-MM-DD)")
+}
+
+// dateValue is a flag.Value for YYYY-MM-DD dates in UTC.
+type dateValue time.Time
+
+func (d *dateValue) String() string {
+	if d == nil || time.Time(*d).IsZero() {
+		return ""
+	}
+	return time.Time(*d).Format(time.DateOnly)
+}
+
+func (d *dateValue) Set(s string) error {
+	t, err := time.ParseInLocation(time.DateOnly, s, time.UTC)
+	if err != nil {
+		return errors.New("expected a date formatted as YYYY-MM-DD")
+	}
+	*d = dateValue(t)
+	return nil
+}
+
+// int64ListValue is a flag.Value for comma-separated integers.
+type int64ListValue []int64
+
+func (l *int64ListValue) String() string {
+	if l == nil {
+		return ""
+	}
+	ids := make([]string, len(*l))
+	for i, id := range *l {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(ids, ",")
+}
+
+func (l *int64ListValue) Set(s string) error {
+	var ids []int64
+	for _, field := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid game id %q", field)
+		}
+		ids = append(ids, id)
+	}
+	*l = ids
+	return nil
+}
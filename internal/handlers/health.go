@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Check is a named probe; a nil error means the component is healthy.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// NewHealthHandler runs every check concurrently and answers 200 when all of
+// them pass and 503 otherwise, listing the result of each check.
+func NewHealthHandler(checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		resp := healthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for _, c := range checks {
+			wg.Add(1)
+			go func(c Check) {
+				defer wg.Done()
+
+				result := "ok"
+				if err := c.Check(ctx); err != nil {
+					result = err.Error()
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				resp.Checks[c.Name] = result
+				if result != "ok" {
+					resp.Status = "unavailable"
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		if resp.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
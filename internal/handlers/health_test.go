@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pass(ctx context.Context) error { return nil }
+
+func TestNewHealthHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		checks   []Check
+		status   int
+		expected healthResponse
+	}{
+		{
+			name:     "No checks",
+			status:   http.StatusOK,
+			expected: healthResponse{Status: "ok"},
+		},
+		{
+			name: "All checks pass",
+			checks: []Check{
+				{Name: "clickhouse", Check: pass},
+				{Name: "schema", Check: pass},
+			},
+			status: http.StatusOK,
+			expected: healthResponse{Status: "ok", Checks: map[string]string{
+				"clickhouse": "ok",
+				"schema":     "ok",
+			}},
+		},
+		{
+			name: "One check fails",
+			checks: []Check{
+				{Name: "clickhouse", Check: pass},
+				{Name: "input", Check: func(ctx context.Context) error {
+					return errors.New("stat ./data/raw: no such file or directory")
+				}},
+			},
+			status: http.StatusServiceUnavailable,
+			expected: healthResponse{Status: "unavailable", Checks: map[string]string{
+				"clickhouse": "ok",
+				"input":      "stat ./data/raw: no such file or directory",
+			}},
+		},
+		{
+			name: "Check runs out of time",
+			checks: []Check{
+				{Name: "clickhouse", Check: func(ctx context.Context) error {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(time.Minute):
+						return nil
+					}
+				}},
+			},
+			status: http.StatusServiceUnavailable,
+			expected: healthResponse{Status: "unavailable", Checks: map[string]string{
+				"clickhouse": "context deadline exceeded",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The probe's own timeout bounds the checks as well.
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx)
+			NewHealthHandler(tt.checks...).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var resp healthResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			if len(resp.Checks) == 0 {
+				resp.Checks = nil
+			}
+			assert.Equal(t, tt.expected, resp)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Attribute keys shared by every package, so records about the same game or
+// batch can be correlated.
+const (
+	KeyGameID    = "game_id"
+	KeyFile      = "file"
+	KeyBatchRows = "batch_rows"
+	KeyStage     = "stage"
+	KeyError     = "error"
+)
+
+// Pipeline stages, used as values of KeyStage.
+const (
+	StageParse   = "parse"
+	StageRaw     = "raw"
+	StageFlatten = "flatten"
+	StageOrder   = "order"
+	StageSave    = "save"
+
+	StageRoundEvents = "round_events"
+)
+
+// Formats are the formats New accepts.
+var Formats = []string{"text", "json"}
+
+// New returns a logger writing to w in the given format ("text" or "json")
+// at the given level. Above debug, info records are sampled so per-game
+// records cannot flood the output.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	if lvl > slog.LevelDebug {
+		handler = NewSamplingHandler(handler)
+	}
+
+	return slog.New(handler), nil
+}
+
+type ctxKey struct{}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns the logger stored by WithLogger, or slog.Default.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+func GameID(id int64) slog.Attr {
+	return slog.Int64(KeyGameID, id)
+}
+
+func File(path string) slog.Attr {
+	return slog.String(KeyFile, path)
+}
+
+func BatchRows(rows int) slog.Attr {
+	return slog.Int(KeyBatchRows, rows)
+}
+
+func Stage(stage string) slog.Attr {
+	return slog.String(KeyStage, stage)
+}
+
+func Latency(d time.Duration) slog.Attr {
+	return slog.Duration("latency", d)
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		format   string
+		log      func(l *slog.Logger)
+		expected []string
+	}{
+		{
+			name:   "Text at info drops debug",
+			level:  "info",
+			format: "text",
+			log: func(l *slog.Logger) {
+				l.Debug("hidden")
+				l.Info("game parsed", GameID(101), File("game_101.json"))
+			},
+			expected: []string{"level=INFO", `msg="game parsed"`, "game_id=101", "file=game_101.json"},
+		},
+		{
+			name:   "JSON",
+			level:  "warn",
+			format: "json",
+			log: func(l *slog.Logger) {
+				l.Info("hidden")
+				l.Warn("save failed", Stage(StageSave), BatchRows(24))
+			},
+			expected: []string{`"level":"WARN"`, `"stage":"save"`, `"batch_rows":24`},
+		},
+		{
+			name:   "Debug",
+			level:  "debug",
+			format: "text",
+			log: func(l *slog.Logger) {
+				l.Debug("visible")
+			},
+			expected: []string{"level=DEBUG", "msg=visible"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.level, tt.format)
+			require.NoError(t, err)
+
+			tt.log(logger)
+
+			out := buf.String()
+			assert.Equal(t, 1, strings.Count(out, "\n"), out)
+			for _, s := range tt.expected {
+				assert.Contains(t, out, s)
+			}
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "verbose", "text")
+	assert.EqualError(t, err, `invalid log level "verbose"`)
+
+	_, err = New(&bytes.Buffer{}, "info", "xml")
+	assert.EqualError(t, err, `invalid log format "xml"`)
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	require.NoError(t, err)
+
+	ctx := WithLogger(context.Background(), logger)
+	assert.Same(t, logger, FromContext(ctx))
+
+	FromContext(ctx).Error("flush failed", Err(errors.New("boom")))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "boom", record[KeyError])
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type SamplingOption func(*samplingState)
+
+// WithSampleFirst sets how many records with the same level and message are
+// kept per tick before sampling starts.
+func WithSampleFirst(n int) SamplingOption {
+	return func(s *samplingState) {
+		s.first = n
+	}
+}
+
+// WithSampleThereafter keeps every n-th record once the first ones of a tick
+// have been written.
+func WithSampleThereafter(n int) SamplingOption {
+	return func(s *samplingState) {
+		s.thereafter = n
+	}
+}
+
+func WithSampleTick(tick time.Duration) SamplingOption {
+	return func(s *samplingState) {
+		s.tick = tick
+	}
+}
+
+// SamplingHandler drops repeated records below warn level: per tick, the first
+// records with a given level and message pass, then only every n-th one.
+// Warnings and errors are never dropped.
+type SamplingHandler struct {
+	next  slog.Handler
+	state *samplingState
+}
+
+type samplingState struct {
+	first      int
+	thereafter int
+	tick       time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	counts   map[samplingKey]int
+	resetsAt time.Time
+}
+
+type samplingKey struct {
+	level slog.Level
+	msg   string
+}
+
+func NewSamplingHandler(next slog.Handler, opts ...SamplingOption) *SamplingHandler {
+	state := &samplingState{
+		first:      10,
+		thereafter: 100,
+		tick:       time.Second,
+		now:        time.Now,
+		counts:     make(map[samplingKey]int),
+	}
+	for _, opt := range opts {
+		opt(state)
+	}
+	return &SamplingHandler{next: next, state: state}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn || h.state.keep(r.Level, r.Message) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), state: h.state}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), state: h.state}
+}
+
+func (s *samplingState) keep(level slog.Level, msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := s.now(); !now.Before(s.resetsAt) {
+		clear(s.counts)
+		s.resetsAt = now.Add(s.tick)
+	}
+
+	key := samplingKey{level: level, msg: msg}
+	s.counts[key]++
+	n := s.counts[key]
+
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := NewSamplingHandler(
+		slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		WithSampleFirst(2),
+		WithSampleThereafter(3),
+		WithSampleTick(time.Second),
+	)
+	h.state.now = func() time.Time { return now }
+	logger := slog.New(h).With(Stage(StageFlatten))
+
+	for range 10 {
+		logger.Info("game flattened")
+		logger.Warn("game skipped")
+	}
+	logger.Info("batch flushed")
+
+	out := buf.String()
+	// 1, 2, then 5 and 8.
+	assert.Equal(t, 4, strings.Count(out, `msg="game flattened"`))
+	assert.Equal(t, 10, strings.Count(out, `msg="game skipped"`))
+	assert.Equal(t, 1, strings.Count(out, `msg="batch flushed"`))
+	assert.Equal(t, 15, strings.Count(out, "stage=flatten"))
+
+	buf.Reset()
+	now = now.Add(time.Second)
+	logger.Info("game flattened")
+	assert.Contains(t, buf.String(), `msg="game flattened"`)
+}
+
+func TestSamplingHandler_Enabled(t *testing.T) {
+	h := NewSamplingHandler(slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	assert.False(t, h.Enabled(t.Context(), slog.LevelDebug))
+	assert.True(t, h.Enabled(t.Context(), slog.LevelInfo))
+}
@@ -0,0 +1,355 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+const namespace = "cs2"
+
+// Metrics collects the ingestion pipeline metrics. It implements the observer
+// interfaces of the repositories and workers packages.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	filesDiscovered prometheus.Gauge
+	filesParsed     prometheus.Counter
+	filesFailed     prometheus.Counter
+	gamesDropped    *prometheus.CounterVec
+	rowsFlattened   prometheus.Counter
+	unknownValues   *prometheus.CounterVec
+	unknownFields   *prometheus.CounterVec
+	gamesSaved      prometheus.Counter
+	batchesSaved    *prometheus.CounterVec
+	rowsSaved       prometheus.Counter
+	batchRows       prometheus.Histogram
+	saveDuration    prometheus.Histogram
+	saveRetries     prometheus.Counter
+	sinkRows        *prometheus.CounterVec
+	sinkErrors      *prometheus.CounterVec
+	sinkLastSave    *prometheus.GaugeVec
+	sinkLagRows     *prometheus.GaugeVec
+	stageRunning    *prometheus.GaugeVec
+	stageFailures   *prometheus.CounterVec
+
+	// maxBeginAt holds the Unix milliseconds of the newest saved game.
+	maxBeginAt atomic.Int64
+	now        func() time.Time
+
+	mu     sync.Mutex
+	queues map[string][]func() int
+
+	// sinkSaved holds the rows saved per sink, to compute their lag.
+	sinkMu    sync.Mutex
+	sinkSaved map[string]int64
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry:  prometheus.NewRegistry(),
+		queues:    make(map[string][]func() int),
+		sinkSaved: make(map[string]int64),
+		now:       time.Now,
+
+		filesDiscovered: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "files_discovered",
+			Help:      "Game files found in the parser directory by the last scan.",
+		}),
+		filesParsed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_parsed_total",
+			Help:      "Game files read and decoded.",
+		}),
+		filesFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_failed_total",
+			Help:      "Game files that could not be read or decoded.",
+		}),
+		gamesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "games_dropped_total",
+			Help:      "Decoded games that produced no rows, by reason.",
+		}, []string{"reason"}),
+		rowsFlattened: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rows_flattened_total",
+			Help:      "Rows produced by flattening games.",
+		}),
+		unknownValues: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "unknown_values_total",
+			Help:      "Games with a tier or round outcome that has no ID, by field.",
+		}, []string{"field"}),
+		unknownFields: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "unknown_fields_total",
+			Help:      "Game files with a field that is not decoded, by field path.",
+		}, []string{"field"}),
+		gamesSaved: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "games_saved_total",
+			Help:      "Games handed to the saver without error.",
+		}),
+		batchesSaved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "batches_saved_total",
+			Help:      "Insert batches flushed to the primary sink, by result.",
+		}, []string{"result"}),
+		rowsSaved: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rows_saved_total",
+			Help:      "Rows saved to the primary sink; sink_rows_total covers every sink.",
+		}),
+		batchRows: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "batch_rows",
+			Help:      "Rows per insert batch flushed to the primary sink.",
+			Buckets:   prometheus.ExponentialBuckets(100, 4, 8),
+		}),
+		saveDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "save_duration_seconds",
+			Help:      "Time to flush an insert batch to the primary sink, including retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}),
+		saveRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "save_retries_total",
+			Help:      "Insert attempts repeated after a retryable error.",
+		}),
+		sinkRows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sink_rows_total",
+			Help:      "Rows saved, by sink.",
+		}, []string{"sink"}),
+		sinkErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sink_errors_total",
+			Help:      "Batches a sink failed to save, by sink and error policy.",
+		}, []string{"sink", "policy"}),
+		sinkLastSave: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sink_last_save_timestamp_seconds",
+			Help:      "Unix time of the last batch a sink saved.",
+		}, []string{"sink"}),
+		sinkLagRows: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sink_lag_rows",
+			Help:      "Rows a sink has saved fewer than the sink furthest ahead.",
+		}, []string{"sink"}),
+		stageRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stage_goroutines",
+			Help:      "Running goroutines of a pipeline stage.",
+		}, []string{"stage"}),
+		stageFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stage_failures_total",
+			Help:      "Goroutines of a pipeline stage stopped by an error.",
+		}, []string{"stage"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.filesDiscovered,
+		m.filesParsed,
+		m.filesFailed,
+		m.gamesDropped,
+		m.rowsFlattened,
+		m.unknownValues,
+		m.unknownFields,
+		m.gamesSaved,
+		m.batchesSaved,
+		m.rowsSaved,
+		m.batchRows,
+		m.saveDuration,
+		m.saveRetries,
+		m.sinkRows,
+		m.sinkErrors,
+		m.sinkLastSave,
+		m.sinkLagRows,
+		m.stageRunning,
+		m.stageFailures,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "data_lag_seconds",
+			Help:      "Time between now and the begin_at of the newest saved game.",
+		}, m.dataLag),
+		&queueCollector{m: m, desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "queue_depth"),
+			"Items buffered in the output channels of a pipeline stage.",
+			[]string{"stage"}, nil,
+		)},
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// ObserveScan implements repositories.GameParserObserver.
+func (m *Metrics) ObserveScan(files int) {
+	m.filesDiscovered.Set(float64(files))
+}
+
+// ObserveFile implements repositories.GameParserObserver.
+func (m *Metrics) ObserveFile(path string, err error) {
+	if err != nil {
+		m.filesFailed.Inc()
+		return
+	}
+	m.filesParsed.Inc()
+}
+
+// ObserveUnknownFields implements repositories.GameParserObserver.
+func (m *Metrics) ObserveUnknownFields(path string, fields []string) {
+	for _, field := range fields {
+		m.unknownFields.WithLabelValues(field).Inc()
+	}
+}
+
+// ObserveRetry implements repositories.GameRetryObserver.
+func (m *Metrics) ObserveRetry(attempt int, err error) {
+	m.saveRetries.Inc()
+}
+
+// ObserveFlush implements repositories.GameBatchObserver.
+func (m *Metrics) ObserveFlush(rows int, bytes int, latency time.Duration, err error) {
+	m.saveDuration.Observe(latency.Seconds())
+	if err != nil {
+		m.batchesSaved.WithLabelValues("error").Inc()
+		return
+	}
+	m.batchesSaved.WithLabelValues("ok").Inc()
+	m.rowsSaved.Add(float64(rows))
+	m.batchRows.Observe(float64(rows))
+}
+
+// ObserveSink implements repositories.GameSinkObserver.
+func (m *Metrics) ObserveSink(sink string, policy string, rows int, err error) {
+	m.sinkMu.Lock()
+	defer m.sinkMu.Unlock()
+
+	if err != nil {
+		m.sinkErrors.WithLabelValues(sink, policy).Inc()
+		// A sink that has only failed so far still shows its lag.
+		rows = 0
+	} else {
+		m.sinkRows.WithLabelValues(sink).Add(float64(rows))
+		m.sinkLastSave.WithLabelValues(sink).Set(float64(m.now().UnixMilli()) / 1000)
+	}
+	m.sinkSaved[sink] += int64(rows)
+
+	var ahead int64
+	for _, saved := range m.sinkSaved {
+		ahead = max(ahead, saved)
+	}
+	for name, saved := range m.sinkSaved {
+		m.sinkLagRows.WithLabelValues(name).Set(float64(ahead - saved))
+	}
+}
+
+// ObserveGameDropped implements workers.Observer.
+func (m *Metrics) ObserveGameDropped(file string, reason string) {
+	m.gamesDropped.WithLabelValues(reason).Inc()
+}
+
+// ObserveFlattened implements workers.Observer.
+func (m *Metrics) ObserveFlattened(file string, rows int) {
+	m.rowsFlattened.Add(float64(rows))
+}
+
+// ObserveUnknownValue implements workers.Observer. The value is not used as
+// a label to keep the cardinality bounded.
+func (m *Metrics) ObserveUnknownValue(file string, field string, value string) {
+	m.unknownValues.WithLabelValues(field).Inc()
+}
+
+// ObserveSaved implements workers.Observer.
+func (m *Metrics) ObserveSaved(games []types.GameDB) {
+	if len(games) == 0 {
+		return
+	}
+	m.gamesSaved.Inc()
+
+	beginAt := games[0].BeginAt.UnixMilli()
+	for {
+		current := m.maxBeginAt.Load()
+		if beginAt <= current || m.maxBeginAt.CompareAndSwap(current, beginAt) {
+			return
+		}
+	}
+}
+
+// ObserveQueue implements workers.Observer. The length functions registered
+// for a stage are summed on every scrape.
+func (m *Metrics) ObserveQueue(stage string, length func() int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[stage] = append(m.queues[stage], length)
+}
+
+// ObserveStage implements workers.Observer.
+func (m *Metrics) ObserveStage(stage string) func(err error) {
+	m.stageRunning.WithLabelValues(stage).Inc()
+	return func(err error) {
+		m.stageRunning.WithLabelValues(stage).Dec()
+		if err != nil {
+			m.stageFailures.WithLabelValues(stage).Inc()
+		}
+	}
+}
+
+// ForgetQueues implements workers.Observer.
+func (m *Metrics) ForgetQueues() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.queues)
+}
+
+func (m *Metrics) dataLag() float64 {
+	maxBeginAt := m.maxBeginAt.Load()
+	if maxBeginAt == 0 {
+		return math.NaN()
+	}
+	return m.now().Sub(time.UnixMilli(maxBeginAt)).Seconds()
+}
+
+type queueCollector struct {
+	m    *Metrics
+	desc *prometheus.Desc
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	for stage, lengths := range c.m.queues {
+		var depth int
+		for _, length := range lengths {
+			depth += length()
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(depth), stage)
+	}
+}
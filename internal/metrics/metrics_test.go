@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_Observers(t *testing.T) {
+	m := New()
+
+	m.ObserveScan(3)
+	m.ObserveFile("a.json", nil)
+	m.ObserveFile("b.json", nil)
+	m.ObserveFile("c.json", errors.New("bad json"))
+	m.ObserveGameDropped("d.json", "not_two_teams")
+	m.ObserveGameDropped("e.json", "not_two_teams")
+	m.ObserveGameDropped("f.json", "no_rows")
+	m.ObserveFlattened("a.json", 24)
+	m.ObserveFlattened("b.json", 16)
+	m.ObserveUnknownValue("a.json", "tier", "z")
+	m.ObserveUnknownValue("a.json", "round_outcome", "planted")
+	m.ObserveUnknownValue("b.json", "tier", "")
+	m.ObserveUnknownFields("a.json", []string{"forfeit", "players[].slug"})
+	m.ObserveUnknownFields("b.json", []string{"forfeit"})
+	m.ObserveRetry(1, errors.New("timeout"))
+	m.ObserveFlush(40, 4096, 20*time.Millisecond, nil)
+	m.ObserveFlush(10, 1024, time.Second, errors.New("insert failed"))
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.filesDiscovered))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.filesParsed))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.filesFailed))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.gamesDropped.WithLabelValues("not_two_teams")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.gamesDropped.WithLabelValues("no_rows")))
+	assert.Equal(t, 40.0, testutil.ToFloat64(m.rowsFlattened))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.unknownValues.WithLabelValues("tier")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.unknownValues.WithLabelValues("round_outcome")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.unknownFields.WithLabelValues("forfeit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.unknownFields.WithLabelValues("players[].slug")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.saveRetries))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.batchesSaved.WithLabelValues("ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.batchesSaved.WithLabelValues("error")))
+	assert.Equal(t, 40.0, testutil.ToFloat64(m.rowsSaved))
+	assert.Equal(t, uint64(2), histogramCount(t, m, "cs2_save_duration_seconds"))
+	assert.Equal(t, uint64(1), histogramCount(t, m, "cs2_batch_rows"))
+}
+
+func histogramCount(t *testing.T, m *Metrics, name string) uint64 {
+	t.Helper()
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
+
+func TestMetrics_DataLag(t *testing.T) {
+	m := New()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	assert.True(t, math.IsNaN(m.dataLag()), "lag is unknown before anything is saved")
+
+	m.ObserveSaved([]types.GameDB{{BeginAt: now.Add(-time.Hour)}})
+	m.ObserveSaved([]types.GameDB{{BeginAt: now.Add(-2 * time.Hour)}})
+	m.ObserveSaved(nil)
+
+	assert.Equal(t, time.Hour.Seconds(), m.dataLag())
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.gamesSaved))
+}
+
+func TestMetrics_Sinks(t *testing.T) {
+	m := New()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	m.ObserveSink("clickhouse", "fail", 100, nil)
+	m.ObserveSink("archive", "skip", 100, errors.New("disk full"))
+	m.ObserveSink("clickhouse", "fail", 50, nil)
+	m.ObserveSink("archive", "skip", 50, nil)
+
+	assert.Equal(t, 150.0, testutil.ToFloat64(m.sinkRows.WithLabelValues("clickhouse")))
+	assert.Equal(t, 50.0, testutil.ToFloat64(m.sinkRows.WithLabelValues("archive")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.sinkErrors.WithLabelValues("archive", "skip")))
+	assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(m.sinkLastSave.WithLabelValues("archive")))
+
+	// The archive skipped a batch and is 100 rows behind.
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.sinkLagRows.WithLabelValues("clickhouse")))
+	assert.Equal(t, 100.0, testutil.ToFloat64(m.sinkLagRows.WithLabelValues("archive")))
+}
+
+func TestMetrics_QueueDepth(t *testing.T) {
+	m := New()
+
+	parse := make(chan int, 10)
+	merged := make(chan int, 10)
+	parse <- 1
+	parse <- 2
+	merged <- 3
+	m.ObserveQueue("parse", func() int { return len(parse) })
+	m.ObserveQueue("parse", func() int { return len(merged) })
+	m.ObserveQueue("save", func() int { return 0 })
+
+	expected := `
+# HELP cs2_queue_depth Items buffered in the output channels of a pipeline stage.
+# TYPE cs2_queue_depth gauge
+cs2_queue_depth{stage="parse"} 3
+cs2_queue_depth{stage="save"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "cs2_queue_depth"))
+
+	m.ForgetQueues()
+	count, err := testutil.GatherAndCount(m.Registry(), "cs2_queue_depth")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestMetrics_Stages(t *testing.T) {
+	m := New()
+
+	stopped := m.ObserveStage("save")
+	failed := m.ObserveStage("save")
+	m.ObserveStage("parse")
+	stopped(nil)
+	failed(errors.New("insert failed"))
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.stageRunning.WithLabelValues("save")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stageRunning.WithLabelValues("parse")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stageFailures.WithLabelValues("save")))
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.ObserveFlush(100, 1024, 10*time.Millisecond, nil)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	for _, name := range []string{
+		"cs2_files_discovered",
+		"cs2_files_parsed_total",
+		"cs2_files_failed_total",
+		"cs2_rows_flattened_total",
+		"cs2_batches_saved_total{result=\"ok\"} 1",
+		"cs2_rows_saved_total 100",
+		"cs2_save_duration_seconds_bucket",
+		"cs2_save_retries_total",
+		"cs2_data_lag_seconds",
+		"go_goroutines",
+	} {
+		assert.Contains(t, string(body), name)
+	}
+}
@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// CircuitBreaker opens after threshold consecutive failures and keeps callers
+// of Wait blocked until cooldown has passed, then lets a probe through.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+func WithBreakerThreshold(failures int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.threshold = failures
+	}
+}
+
+func WithBreakerCooldown(cooldown time.Duration) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.cooldown = cooldown
+	}
+}
+
+func NewCircuitBreaker(opts ...CircuitBreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		state:     CircuitClosed,
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	return cb
+}
+
+// Wait blocks while the breaker is open.
+func (cb *CircuitBreaker) Wait(ctx context.Context) error {
+	for {
+		cb.mu.Lock()
+		if cb.state != CircuitOpen {
+			cb.mu.Unlock()
+			return nil
+		}
+		remaining := cb.cooldown - time.Since(cb.openedAt)
+		if remaining <= 0 {
+			cb.state = CircuitHalfOpen
+			cb.mu.Unlock()
+			return nil
+		}
+		cb.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.state = CircuitClosed
+}
+
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	cb := NewCircuitBreaker(
+		WithBreakerThreshold(2),
+		WithBreakerCooldown(time.Hour),
+	)
+
+	assert.Equal(t, CircuitClosed, cb.State())
+
+	cb.Failure()
+	assert.Equal(t, CircuitClosed, cb.State())
+
+	cb.Failure()
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, cb.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestCircuitBreaker_HalfOpenAfterCooldown(t *testing.T) {
+	cb := NewCircuitBreaker(
+		WithBreakerThreshold(1),
+		WithBreakerCooldown(10*time.Millisecond),
+	)
+
+	cb.Failure()
+	require.Equal(t, CircuitOpen, cb.State())
+
+	require.NoError(t, cb.Wait(context.Background()))
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+
+	// A failed probe reopens the breaker immediately.
+	cb.Failure()
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	require.NoError(t, cb.Wait(context.Background()))
+	cb.Success()
+	assert.Equal(t, CircuitClosed, cb.State())
+}
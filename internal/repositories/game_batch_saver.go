@@ -0,0 +1,395 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type GameSaver interface {
+	Save(ctx context.Context, games []types.GameDB) error
+}
+
+// GameBatchObserver is notified after every flush attempt.
+type GameBatchObserver interface {
+	ObserveFlush(rows int, bytes int, latency time.Duration, err error)
+}
+
+type GameBatchStats struct {
+	Flushes      int64
+	FailedFlush  int64
+	Rows         int64
+	Bytes        int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+type GameBatchSaverOption func(*GameBatchSaverRepository)
+
+// GameBatchSaverRepository accumulates rows across Save calls and hands them
+// to the underlying saver once maxRows or maxBytes is reached, or when
+// flushInterval has passed since the last flush. Batches are flushed one at a
+// time, in the order their rows were given.
+//
+// Save returns once the batch holding its rows is flushed, with the error of
+// that flush, so a failed batch is reported to the callers whose rows it held
+// and to no one else. Enqueue lets callers keep several saves in flight.
+type GameBatchSaverRepository struct {
+	saver         GameSaver
+	maxRows       int
+	maxBytes      int
+	flushInterval time.Duration
+	observer      GameBatchObserver
+
+	mu      sync.Mutex
+	current *gameBatch
+	queue   []*gameBatch
+	// flushing is the batch being flushed, if any.
+	flushing *gameBatch
+	// flushed is closed and replaced whenever a batch is flushed.
+	flushed chan struct{}
+	closed  bool
+	stats   GameBatchStats
+
+	// flushCtx is cancelled when Close gives up waiting, to abort the flush
+	// in progress and fail the remaining batches.
+	flushCtx    context.Context
+	cancelFlush context.CancelFunc
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// gameBatch is a batch being accumulated or waiting to be flushed, with the
+// callers waiting for it and links to their spans.
+type gameBatch struct {
+	rows    []types.GameDB
+	bytes   int
+	waiters []chan error
+	links   []trace.Link
+}
+
+// maxQueuedBatches bounds the batches waiting behind the one being flushed.
+// Enqueue waits for room, so reading slows down while the sink is slow.
+const maxQueuedBatches = 1
+
+// ErrBatchSaverClosed is returned for rows given after Close.
+var ErrBatchSaverClosed = errors.New("batch saver closed")
+
+// gameDBRowBytes is the size of a games row in a native insert. Every column
+// is fixed width: 23 Int64 and Float64 stats and ids, begin_at as a 4 byte
+// DateTime, version and ingested_at at 8 bytes, and the nullable length as a
+// null mask byte and its 8 byte value, which is sent even when NULL.
+const gameDBRowBytes = 23*8 + 4 + 8 + 8 + 1 + 8
+
+func WithBatchSaver(saver GameSaver) GameBatchSaverOption {
+	return func(r *GameBatchSaverRepository) {
+		r.saver = saver
+	}
+}
+
+func WithBatchMaxRows(rows int) GameBatchSaverOption {
+	return func(r *GameBatchSaverRepository) {
+		r.maxRows = rows
+	}
+}
+
+// WithBatchMaxBytes flushes a batch once its rows would take this many bytes
+// in a native insert. Rows are fixed width, so this is maxRows expressed as
+// the size of the insert.
+func WithBatchMaxBytes(bytes int) GameBatchSaverOption {
+	return func(r *GameBatchSaverRepository) {
+		r.maxBytes = bytes
+	}
+}
+
+func WithBatchFlushInterval(interval time.Duration) GameBatchSaverOption {
+	return func(r *GameBatchSaverRepository) {
+		r.flushInterval = interval
+	}
+}
+
+func WithBatchObserver(observer GameBatchObserver) GameBatchSaverOption {
+	return func(r *GameBatchSaverRepository) {
+		r.observer = observer
+	}
+}
+
+func NewGameBatchSaverRepository(opts ...GameBatchSaverOption) *GameBatchSaverRepository {
+	repo := &GameBatchSaverRepository{
+		current: &gameBatch{},
+		flushed: make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	repo.flushCtx, repo.cancelFlush = context.WithCancel(context.Background())
+
+	go repo.flushLoop()
+
+	return repo
+}
+
+// Save buffers the rows and waits until the batch holding them is flushed.
+// Without a flush interval, rows below the thresholds wait for Flush or
+// Close.
+func (r *GameBatchSaverRepository) Save(
+	ctx context.Context,
+	games []types.GameDB,
+) error {
+	select {
+	case err := <-r.Enqueue(ctx, games):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue buffers the rows and returns a channel that receives the error of
+// the flush that writes them. It only waits while too many batches are
+// queued. Rows are flushed in the order they are enqueued.
+func (r *GameBatchSaverRepository) Enqueue(
+	ctx context.Context,
+	games []types.GameDB,
+) <-chan error {
+	done := make(chan error, 1)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		done <- ErrBatchSaverClosed
+		return done
+	}
+	if len(games) == 0 {
+		r.mu.Unlock()
+		done <- nil
+		return done
+	}
+	r.current.rows = append(r.current.rows, games...)
+	r.current.bytes += len(games) * gameDBRowBytes
+	r.current.waiters = append(r.current.waiters, done)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.current.links = append(r.current.links, trace.Link{SpanContext: sc})
+	}
+	if r.full() {
+		r.cut()
+	}
+	r.mu.Unlock()
+
+	for {
+		r.mu.Lock()
+		backlog, flushed := len(r.queue), r.flushed
+		r.mu.Unlock()
+		if backlog <= maxQueuedBatches {
+			return done
+		}
+
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			// The rows are buffered; the caller decides whether to wait.
+			return done
+		}
+	}
+}
+
+// Flush writes out whatever is buffered, regardless of the thresholds, and
+// waits for every batch not flushed yet. It returns their errors.
+func (r *GameBatchSaverRepository) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	r.cut()
+	var waits []chan error
+	for _, b := range append([]*gameBatch{r.flushing}, r.queue...) {
+		if b == nil {
+			continue
+		}
+		wait := make(chan error, 1)
+		b.waiters = append(b.waiters, wait)
+		waits = append(waits, wait)
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, wait := range waits {
+		select {
+		case err := <-wait:
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close flushes the remaining rows and stops the flusher. If ctx is done
+// first, the flush in progress is aborted and the batches left fail.
+func (r *GameBatchSaverRepository) Close(ctx context.Context) error {
+	err := r.Flush(ctx)
+	if ctx.Err() != nil {
+		r.cancelFlush()
+	}
+
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+		close(r.stop)
+	})
+	<-r.done
+
+	return err
+}
+
+func (r *GameBatchSaverRepository) Stats() GameBatchStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// flushLoop flushes the queued batches one at a time and, every
+// flushInterval, cuts the current batch. Once stopped, it flushes what is
+// left.
+func (r *GameBatchSaverRepository) flushLoop() {
+	defer close(r.done)
+	defer r.cancelFlush()
+
+	var tick <-chan time.Time
+	if r.flushInterval > 0 {
+		ticker := time.NewTicker(r.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.stop:
+			r.mu.Lock()
+			r.cut()
+			r.mu.Unlock()
+			r.flushQueue()
+			return
+		case <-tick:
+			r.mu.Lock()
+			r.cut()
+			r.mu.Unlock()
+		case <-r.wake:
+		}
+		r.flushQueue()
+	}
+}
+
+func (r *GameBatchSaverRepository) flushQueue() {
+	for {
+		r.mu.Lock()
+		if len(r.queue) == 0 {
+			r.mu.Unlock()
+			return
+		}
+		batch := r.queue[0]
+		r.queue = r.queue[1:]
+		r.flushing = batch
+		r.mu.Unlock()
+
+		err := r.flush(r.flushCtx, batch)
+
+		r.mu.Lock()
+		r.flushing = nil
+		waiters := batch.waiters
+		close(r.flushed)
+		r.flushed = make(chan struct{})
+		r.mu.Unlock()
+
+		for _, w := range waiters {
+			w <- err
+		}
+	}
+}
+
+func (r *GameBatchSaverRepository) full() bool {
+	if r.maxRows > 0 && len(r.current.rows) >= r.maxRows {
+		return true
+	}
+	if r.maxBytes > 0 && r.current.bytes >= r.maxBytes {
+		return true
+	}
+	return r.maxRows <= 0 && r.maxBytes <= 0
+}
+
+// cut queues the current batch for the flusher. The caller holds mu.
+func (r *GameBatchSaverRepository) cut() {
+	if len(r.current.rows) == 0 {
+		return
+	}
+	r.queue = append(r.queue, r.current)
+	r.current = &gameBatch{}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush saves a batch under a span of its own, linked to the spans of the
+// saves whose rows it holds: a batch outlives any one of them.
+func (r *GameBatchSaverRepository) flush(ctx context.Context, b *gameBatch) error {
+	batch := b.rows
+	if len(batch) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "flush batch",
+		trace.WithNewRoot(),
+		trace.WithLinks(b.links...),
+		trace.WithAttributes(tracing.AttrBatchRows.Int(len(batch))),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := r.saver.Save(ctx, batch)
+	latency := time.Since(start)
+	bytes := len(batch) * gameDBRowBytes
+	tracing.RecordError(span, err)
+
+	r.mu.Lock()
+	if err != nil {
+		r.stats.FailedFlush++
+	} else {
+		r.stats.Flushes++
+		r.stats.Rows += int64(len(batch))
+		r.stats.Bytes += int64(bytes)
+	}
+	r.stats.TotalLatency += latency
+	if latency > r.stats.MaxLatency {
+		r.stats.MaxLatency = latency
+	}
+	r.mu.Unlock()
+
+	if r.observer != nil {
+		r.observer.ObserveFlush(len(batch), bytes, latency, err)
+	}
+
+	logger := logging.FromContext(ctx).With(
+		logging.Stage(logging.StageSave),
+		logging.BatchRows(len(batch)),
+		"batch_bytes", bytes,
+		logging.Latency(latency),
+	)
+	if err != nil {
+		logger.Warn("batch flush failed", logging.Err(err))
+	} else {
+		logger.Info("batch flushed")
+	}
+
+	return err
+}
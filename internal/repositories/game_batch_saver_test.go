@@ -0,0 +1,318 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type recordingSaver struct {
+	mu      sync.Mutex
+	batches [][]types.GameDB
+	err     error
+}
+
+func (s *recordingSaver) Save(ctx context.Context, games []types.GameDB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, games)
+	return nil
+}
+
+func (s *recordingSaver) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sizes []int
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+type recordingObserver struct {
+	mu    sync.Mutex
+	rows  []int
+	errs  []error
+	bytes int
+}
+
+func (o *recordingObserver) ObserveFlush(rows int, bytes int, latency time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.rows = append(o.rows, rows)
+	o.bytes += bytes
+	o.errs = append(o.errs, err)
+}
+
+func rows(n int) []types.GameDB {
+	return make([]types.GameDB, n)
+}
+
+func TestGameBatchSaverRepository_FlushThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []GameBatchSaverOption
+		saves    []int
+		expected []int
+		// flushed is the number of saves whose rows were flushed.
+		flushed int
+	}{
+		{
+			name:     "No thresholds passes batches through",
+			saves:    []int{3, 2},
+			expected: []int{3, 2},
+			flushed:  2,
+		},
+		{
+			name:     "Max rows",
+			opts:     []GameBatchSaverOption{WithBatchMaxRows(5)},
+			saves:    []int{2, 2, 2, 4, 1},
+			expected: []int{6, 5},
+			flushed:  5,
+		},
+		{
+			name:     "Max bytes",
+			opts:     []GameBatchSaverOption{WithBatchMaxBytes(3 * gameDBRowBytes)},
+			saves:    []int{1, 1, 1, 5},
+			expected: []int{3, 5},
+			flushed:  4,
+		},
+		{
+			name:     "Below thresholds",
+			opts:     []GameBatchSaverOption{WithBatchMaxRows(100), WithBatchMaxBytes(1 << 20)},
+			saves:    []int{1, 2, 3},
+			expected: nil,
+			flushed:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver := &recordingSaver{}
+			repo := NewGameBatchSaverRepository(append(tt.opts, WithBatchSaver(saver))...)
+
+			var dones []<-chan error
+			for _, n := range tt.saves {
+				dones = append(dones, repo.Enqueue(context.Background(), rows(n)))
+			}
+
+			for _, done := range dones[:tt.flushed] {
+				require.NoError(t, <-done)
+			}
+			assert.Equal(t, tt.expected, saver.sizes())
+
+			// The rows below the thresholds wait for the next flush.
+			for _, done := range dones[tt.flushed:] {
+				select {
+				case <-done:
+					t.Fatal("rows not flushed yet were reported saved")
+				default:
+				}
+			}
+			require.NoError(t, repo.Close(context.Background()))
+			for _, done := range dones[tt.flushed:] {
+				require.NoError(t, <-done)
+			}
+		})
+	}
+}
+
+func TestGameBatchSaverRepository_FlushInterval(t *testing.T) {
+	saver := &recordingSaver{}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(1000),
+		WithBatchFlushInterval(10*time.Millisecond),
+	)
+	defer repo.Close(context.Background())
+
+	// Save returns once the interval flush wrote the rows.
+	require.NoError(t, repo.Save(context.Background(), rows(3)))
+	assert.Equal(t, []int{3}, saver.sizes())
+}
+
+func TestGameBatchSaverRepository_CloseFlushesRemaining(t *testing.T) {
+	saver := &recordingSaver{}
+	observer := &recordingObserver{}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(1000),
+		WithBatchFlushInterval(time.Hour),
+		WithBatchObserver(observer),
+	)
+
+	first := repo.Enqueue(context.Background(), rows(2))
+	second := repo.Enqueue(context.Background(), rows(3))
+	assert.Empty(t, saver.sizes())
+
+	require.NoError(t, repo.Close(context.Background()))
+	assert.Equal(t, []int{5}, saver.sizes())
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-second)
+
+	assert.Equal(t, []int{5}, observer.rows)
+	assert.Equal(t, 5*gameDBRowBytes, observer.bytes)
+
+	stats := repo.Stats()
+	assert.Equal(t, int64(1), stats.Flushes)
+	assert.Equal(t, int64(5), stats.Rows)
+
+	assert.ErrorIs(t, <-repo.Enqueue(context.Background(), rows(1)), ErrBatchSaverClosed)
+}
+
+func TestGameBatchSaverRepository_SaveError(t *testing.T) {
+	saver := &recordingSaver{err: errors.New("insert failed")}
+	observer := &recordingObserver{}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(2),
+		WithBatchObserver(observer),
+	)
+
+	err := repo.Save(context.Background(), rows(2))
+	assert.EqualError(t, err, "insert failed")
+	assert.Equal(t, int64(1), repo.Stats().FailedFlush)
+	assert.EqualError(t, observer.errs[0], "insert failed")
+}
+
+func TestGameBatchSaverRepository_ErrorReturnedToBatchCallersOnly(t *testing.T) {
+	saver := &recordingSaver{err: errors.New("insert failed")}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(1000),
+		WithBatchFlushInterval(10*time.Millisecond),
+	)
+	defer repo.Close(context.Background())
+
+	first := repo.Enqueue(context.Background(), rows(1))
+	second := repo.Enqueue(context.Background(), rows(1))
+	assert.EqualError(t, <-first, "insert failed")
+	assert.EqualError(t, <-second, "insert failed")
+
+	saver.mu.Lock()
+	saver.err = nil
+	saver.mu.Unlock()
+
+	// The next batch is not blamed for the failed one.
+	assert.NoError(t, repo.Save(context.Background(), rows(1)))
+}
+
+// blockingSaver records its batches and blocks until released.
+type blockingSaver struct {
+	recordingSaver
+	release chan struct{}
+	active  atomic.Int32
+	overlap atomic.Bool
+}
+
+func (s *blockingSaver) Save(ctx context.Context, games []types.GameDB) error {
+	if s.active.Add(1) > 1 {
+		s.overlap.Store(true)
+	}
+	defer s.active.Add(-1)
+
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.recordingSaver.Save(ctx, games)
+}
+
+func TestGameBatchSaverRepository_FlushesOneBatchAtATime(t *testing.T) {
+	saver := &blockingSaver{release: make(chan struct{})}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(2),
+	)
+
+	// Enqueue waits while too many batches are behind the flushing one.
+	enqueued := make(chan []<-chan error)
+	go func() {
+		var dones []<-chan error
+		for i := 1; i <= 3; i++ {
+			dones = append(dones, repo.Enqueue(context.Background(), rows(i)))
+		}
+		enqueued <- dones
+	}()
+	close(saver.release)
+
+	for _, done := range <-enqueued {
+		require.NoError(t, <-done)
+	}
+	require.NoError(t, repo.Close(context.Background()))
+	assert.False(t, saver.overlap.Load())
+	assert.Equal(t, []int{3, 3}, saver.sizes())
+}
+
+func TestGameBatchSaverRepository_CloseGivesUpWithContext(t *testing.T) {
+	saver := &blockingSaver{release: make(chan struct{})}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(1000),
+	)
+
+	done := repo.Enqueue(context.Background(), rows(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, repo.Close(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestGameBatchSaverRepository_FlushSpanLinksSaves(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	saver := &recordingSaver{}
+	repo := NewGameBatchSaverRepository(
+		WithBatchSaver(saver),
+		WithBatchMaxRows(1000),
+	)
+
+	var saves []trace.SpanContext
+	var dones []<-chan error
+	for i := 0; i < 2; i++ {
+		ctx, span := tracing.Tracer().Start(context.Background(), "save")
+		saves = append(saves, span.SpanContext())
+		dones = append(dones, repo.Enqueue(ctx, rows(1)))
+		span.End()
+	}
+	require.NoError(t, repo.Close(context.Background()))
+	for _, done := range dones {
+		require.NoError(t, <-done)
+	}
+
+	var flush sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "flush batch" {
+			flush = span
+		}
+	}
+	require.NotNil(t, flush)
+	assert.False(t, flush.Parent().IsValid())
+	assert.Contains(t, flush.Attributes(), tracing.AttrBatchRows.Int(2))
+
+	var linked []trace.SpanContext
+	for _, link := range flush.Links() {
+		linked = append(linked, link.SpanContext)
+	}
+	assert.Equal(t, saves, linked)
+}
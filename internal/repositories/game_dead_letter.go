@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+type GameDeadLetterOption func(*GameDeadLetterRepository)
+
+// GameDeadLetterRepository keeps dead letters in the dead_letters ClickHouse
+// table. Every change inserts a new version of the game's row; a deletion is
+// a row marked deleted.
+type GameDeadLetterRepository struct {
+	db  clickhouse.Conn
+	now func() time.Time
+}
+
+func WithDeadLetterDB(db clickhouse.Conn) GameDeadLetterOption {
+	return func(r *GameDeadLetterRepository) {
+		r.db = db
+	}
+}
+
+func NewGameDeadLetterRepository(opts ...GameDeadLetterOption) *GameDeadLetterRepository {
+	repo := &GameDeadLetterRepository{now: time.Now}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+// Put stores the dead letters of the games, replacing their previous ones,
+// with one INSERT. The attempts carry on from the previous dead letter of
+// each game and are counted by the INSERT itself.
+func (r *GameDeadLetterRepository) Put(ctx context.Context, entries ...types.DeadLetter) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// The entries are sent as columns, zipped back into rows by the query.
+	var (
+		gameIDs  = make([]int64, len(entries))
+		files    = make([]string, len(entries))
+		stages   = make([]string, len(entries))
+		errs     = make([]string, len(entries))
+		failedAt = make([]int64, len(entries))
+		payloads = make([]string, len(entries))
+		size     int
+	)
+	for i, entry := range entries {
+		gameIDs[i] = entry.GameID
+		files[i] = entry.File
+		stages[i] = entry.Stage
+		errs[i] = entry.Error
+		failedAt[i] = entry.FailedAt.UnixMilli()
+		payloads[i] = string(entry.Payload)
+		size += len(entry.File) + len(entry.Error) + len(entry.Payload)
+	}
+
+	// The payloads are part of the query text, which may escape every byte.
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"max_query_size": max(defaultMaxQuerySize, 2*size+defaultMaxQuerySize),
+	}))
+	return r.db.Exec(ctx, putDeadLettersQuery,
+		uint64(r.now().UnixNano()),
+		gameIDs, files, stages, errs, failedAt, payloads,
+		gameIDs, gameIDs,
+	)
+}
+
+// List returns the dead letters ordered by the time they failed.
+func (r *GameDeadLetterRepository) List(ctx context.Context) ([]types.DeadLetter, error) {
+	rows, err := r.db.Query(ctx, listDeadLettersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []types.DeadLetter
+	for rows.Next() {
+		entry, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *GameDeadLetterRepository) Get(ctx context.Context, gameID int64) (*types.DeadLetter, error) {
+	entry, err := scanDeadLetter(r.db.QueryRow(ctx, getDeadLetterQuery, gameID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("game %d: %w", gameID, ErrDeadLetterNotFound)
+	}
+	return entry, err
+}
+
+func (r *GameDeadLetterRepository) Delete(ctx context.Context, gameID int64) error {
+	return r.insert(ctx, types.DeadLetter{GameID: gameID}, true)
+}
+
+func (r *GameDeadLetterRepository) insert(ctx context.Context, entry types.DeadLetter, deleted bool) error {
+	batch, err := r.db.PrepareBatch(ctx, insertDeadLetterQuery)
+	if err != nil {
+		return err
+	}
+
+	var deletedFlag uint8
+	if deleted {
+		deletedFlag = 1
+	}
+	err = batch.Append(
+		entry.GameID,
+		entry.File,
+		entry.Stage,
+		entry.Error,
+		entry.Attempts,
+		entry.FailedAt.UTC(),
+		string(entry.Payload),
+		deletedFlag,
+		uint64(r.now().UnixNano()),
+	)
+	if err != nil {
+		return err
+	}
+	return batch.Send()
+}
+
+type deadLetterScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeadLetter(row deadLetterScanner) (*types.DeadLetter, error) {
+	var entry types.DeadLetter
+	var payload string
+	err := row.Scan(
+		&entry.GameID,
+		&entry.File,
+		&entry.Stage,
+		&entry.Error,
+		&entry.Attempts,
+		&entry.FailedAt,
+		&payload,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entry.Payload = json.RawMessage(payload)
+	return &entry, nil
+}
+
+const insertDeadLetterQuery = `
+INSERT INTO dead_letters (game_id, file, stage, error, attempts, failed_at, payload, deleted, version)
+`
+
+// defaultMaxQuerySize is the max_query_size ClickHouse defaults to.
+const defaultMaxQuerySize = 256 << 10
+
+// putDeadLettersQuery inserts the given dead letters, one attempt on from
+// the stored ones. A game given twice is stored once, with its last entry.
+const putDeadLettersQuery = `
+INSERT INTO dead_letters (game_id, file, stage, error, attempts, failed_at, payload, deleted, version)
+SELECT game_id, file, stage, error, prev.attempts + 1, failed_at, payload, 0, ? + seq
+FROM (
+    SELECT
+        e.1 AS game_id,
+        e.2 AS file,
+        e.3 AS stage,
+        e.4 AS error,
+        fromUnixTimestamp64Milli(e.5, 'UTC') AS failed_at,
+        e.6 AS payload,
+        e.7 AS seq
+    FROM (SELECT arrayJoin(arrayZip(?, ?, ?, ?, ?, ?, arrayEnumerate(?))) AS e)
+) AS entries
+LEFT JOIN (
+    SELECT game_id, attempts
+    FROM dead_letters FINAL
+    WHERE deleted = 0 AND has(?, game_id)
+) AS prev USING game_id
+`
+
+const listDeadLettersQuery = `
+SELECT game_id, file, stage, error, attempts, failed_at, payload
+FROM dead_letters FINAL
+WHERE deleted = 0
+ORDER BY failed_at, game_id
+`
+
+const getDeadLetterQuery = `
+SELECT game_id, file, stage, error, attempts, failed_at, payload
+FROM dead_letters FINAL
+WHERE game_id = ? AND deleted = 0
+`
@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// ErrDeadLetterNotFound is returned for a game that has no dead letter.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+type GameDeadLetterDirOption func(*GameDeadLetterDirRepository)
+
+// GameDeadLetterDirRepository keeps one JSON file per dead-lettered game in
+// a directory, named after the game ID. The files may be edited by hand to
+// correct a payload before replaying it.
+type GameDeadLetterDirRepository struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+func WithDeadLetterDir(dir string) GameDeadLetterDirOption {
+	return func(r *GameDeadLetterDirRepository) {
+		r.dir = dir
+	}
+}
+
+func NewGameDeadLetterDirRepository(opts ...GameDeadLetterDirOption) *GameDeadLetterDirRepository {
+	repo := &GameDeadLetterDirRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+// Put stores the dead letters of the games, replacing their previous ones.
+// The attempts carry on from the previous dead letter of each game.
+func (r *GameDeadLetterDirRepository) Put(ctx context.Context, entries ...types.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := r.put(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *GameDeadLetterDirRepository) put(entry types.DeadLetter) error {
+	prev, err := r.read(r.path(entry.GameID))
+	switch {
+	case err == nil:
+		entry.Attempts = prev.Attempts + 1
+	case errors.Is(err, ErrDeadLetterNotFound):
+		entry.Attempts = 1
+	default:
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path(entry.GameID) + partSuffix
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path(entry.GameID))
+}
+
+// List returns the dead letters ordered by the time they failed.
+func (r *GameDeadLetterDirRepository) List(ctx context.Context) ([]types.DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]types.DeadLetter, 0, len(files))
+	for _, file := range files {
+		entry, err := r.read(file)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	slices.SortFunc(entries, func(a, b types.DeadLetter) int {
+		return cmp.Or(a.FailedAt.Compare(b.FailedAt), cmp.Compare(a.GameID, b.GameID))
+	})
+	return entries, nil
+}
+
+func (r *GameDeadLetterDirRepository) Get(ctx context.Context, gameID int64) (*types.DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read(r.path(gameID))
+}
+
+func (r *GameDeadLetterDirRepository) Delete(ctx context.Context, gameID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := os.Remove(r.path(gameID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (r *GameDeadLetterDirRepository) path(gameID int64) string {
+	return filepath.Join(r.dir, strconv.FormatInt(gameID, 10)+".json")
+}
+
+func (r *GameDeadLetterDirRepository) read(path string) (*types.DeadLetter, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		gameID := strings.TrimSuffix(filepath.Base(path), ".json")
+		return nil, fmt.Errorf("game %s: %w", gameID, ErrDeadLetterNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry types.DeadLetter
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &entry, nil
+}
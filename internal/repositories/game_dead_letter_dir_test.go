@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deadLetter(gameID int64, failedAt time.Time) types.DeadLetter {
+	return types.DeadLetter{
+		GameID:   gameID,
+		File:     "game.json",
+		Stage:    "flatten",
+		Error:    "game has 1 teams, expected 2",
+		FailedAt: failedAt,
+		Payload:  json.RawMessage(fmt.Sprintf(`{"id":%d}`, gameID)),
+	}
+}
+
+func TestGameDeadLetterDirRepository(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "dlq")
+	repo := NewGameDeadLetterDirRepository(WithDeadLetterDir(dir))
+
+	failedAt := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Put(ctx, deadLetter(2, failedAt.Add(time.Minute)), deadLetter(1, failedAt)))
+
+	entries, err := repo.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(1), entries[0].GameID)
+	assert.Equal(t, int64(2), entries[1].GameID)
+	assert.Equal(t, int64(1), entries[0].Attempts)
+	assert.JSONEq(t, `{"id":1}`, string(entries[0].Payload))
+
+	// Failing again replaces the entry and counts the attempt.
+	again := deadLetter(1, failedAt.Add(time.Hour))
+	again.Stage = "save"
+	require.NoError(t, repo.Put(ctx, again))
+
+	entry, err := repo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "save", entry.Stage)
+	assert.Equal(t, int64(2), entry.Attempts)
+	assert.True(t, failedAt.Add(time.Hour).Equal(entry.FailedAt))
+
+	require.NoError(t, repo.Delete(ctx, 1))
+	require.NoError(t, repo.Delete(ctx, 1))
+
+	_, err = repo.Get(ctx, 1)
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+	assert.EqualError(t, err, "game 1: dead letter not found")
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "2.json", files[0].Name())
+}
+
+func TestGameDeadLetterDirRepository_Empty(t *testing.T) {
+	repo := NewGameDeadLetterDirRepository(WithDeadLetterDir(filepath.Join(t.TempDir(), "missing")))
+
+	entries, err := repo.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,60 @@
+package repositories_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameDeadLetterRepository(t *testing.T) {
+	conn, teardown := setupClickHouseContainer(t)
+	defer teardown()
+
+	ctx := context.Background()
+	repo := repositories.NewGameDeadLetterRepository(repositories.WithDeadLetterDB(conn))
+
+	failedAt := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	entry := types.DeadLetter{
+		GameID:   101,
+		File:     "game_1.json",
+		Stage:    "save",
+		Error:    "connection refused",
+		FailedAt: failedAt,
+		Payload:  json.RawMessage(`{"id":101}`),
+	}
+	require.NoError(t, repo.Put(ctx, entry))
+
+	// The games of a failed batch are put together; the attempts carry on
+	// per game.
+	entry.FailedAt = failedAt.Add(time.Hour)
+	other := entry
+	other.GameID = 102
+	other.Payload = json.RawMessage(`{"id":102}`)
+	require.NoError(t, repo.Put(ctx, entry, other))
+
+	entries, err := repo.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(101), entries[0].GameID)
+	assert.Equal(t, int64(2), entries[0].Attempts)
+	assert.True(t, failedAt.Add(time.Hour).Equal(entries[0].FailedAt))
+	assert.JSONEq(t, `{"id":101}`, string(entries[0].Payload))
+	assert.Equal(t, int64(102), entries[1].GameID)
+	assert.Equal(t, int64(1), entries[1].Attempts)
+
+	require.NoError(t, repo.Delete(ctx, 101))
+	require.NoError(t, repo.Delete(ctx, 102))
+
+	_, err = repo.Get(ctx, 101)
+	assert.ErrorIs(t, err, repositories.ErrDeadLetterNotFound)
+
+	entries, err = repo.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
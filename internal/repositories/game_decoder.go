@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// decodeGame decodes a game file. Fields missing from the file keep the
+// defaults documented on types.GameParser, so files written before a field
+// was added still decode. unknown lists the fields of the file GameParser
+// has no field for, as paths such as players[].econ_rating.
+func decodeGame(data []byte) (game *types.GameParser, unknown []string, err error) {
+	game = &types.GameParser{}
+	if err := json.Unmarshal(data, game); err != nil {
+		return nil, nil, err
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	collectUnknownFields(doc, reflect.TypeFor[types.GameParser](), "", seen)
+
+	return game, slices.Sorted(maps.Keys(seen)), nil
+}
+
+// collectUnknownFields walks a decoded JSON value along the Go type it is
+// decoded into and records the object keys the type has no field for.
+func collectUnknownFields(v any, t reflect.Type, path string, unknown map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := jsonFields(t)
+		for key, value := range v {
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				unknown[joinFieldPath(path, key)] = true
+				continue
+			}
+			collectUnknownFields(value, field, joinFieldPath(path, key), unknown)
+		}
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for _, value := range v {
+			collectUnknownFields(value, t.Elem(), path+"[]", unknown)
+		}
+	}
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var jsonFieldsCache sync.Map
+
+// jsonFields maps the JSON names of the fields of a struct type to their
+// types. The names are lowercased, as encoding/json matches them
+// case-insensitively. The fields of an untagged embedded struct are
+// promoted, unless a shallower field has the same name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	if fields, ok := jsonFieldsCache.Load(t); ok {
+		return fields.(map[string]reflect.Type)
+	}
+
+	fields := make(map[string]reflect.Type)
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && name == "" {
+				embedded = append(embedded, ft)
+				continue
+			}
+			if !f.IsExported() && ft.Kind() != reflect.Struct {
+				continue
+			}
+		} else if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	for _, et := range embedded {
+		for name, ft := range jsonFields(et) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
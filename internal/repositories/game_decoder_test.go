@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeGame(t *testing.T) {
+	length := int64(2400)
+
+	tests := []struct {
+		name    string
+		data    string
+		length  *int64
+		unknown []string
+	}{
+		{
+			name: "File predating a field",
+			data: `{"id": 1, "players": [{"player": {"id": 1}}]}`,
+		},
+		{
+			name:   "Added field",
+			data:   `{"id": 1, "length": 2400}`,
+			length: &length,
+		},
+		{
+			name:   "Null added field",
+			data:   `{"id": 1, "length": null}`,
+			length: nil,
+		},
+		{
+			name: "Unknown fields",
+			data: `{
+				"id": 1,
+				"status": "finished",
+				"match": {"serie": {"tier": "a", "year": 2024}},
+				"players": [{"player": {"id": 1, "slug": "a"}}, {"player": {"id": 2, "slug": "b"}, "econ": 1.1}],
+				"rounds": [{"round": 1, "bomb": {"site": "a"}}]
+			}`,
+			unknown: []string{
+				"match.serie.year",
+				"players[].econ",
+				"players[].player.slug",
+				"rounds[].bomb",
+				"status",
+			},
+		},
+		{
+			name: "Keys match case-insensitively",
+			data: `{"ID": 1, "Players": [{"Player": {"Id": 1}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, unknown, err := decodeGame([]byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), game.ID)
+			assert.Equal(t, tt.length, game.Length)
+			assert.Equal(t, tt.unknown, unknown)
+		})
+	}
+}
+
+func TestDecodeGame_Invalid(t *testing.T) {
+	_, _, err := decodeGame([]byte(`{"id": "one"}`))
+	assert.Error(t, err)
+}
+
+func TestJSONFields_Embedded(t *testing.T) {
+	type base struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	type tagged struct {
+		Slug string `json:"slug"`
+	}
+	type game struct {
+		base
+		*tagged `json:"tagged"`
+		Name    int64 `json:"name"`
+		hidden  int64
+	}
+
+	assert.Equal(t, map[string]reflect.Type{
+		"id":     reflect.TypeFor[int64](),
+		"name":   reflect.TypeFor[int64](),
+		"tagged": reflect.TypeFor[*tagged](),
+	}, jsonFields(reflect.TypeFor[game]()))
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"slices"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// deduplicationToken derives an insert_deduplication_token from the game IDs
+// of the rows, their version and a hash of their content. A retried insert
+// carries the same version and is dropped as a duplicate, while a replay
+// saves the game at a newer version and is inserted even if its content has
+// not changed: replay deletes the older rows afterwards. The token only stays
+// the same if the rows are grouped the same way again, which is why it is
+// taken per game (see splitByGame) rather than per batch.
+func deduplicationToken(games []types.GameDB) string {
+	rowHashes := make(map[int64][][sha256.Size]byte)
+	for _, g := range games {
+		rowHashes[g.GameID] = append(rowHashes[g.GameID], hashGameDBRow(g))
+	}
+
+	gameIDs := make([]int64, 0, len(rowHashes))
+	for id := range rowHashes {
+		gameIDs = append(gameIDs, id)
+	}
+	slices.Sort(gameIDs)
+
+	h := sha256.New()
+	for _, id := range gameIDs {
+		hashes := rowHashes[id]
+		slices.SortFunc(hashes, func(a, b [sha256.Size]byte) int {
+			return bytes.Compare(a[:], b[:])
+		})
+
+		content := sha256.New()
+		for _, rh := range hashes {
+			content.Write(rh[:])
+		}
+
+		h.Write(binary.LittleEndian.AppendUint64(nil, uint64(id)))
+		h.Write(content.Sum(nil))
+	}
+
+	return "games-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// splitByGame splits a batch into the rows of each game, in the order the
+// games first appear.
+func splitByGame(games []types.GameDB) [][]types.GameDB {
+	index := make(map[int64]int)
+	var split [][]types.GameDB
+	for _, g := range games {
+		i, ok := index[g.GameID]
+		if !ok {
+			i = len(split)
+			index[g.GameID] = i
+			split = append(split, nil)
+		}
+		split[i] = append(split[i], g)
+	}
+	return split
+}
+
+func hashGameDBRow(g types.GameDB) [sha256.Size]byte {
+	buf := make([]byte, 0, 26*8)
+	buf = binary.LittleEndian.AppendUint64(buf, g.Version)
+	for _, v := range []int64{
+		g.GameID,
+		g.BeginAt.Unix(),
+		g.LeagueID,
+		g.SerieID,
+		g.TierID,
+		g.TournamentID,
+		g.MapID,
+		g.TeamID,
+		g.TeamOpponentID,
+		g.PlayerID,
+		g.PlayerOpponentID,
+		g.Kills,
+		g.Deaths,
+		g.Assists,
+		g.Headshots,
+		g.FlashAssists,
+		g.RoundID,
+		g.RoundOutcomeID,
+		g.RoundWin,
+	} {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+	}
+	for _, v := range []float64{
+		g.KDDiff,
+		g.FirstKillsDiff,
+		g.ADR,
+		g.Kast,
+		g.Rating,
+	} {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+	if g.Length != nil {
+		buf = append(buf, 1)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(*g.Length))
+	}
+	return sha256.Sum256(buf)
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicationToken(t *testing.T) {
+	beginAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	a := types.GameDB{GameID: 1, BeginAt: beginAt, PlayerID: 10, RoundID: 1, Kills: 3, Rating: 1.1}
+	b := types.GameDB{GameID: 1, BeginAt: beginAt, PlayerID: 11, RoundID: 1, Kills: 1, Rating: 0.9}
+	c := types.GameDB{GameID: 2, BeginAt: beginAt, PlayerID: 10, RoundID: 1, Kills: 2, Rating: 1.0}
+
+	token := deduplicationToken([]types.GameDB{a, b, c})
+
+	tests := []struct {
+		name  string
+		games []types.GameDB
+		same  bool
+	}{
+		{
+			name:  "Same rows in another order",
+			games: []types.GameDB{c, b, a},
+			same:  true,
+		},
+		{
+			name: "Different ingestion time",
+			games: func() []types.GameDB {
+				a2 := a
+				a2.IngestedAt = time.Now()
+				return []types.GameDB{a2, b, c}
+			}(),
+			same: true,
+		},
+		{
+			// A replay saves the same content at a newer version.
+			name: "Different version",
+			games: func() []types.GameDB {
+				a2, b2, c2 := a, b, c
+				a2.Version, b2.Version, c2.Version = 7, 7, 7
+				return []types.GameDB{a2, b2, c2}
+			}(),
+			same: false,
+		},
+		{
+			name: "Corrected stat",
+			games: func() []types.GameDB {
+				b2 := b
+				b2.Kills = 2
+				return []types.GameDB{a, b2, c}
+			}(),
+			same: false,
+		},
+		{
+			name:  "Missing game",
+			games: []types.GameDB{a, b},
+			same:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deduplicationToken(tt.games)
+			if tt.same {
+				assert.Equal(t, token, got)
+			} else {
+				assert.NotEqual(t, token, got)
+			}
+		})
+	}
+}
+
+func TestDeduplicationToken_StableAcrossBatches(t *testing.T) {
+	beginAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var games []types.GameDB
+	for id := int64(1); id <= 3; id++ {
+		for player := int64(10); player < 12; player++ {
+			games = append(games, types.GameDB{GameID: id, BeginAt: beginAt, PlayerID: player, Kills: id * player})
+		}
+	}
+
+	tokens := func(batches ...[]types.GameDB) map[int64]string {
+		got := make(map[int64]string)
+		for _, batch := range batches {
+			for _, rows := range splitByGame(batch) {
+				got[rows[0].GameID] = deduplicationToken(rows)
+			}
+		}
+		return got
+	}
+
+	whole := tokens(games)
+	require.Len(t, whole, 3)
+	// The same games, split differently when re-sent after a failure.
+	assert.Equal(t, whole, tokens(games[:2], games[2:]))
+	assert.Equal(t, whole, tokens(games[4:], games[:4]))
+}
+
+func TestSplitByGame(t *testing.T) {
+	a1 := types.GameDB{GameID: 1, PlayerID: 1}
+	a2 := types.GameDB{GameID: 1, PlayerID: 2}
+	b := types.GameDB{GameID: 2}
+
+	assert.Equal(t, [][]types.GameDB{{a1, a2}, {b}}, splitByGame([]types.GameDB{a1, b, a2}))
+	assert.Empty(t, splitByGame(nil))
+}
@@ -0,0 +1,399 @@
+package repositories
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// File formats written by GameFileSaverRepository.
+const (
+	FileFormatJSONL   = "jsonl"
+	FileFormatCSV     = "csv"
+	FileFormatParquet = "parquet"
+)
+
+// File compressions. Parquet files compress their pages instead of the
+// whole stream.
+const (
+	FileCompressionNone = "none"
+	FileCompressionGzip = "gzip"
+	FileCompressionZstd = "zstd"
+)
+
+// partSuffix marks a file that is still being written.
+const partSuffix = ".part"
+
+type GameFileSaverOption func(*GameFileSaverRepository)
+
+// GameFileSaverRepository writes rows to files in a directory, starting a new
+// file once the current one reaches the size or age limit. Files are written
+// under a .part suffix and renamed once complete.
+type GameFileSaverRepository struct {
+	dir         string
+	format      string
+	compression string
+	maxBytes    int64
+	maxAge      time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	current *gameFile
+	seq     int
+}
+
+func WithFileDir(dir string) GameFileSaverOption {
+	return func(r *GameFileSaverRepository) {
+		r.dir = dir
+	}
+}
+
+func WithFileFormat(format string) GameFileSaverOption {
+	return func(r *GameFileSaverRepository) {
+		r.format = format
+	}
+}
+
+func WithFileCompression(compression string) GameFileSaverOption {
+	return func(r *GameFileSaverRepository) {
+		r.compression = compression
+	}
+}
+
+// WithFileMaxBytes rotates the file once this many bytes have been written
+// to it (0 disables).
+func WithFileMaxBytes(n int64) GameFileSaverOption {
+	return func(r *GameFileSaverRepository) {
+		r.maxBytes = n
+	}
+}
+
+// WithFileMaxAge rotates the file once it has been open this long, whether
+// or not more rows come (0 disables).
+func WithFileMaxAge(d time.Duration) GameFileSaverOption {
+	return func(r *GameFileSaverRepository) {
+		r.maxAge = d
+	}
+}
+
+func NewGameFileSaverRepository(opts ...GameFileSaverOption) *GameFileSaverRepository {
+	repo := &GameFileSaverRepository{
+		format:      FileFormatJSONL,
+		compression: FileCompressionNone,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+func (r *GameFileSaverRepository) Save(ctx context.Context, games []types.GameDB) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil && r.maxAge > 0 && r.now().Sub(r.current.openedAt) >= r.maxAge {
+		if err := r.rotate(ctx); err != nil {
+			return err
+		}
+	}
+	if r.current == nil {
+		f, err := r.open()
+		if err != nil {
+			return err
+		}
+		r.current = f
+	}
+
+	if err := r.current.enc.write(games); err != nil {
+		return fmt.Errorf("failed to write %s: %w", r.current.path, err)
+	}
+
+	if r.maxBytes > 0 && r.current.size.n >= r.maxBytes {
+		return r.rotate(ctx)
+	}
+	return nil
+}
+
+// Close completes the current file.
+func (r *GameFileSaverRepository) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate(ctx)
+}
+
+func (r *GameFileSaverRepository) rotate(ctx context.Context) error {
+	if r.current == nil {
+		return nil
+	}
+	f := r.current
+	r.current = nil
+	if f.expire != nil {
+		f.expire.Stop()
+	}
+
+	if err := f.close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", f.path, err)
+	}
+
+	logging.FromContext(ctx).Info("game file written",
+		logging.Stage(logging.StageSave),
+		logging.File(f.path),
+		"bytes", f.size.n,
+	)
+	return nil
+}
+
+func (r *GameFileSaverRepository) open() (*gameFile, error) {
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	now := r.now().UTC()
+	r.seq++
+	name := fmt.Sprintf("games-%s-%04d.%s", now.Format("20060102T150405.000Z"), r.seq, r.format)
+	if ext := compressionExt(r.format, r.compression); ext != "" {
+		name += "." + ext
+	}
+
+	path := filepath.Join(r.dir, name)
+	out, err := os.Create(path + partSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &gameFile{path: path, out: out, size: &countingWriter{w: out}, openedAt: now}
+	if err := f.init(r.format, r.compression); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path + partSuffix)
+		return nil, err
+	}
+
+	// Without more rows, the file would stay open, and unreadable, until
+	// the next write.
+	if r.maxAge > 0 {
+		f.expire = time.AfterFunc(r.maxAge, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.current != f {
+				return
+			}
+			ctx := context.Background()
+			if err := r.rotate(ctx); err != nil {
+				logging.FromContext(ctx).Error("failed to rotate game file", logging.Stage(logging.StageSave), logging.Err(err))
+			}
+		})
+	}
+	return f, nil
+}
+
+func compressionExt(format, compression string) string {
+	if format == FileFormatParquet {
+		return ""
+	}
+	switch compression {
+	case FileCompressionGzip:
+		return "gz"
+	case FileCompressionZstd:
+		return "zst"
+	}
+	return ""
+}
+
+type gameFile struct {
+	path     string
+	out      *os.File
+	size     *countingWriter
+	openedAt time.Time
+	// expire rotates the file once it reaches the age limit.
+	expire *time.Timer
+
+	// closers run in order on close: the encoder, then the compressor.
+	enc     gameEncoder
+	closers []io.Closer
+}
+
+func (f *gameFile) init(format, compression string) error {
+	var w io.Writer = f.size
+
+	if format != FileFormatParquet {
+		switch compression {
+		case FileCompressionNone, "":
+		case FileCompressionGzip:
+			gz := gzip.NewWriter(w)
+			f.closers = append(f.closers, gz)
+			w = gz
+		case FileCompressionZstd:
+			zw, err := zstd.NewWriter(w)
+			if err != nil {
+				return err
+			}
+			f.closers = append(f.closers, zw)
+			w = zw
+		default:
+			return fmt.Errorf("unknown file compression %q", compression)
+		}
+	}
+
+	switch format {
+	case FileFormatJSONL:
+		f.enc = &jsonlEncoder{enc: json.NewEncoder(w)}
+	case FileFormatCSV:
+		f.enc = &csvEncoder{w: csv.NewWriter(w)}
+	case FileFormatParquet:
+		codec, err := parquetCodec(compression)
+		if err != nil {
+			return err
+		}
+		f.enc = &parquetEncoder{w: parquet.NewGenericWriter[types.GameDB](w, parquet.Compression(codec))}
+	default:
+		return fmt.Errorf("unknown file format %q", format)
+	}
+
+	f.closers = append([]io.Closer{f.enc}, f.closers...)
+	return nil
+}
+
+func (f *gameFile) close() error {
+	for _, c := range f.closers {
+		if err := c.Close(); err != nil {
+			_ = f.out.Close()
+			return err
+		}
+	}
+	if err := f.out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.path+partSuffix, f.path)
+}
+
+func parquetCodec(compression string) (compress.Codec, error) {
+	switch compression {
+	case FileCompressionNone, "":
+		return &parquet.Uncompressed, nil
+	case FileCompressionGzip:
+		return &parquet.Gzip, nil
+	case FileCompressionZstd:
+		return &parquet.Zstd, nil
+	}
+	return nil, fmt.Errorf("unknown file compression %q", compression)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type gameEncoder interface {
+	write(games []types.GameDB) error
+	Close() error
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) write(games []types.GameDB) error {
+	for _, g := range games {
+		if err := e.enc.Encode(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonlEncoder) Close() error { return nil }
+
+// csvEncoder writes a header with the games column names, then one record
+// per row in the same order.
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) write(games []types.GameDB) error {
+	if !e.header {
+		names := make([]string, len(gameColumns))
+		for i, c := range gameColumns {
+			names[i] = c.Name
+		}
+		if err := e.w.Write(names); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	record := make([]string, len(gameColumns))
+	for _, g := range games {
+		for i, v := range gameDBValues(g) {
+			record[i] = formatCSVValue(v)
+		}
+		if err := e.w.Write(record); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func formatCSVValue(v any) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case *int64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatInt(*v, 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// parquetEncoder writes one row group per Save.
+type parquetEncoder struct {
+	w *parquet.GenericWriter[types.GameDB]
+}
+
+func (e *parquetEncoder) write(games []types.GameDB) error {
+	if _, err := e.w.Write(games); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *parquetEncoder) Close() error { return e.w.Close() }
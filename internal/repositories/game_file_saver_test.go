@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fileSaverGames(n int) []types.GameDB {
+	beginAt := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	games := make([]types.GameDB, n)
+	for i := range games {
+		games[i] = types.GameDB{
+			GameID:     int64(100 + i),
+			BeginAt:    beginAt,
+			Kills:      int64(i),
+			ADR:        85.25,
+			Version:    uint64(i),
+			IngestedAt: beginAt.Add(time.Minute),
+		}
+		// Games read from files predating a field have no value for it.
+		if i%2 == 1 {
+			length := int64(1800 + i)
+			games[i].Length = &length
+		}
+	}
+	return games
+}
+
+func TestGameFileSaverRepository_Formats(t *testing.T) {
+	tests := []struct {
+		format      string
+		compression string
+		name        string
+	}{
+		{format: FileFormatJSONL, compression: FileCompressionNone, name: ".jsonl"},
+		{format: FileFormatJSONL, compression: FileCompressionGzip, name: ".jsonl.gz"},
+		{format: FileFormatCSV, compression: FileCompressionZstd, name: ".csv.zst"},
+		{format: FileFormatCSV, compression: FileCompressionNone, name: ".csv"},
+		{format: FileFormatParquet, compression: FileCompressionZstd, name: ".parquet"},
+		{format: FileFormatParquet, compression: FileCompressionNone, name: ".parquet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.compression, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			repo := NewGameFileSaverRepository(
+				WithFileDir(dir),
+				WithFileFormat(tt.format),
+				WithFileCompression(tt.compression),
+			)
+
+			games := fileSaverGames(3)
+			require.NoError(t, repo.Save(ctx, games[:2]))
+			require.NoError(t, repo.Save(ctx, games[2:]))
+
+			// Nothing is complete before Close.
+			matches, err := filepath.Glob(filepath.Join(dir, "*"+tt.name))
+			require.NoError(t, err)
+			assert.Empty(t, matches)
+
+			require.NoError(t, repo.Close(ctx))
+
+			matches, err = filepath.Glob(filepath.Join(dir, "*"))
+			require.NoError(t, err)
+			require.Len(t, matches, 1)
+			assert.Regexp(t, `^games-\d{8}T\d{6}\.\d{3}Z-0001`+regexp.QuoteMeta(tt.name)+`$`, filepath.Base(matches[0]))
+
+			assert.Equal(t, games, readGameFileRows(t, matches[0], tt.format, tt.compression))
+		})
+	}
+}
+
+func TestGameFileSaverRepository_RotatesBySize(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := NewGameFileSaverRepository(WithFileDir(dir), WithFileMaxBytes(1))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repo.Save(ctx, fileSaverGames(1)))
+	}
+	require.NoError(t, repo.Close(ctx))
+
+	matches, err := filepath.Glob(filepath.Join(dir, "games-*.jsonl"))
+	require.NoError(t, err)
+	assert.Len(t, matches, 3)
+}
+
+func TestGameFileSaverRepository_RotatesByAge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	repo := NewGameFileSaverRepository(WithFileDir(dir), WithFileFormat(FileFormatCSV), WithFileMaxAge(time.Hour))
+	repo.now = func() time.Time { return now }
+
+	require.NoError(t, repo.Save(ctx, fileSaverGames(1)))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, repo.Save(ctx, fileSaverGames(1)))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, repo.Save(ctx, fileSaverGames(1)))
+	require.NoError(t, repo.Close(ctx))
+
+	first := readGameFileRows(t, filepath.Join(dir, "games-20240301T000000.000Z-0001.csv"), FileFormatCSV, FileCompressionNone)
+	second := readGameFileRows(t, filepath.Join(dir, "games-20240301T010000.000Z-0002.csv"), FileFormatCSV, FileCompressionNone)
+	assert.Len(t, first, 2)
+	assert.Len(t, second, 1)
+}
+
+func TestGameFileSaverRepository_RotatesByAgeWithoutWrites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := NewGameFileSaverRepository(WithFileDir(dir), WithFileFormat(FileFormatCSV), WithFileMaxAge(10*time.Millisecond))
+
+	require.NoError(t, repo.Save(ctx, fileSaverGames(2)))
+
+	// The file is completed once old enough, with no write to notice it.
+	assert.Eventually(t, func() bool {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.csv"))
+		return len(matches) == 1
+	}, time.Second, time.Millisecond)
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+partSuffix))
+	assert.Empty(t, matches)
+	require.NoError(t, repo.Close(ctx))
+}
+
+func TestGameFileSaverRepository_UnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	repo := NewGameFileSaverRepository(WithFileDir(dir), WithFileFormat("xlsx"))
+
+	err := repo.Save(context.Background(), fileSaverGames(1))
+	assert.EqualError(t, err, `unknown file format "xlsx"`)
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Empty(t, matches)
+}
+
+func readGameFileRows(t *testing.T, path, format, compression string) []types.GameDB {
+	t.Helper()
+
+	if format == FileFormatParquet {
+		rows, err := parquet.ReadFile[types.GameDB](path)
+		require.NoError(t, err)
+		for i := range rows {
+			rows[i].BeginAt = rows[i].BeginAt.UTC()
+			rows[i].IngestedAt = rows[i].IngestedAt.UTC()
+		}
+		return rows
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	var r io.Reader = f
+	switch compression {
+	case FileCompressionGzip:
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		r = gz
+	case FileCompressionZstd:
+		zr, err := zstd.NewReader(f)
+		require.NoError(t, err)
+		t.Cleanup(zr.Close)
+		r = zr
+	}
+
+	var games []types.GameDB
+	if format == FileFormatJSONL {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var g types.GameDB
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &g))
+			games = append(games, g)
+		}
+		require.NoError(t, scanner.Err())
+		return games
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, "game_id", records[0][0])
+	for _, record := range records[1:] {
+		// Decode through JSON to reuse the column names as keys.
+		row := make(map[string]any, len(record))
+		for i, c := range gameColumns {
+			switch {
+			case record[i] == "":
+				row[c.Name] = nil
+			case c.Type == "DateTime" || c.Type == "DateTime64(3)":
+				row[c.Name] = record[i]
+			default:
+				row[c.Name] = json.Number(record[i])
+			}
+		}
+		data, err := json.Marshal(row)
+		require.NoError(t, err)
+		var g types.GameDB
+		require.NoError(t, json.Unmarshal(data, &g))
+		games = append(games, g)
+	}
+	return games
+}
@@ -2,22 +2,72 @@ package repositories
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
 	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type GameParserOption func(*GameParserRepository)
 
+// ErrInvalidGameFile is returned by Next for a file that is not a valid game,
+// or could not be read, for example because it was removed after the scan;
+// the next call moves on to the next file.
+var ErrInvalidGameFile = errors.New("invalid game file")
+
+// GameParserObserver is notified after every directory scan and every file
+// read.
+type GameParserObserver interface {
+	ObserveScan(files int)
+	ObserveFile(path string, err error)
+	// ObserveUnknownFields is called for a decoded file with fields that
+	// GameParser has no field for.
+	ObserveUnknownFields(path string, fields []string)
+}
+
+// GameParserStats counts the files handed out by the repository. Scanned is
+// the number of files found by the last directory scan.
+type GameParserStats struct {
+	Files   int64
+	Failed  int64
+	Scanned int64
+}
+
 type GameParserRepository struct {
-	pathToDir string
-	mu        sync.RWMutex
-	files     []string
-	index     int
+	pathToDir    string
+	singlePass   bool
+	pollInterval time.Duration
+	strict       bool
+	skip         func(path string) bool
+	observer     GameParserObserver
+	mu           sync.RWMutex
+	files        []string
+	index        int
+	done         bool
+	stats        GameParserStats
+
+	// unknownFields holds the unknown fields already logged.
+	unknownFields sync.Map
+
+	// Used when polling: the stamps of the files found by the last scan and
+	// of every file already handed out.
+	scanned bool
+	stamps  map[string]fileStamp
+	seen    map[string]fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime int64
 }
 
 func WithPathToDir(path string) GameParserOption {
@@ -26,10 +76,51 @@ func WithPathToDir(path string) GameParserOption {
 	}
 }
 
+// WithSinglePass makes Next return io.EOF once every file in the directory
+// has been read, instead of starting over from the first one.
+func WithSinglePass() GameParserOption {
+	return func(r *GameParserRepository) {
+		r.singlePass = true
+	}
+}
+
+// WithPollInterval makes Next read every file once and then rescan the
+// directory every interval, returning only files that are new or changed
+// since they were read.
+func WithPollInterval(interval time.Duration) GameParserOption {
+	return func(r *GameParserRepository) {
+		r.pollInterval = interval
+	}
+}
+
+// WithStrictDecode rejects the files with fields GameParser has no field
+// for as invalid. Otherwise they are decoded and the fields reported.
+func WithStrictDecode(strict bool) GameParserOption {
+	return func(r *GameParserRepository) {
+		r.strict = strict
+	}
+}
+
+// WithSkipFile makes Next pass over the files skip returns true for without
+// reading them.
+func WithSkipFile(skip func(path string) bool) GameParserOption {
+	return func(r *GameParserRepository) {
+		r.skip = skip
+	}
+}
+
+func WithParserObserver(observer GameParserObserver) GameParserOption {
+	return func(r *GameParserRepository) {
+		r.observer = observer
+	}
+}
+
 func NewGameParserRepository(opts ...GameParserOption) *GameParserRepository {
 	repo := &GameParserRepository{
-		files: make([]string, 0),
-		index: 0,
+		files:  make([]string, 0),
+		index:  0,
+		stamps: make(map[string]fileStamp),
+		seen:   make(map[string]fileStamp),
 	}
 
 	for _, opt := range opts {
@@ -40,13 +131,116 @@ func NewGameParserRepository(opts ...GameParserOption) *GameParserRepository {
 }
 
 func (repo *GameParserRepository) Next(ctx context.Context) (*types.GameParser, error) {
+	filePath, err := repo.nextFile(ctx)
+	for err == nil && repo.skip != nil && repo.skip(filePath) {
+		filePath, err = repo.nextFile(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "read game file",
+		trace.WithAttributes(tracing.AttrFile.String(filePath)),
+	)
+	defer span.End()
+
+	game, unknown, size, err := readGameFile(filePath)
+	if err == nil && len(unknown) > 0 && repo.strict {
+		err = fmt.Errorf("%s: %w: unknown fields %s", filePath, ErrInvalidGameFile, strings.Join(unknown, ", "))
+	}
+	span.SetAttributes(tracing.AttrFileSize.Int(size))
+	repo.countFile(err)
+	if repo.observer != nil {
+		repo.observer.ObserveFile(filePath, err)
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	if len(unknown) > 0 {
+		repo.reportUnknownFields(ctx, filePath, unknown)
+	}
+
+	game.File = filePath
+
+	logging.FromContext(ctx).Debug("game file decoded",
+		logging.Stage(logging.StageParse),
+		logging.File(filePath),
+		logging.GameID(int64(game.ID)),
+	)
+
+	return game, nil
+}
+
+// readGameFile decodes a game file and also returns its unknown fields and
+// its size in bytes.
+func readGameFile(filePath string) (*types.GameParser, []string, int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("%s: %w: %w", filePath, ErrInvalidGameFile, err)
+	}
+
+	game, unknown, err := decodeGame(data)
+	if err != nil {
+		return nil, nil, len(data), fmt.Errorf("%s: %w: %w", filePath, ErrInvalidGameFile, err)
+	}
+	game.Raw = data
+
+	return game, unknown, len(data), nil
+}
+
+// reportUnknownFields notifies the observer of every file with unknown
+// fields, but logs each field only the first time it is seen.
+func (repo *GameParserRepository) reportUnknownFields(ctx context.Context, filePath string, unknown []string) {
+	if repo.observer != nil {
+		repo.observer.ObserveUnknownFields(filePath, unknown)
+	}
+
+	for _, field := range unknown {
+		if _, seen := repo.unknownFields.LoadOrStore(field, true); !seen {
+			logging.FromContext(ctx).Warn("game file has a field that is not decoded",
+				logging.Stage(logging.StageParse),
+				logging.File(filePath),
+				"field", field,
+			)
+		}
+	}
+}
+
+func (repo *GameParserRepository) Stats() GameParserStats {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return repo.stats
+}
+
+func (repo *GameParserRepository) countFile(err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.stats.Files++
+	if err != nil {
+		repo.stats.Failed++
+	}
+}
+
+func (repo *GameParserRepository) nextFile(ctx context.Context) (string, error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
 
+	if repo.done {
+		return "", io.EOF
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if repo.pollInterval > 0 {
+		return repo.nextPolledFile(ctx)
+	}
+
 	if len(repo.files) == 0 || repo.index == 0 {
 		entries, err := os.ReadDir(repo.pathToDir)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
 		repo.files = repo.files[:0]
@@ -55,24 +249,91 @@ func (repo *GameParserRepository) Next(ctx context.Context) (*types.GameParser,
 				repo.files = append(repo.files, filepath.Join(repo.pathToDir, entry.Name()))
 			}
 		}
+		repo.stats.Scanned = int64(len(repo.files))
+		if repo.observer != nil {
+			repo.observer.ObserveScan(len(repo.files))
+		}
 
 		if len(repo.files) == 0 {
-			return nil, errors.New("no games found in directory")
+			if repo.singlePass {
+				repo.done = true
+				return "", io.EOF
+			}
+			return "", errors.New("no games found in directory")
 		}
 	}
 
 	filePath := repo.files[repo.index]
 	repo.index = (repo.index + 1) % len(repo.files)
+	if repo.singlePass && repo.index == 0 {
+		repo.done = true
+	}
 
-	data, err := os.ReadFile(filePath)
+	return filePath, nil
+}
+
+// nextPolledFile hands out the files of the last scan and, once they are all
+// taken, waits for the poll interval and scans again. The lock is held while
+// waiting, so the other callers wait for the same scan.
+func (repo *GameParserRepository) nextPolledFile(ctx context.Context) (string, error) {
+	for repo.index >= len(repo.files) {
+		if repo.scanned {
+			timer := time.NewTimer(repo.pollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return "", ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err := repo.scan(); err != nil {
+			return "", err
+		}
+	}
+
+	filePath := repo.files[repo.index]
+	repo.index++
+	repo.seen[filePath] = repo.stamps[filePath]
+
+	return filePath, nil
+}
+
+// scan lists the files that were not handed out yet, or changed since.
+func (repo *GameParserRepository) scan() error {
+	entries, err := os.ReadDir(repo.pathToDir)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var game types.GameParser
-	if err := json.Unmarshal(data, &game); err != nil {
-		return nil, err
+	repo.files = repo.files[:0]
+	repo.index = 0
+	repo.scanned = true
+	clear(repo.stamps)
+
+	var found int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the directory was read.
+			continue
+		}
+		found++
+
+		filePath := filepath.Join(repo.pathToDir, entry.Name())
+		stamp := fileStamp{size: info.Size(), modTime: info.ModTime().UnixNano()}
+		if seen, ok := repo.seen[filePath]; ok && seen == stamp {
+			continue
+		}
+		repo.stamps[filePath] = stamp
+		repo.files = append(repo.files, filePath)
+	}
+	repo.stats.Scanned = int64(found)
+	if repo.observer != nil {
+		repo.observer.ObserveScan(found)
 	}
 
-	return &game, nil
+	return nil
 }
@@ -2,11 +2,20 @@ package repositories
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/sbilibin2017/cs2/internal/tracing"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestGameParserRepository_Next(t *testing.T) {
@@ -37,6 +46,7 @@ func TestGameParserRepository_Next(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, game)
 	require.Equal(t, int64(1), game.ID)
+	require.Equal(t, gameJSON1, string(game.Raw))
 
 	// 2nd call: should return second game
 	game, err = repo.Next(ctx)
@@ -76,3 +86,242 @@ func TestGameParserRepository_Next_InvalidJSON(t *testing.T) {
 	_, err = repo.Next(ctx)
 	require.Error(t, err)
 }
+
+func TestGameParserRepository_Next_Concurrent(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	for i := 1; i <= 4; i++ {
+		gameJSON := fmt.Sprintf(`{"id": %d, "begin_at": "2023-01-01T00:00:00Z"}`, i)
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("game%d.json", i)), []byte(gameJSON), 0644)
+		require.NoError(t, err)
+	}
+
+	repo := NewGameParserRepository(WithPathToDir(dir))
+
+	var (
+		mu  sync.Mutex
+		ids []int64
+		wg  sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			game, err := repo.Next(ctx)
+			require.NoError(t, err)
+			mu.Lock()
+			ids = append(ids, game.ID)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	require.ElementsMatch(t, []int64{1, 2, 3, 4}, ids)
+}
+
+func TestGameParserRepository_Next_SinglePass(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "game1.json"), []byte(`{"id": 1}`), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "game2.json"), []byte(`not valid json`), 0644)
+	require.NoError(t, err)
+
+	repo := NewGameParserRepository(WithPathToDir(dir), WithSinglePass())
+
+	game, err := repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), game.ID)
+
+	_, err = repo.Next(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "game2.json")
+
+	_, err = repo.Next(ctx)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestGameParserRepository_Next_FileRemovedAfterScan(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game1.json"), []byte(`{"id": 1}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game2.json"), []byte(`{"id": 2}`), 0644))
+
+	repo := NewGameParserRepository(WithPathToDir(dir), WithSinglePass())
+
+	game, err := repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), game.ID)
+
+	// The file is gone by the time it is read: it is skipped like an
+	// invalid one.
+	require.NoError(t, os.Remove(filepath.Join(dir, "game2.json")))
+	_, err = repo.Next(ctx)
+	require.ErrorIs(t, err, ErrInvalidGameFile)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = repo.Next(ctx)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestGameParserRepository_Next_SkipFile(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	for i, data := range []string{`{"id": 1}`, `not valid json`, `{"id": 3}`} {
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("game%d.json", i+1)), []byte(data), 0644)
+		require.NoError(t, err)
+	}
+
+	repo := NewGameParserRepository(WithPathToDir(dir), WithSinglePass(), WithSkipFile(func(path string) bool {
+		return filepath.Base(path) != "game3.json"
+	}))
+
+	game, err := repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), game.ID)
+
+	_, err = repo.Next(ctx)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, GameParserStats{Files: 1, Scanned: 3}, repo.Stats())
+}
+
+func TestGameParserRepository_Next_SinglePassEmptyDir(t *testing.T) {
+	repo := NewGameParserRepository(WithPathToDir(t.TempDir()), WithSinglePass())
+
+	_, err := repo.Next(context.Background())
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestGameParserRepository_Next_Poll(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game1.json"), []byte(`{"id": 1}`), 0644))
+
+	repo := NewGameParserRepository(WithPathToDir(dir), WithPollInterval(10*time.Millisecond))
+
+	game, err := repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), game.ID)
+
+	// Files already read are skipped by the next scans; new ones are picked up.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game2.json"), []byte(`{"id": 2}`), 0644))
+	game, err = repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), game.ID)
+
+	// A changed file is read again.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game1.json"), []byte(`{"id": 11}`), 0644))
+	game, err = repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), game.ID)
+
+	require.Equal(t, GameParserStats{Files: 3, Scanned: 2}, repo.Stats())
+}
+
+func TestGameParserRepository_Next_PollCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	repo := NewGameParserRepository(WithPathToDir(t.TempDir()), WithPollInterval(time.Hour))
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := repo.Next(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+type recordingParserObserver struct {
+	scans   []int
+	parsed  []string
+	failed  []string
+	unknown map[string][]string
+}
+
+func (o *recordingParserObserver) ObserveScan(files int) {
+	o.scans = append(o.scans, files)
+}
+
+func (o *recordingParserObserver) ObserveFile(path string, err error) {
+	if err != nil {
+		o.failed = append(o.failed, filepath.Base(path))
+		return
+	}
+	o.parsed = append(o.parsed, filepath.Base(path))
+}
+
+func (o *recordingParserObserver) ObserveUnknownFields(path string, fields []string) {
+	if o.unknown == nil {
+		o.unknown = make(map[string][]string)
+	}
+	o.unknown[filepath.Base(path)] = fields
+}
+
+func TestGameParserRepository_Next_UnknownFields(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game1.json"),
+		[]byte(`{"id": 1, "forfeit": false, "players": [{"player": {"id": 1, "nationality": "FR"}}]}`), 0644))
+
+	observer := &recordingParserObserver{}
+	repo := NewGameParserRepository(WithPathToDir(dir), WithSinglePass(), WithParserObserver(observer))
+
+	game, err := repo.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), game.ID)
+	require.Equal(t, map[string][]string{
+		"game1.json": {"forfeit", "players[].player.nationality"},
+	}, observer.unknown)
+
+	repo = NewGameParserRepository(WithPathToDir(dir), WithSinglePass(), WithStrictDecode(true))
+
+	_, err = repo.Next(ctx)
+	require.ErrorIs(t, err, ErrInvalidGameFile)
+	require.ErrorContains(t, err, "unknown fields forfeit, players[].player.nationality")
+}
+
+func TestGameParserRepository_Next_Observer(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game1.json"), []byte(`{"id": 1}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "game2.json"), []byte(`not valid json`), 0644))
+
+	observer := &recordingParserObserver{}
+	repo := NewGameParserRepository(WithPathToDir(dir), WithSinglePass(), WithParserObserver(observer))
+
+	for {
+		if _, err := repo.Next(ctx); err == io.EOF {
+			break
+		}
+	}
+
+	require.Equal(t, []int{2}, observer.scans)
+	require.Equal(t, []string{"game1.json"}, observer.parsed)
+	require.Equal(t, []string{"game2.json"}, observer.failed)
+}
+
+func TestGameParserRepository_Next_Span(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "game1.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"id": 1}`), 0644))
+
+	repo := NewGameParserRepository(WithPathToDir(dir), WithSinglePass())
+	_, err := repo.Next(context.Background())
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "read game file", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), tracing.AttrFile.String(path))
+	require.Contains(t, spans[0].Attributes(), tracing.AttrFileSize.Int(9))
+}
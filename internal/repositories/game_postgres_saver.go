@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type GamePostgresSaverOption func(*GamePostgresSaverRepository)
+
+// GamePostgresSaverRepository bulk loads rows into the Postgres games table
+// with COPY, then upserts them on the sort key.
+type GamePostgresSaverRepository struct {
+	pool *pgxpool.Pool
+}
+
+func WithPostgresPool(pool *pgxpool.Pool) GamePostgresSaverOption {
+	return func(r *GamePostgresSaverRepository) {
+		r.pool = pool
+	}
+}
+
+func NewGamePostgresSaverRepository(opts ...GamePostgresSaverOption) *GamePostgresSaverRepository {
+	repo := &GamePostgresSaverRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+// Save copies the games into a temporary table and merges them into games
+// in one transaction, so a failed batch leaves nothing behind.
+func (r *GamePostgresSaverRepository) Save(
+	ctx context.Context,
+	games []types.GameDB,
+) (err error) {
+	if len(games) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "postgres copy",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrDBSystem.String("postgresql"),
+			tracing.AttrDBOperation.String("COPY"),
+			tracing.AttrDBCollection.String("games"),
+			tracing.AttrBatchRows.Int(len(games)),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createGamesLoadQuery); err != nil {
+		return err
+	}
+
+	columns := make([]string, len(gameColumns))
+	for i, c := range gameColumns {
+		columns[i] = c.Name
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"games_load"}, columns,
+		pgx.CopyFromSlice(len(games), func(i int) ([]any, error) {
+			return sqlGameValues(games[i]), nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy games: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, mergeGamesLoadQuery)
+	if err != nil {
+		return fmt.Errorf("failed to merge games: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Debug("batch copied",
+		logging.Stage(logging.StageSave),
+		logging.BatchRows(len(games)),
+		"upserted", tag.RowsAffected(),
+	)
+
+	return nil
+}
+
+const createGamesLoadQuery = "CREATE TEMP TABLE games_load (LIKE games) ON COMMIT DROP"
+
+// mergeGamesLoadQuery keeps the highest version per key within the batch
+// first, as one INSERT cannot update the same row twice.
+var mergeGamesLoadQuery = "INSERT INTO games (" + gameColumnNames + ")" +
+	" SELECT DISTINCT ON (" + strings.Join(gameSortKey, ", ") + ") " + gameColumnNames +
+	" FROM games_load" +
+	" ORDER BY " + strings.Join(gameSortKey, ", ") + ", version DESC " +
+	gameUpsertClause
@@ -0,0 +1,87 @@
+package repositories_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func setupPostgresContainer(t *testing.T) (*pgxpool.Pool, func()) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:16-alpine",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "cs2",
+			"POSTGRES_PASSWORD": "cs2",
+			"POSTGRES_DB":       "cs2",
+		},
+		WaitingFor: wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+	}
+
+	postgresC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+
+	host, err := postgresC.Host(ctx)
+	require.NoError(t, err)
+	port, err := postgresC.MappedPort(ctx, "5432")
+	require.NoError(t, err)
+
+	pool, err := pgxpool.New(ctx, fmt.Sprintf("postgres://cs2:cs2@%s:%s/cs2?sslmode=disable", host, port.Port()))
+	require.NoError(t, err)
+
+	for _, stmt := range migrationUpStatements(t, "../../migrations/postgres") {
+		_, err := pool.Exec(ctx, stmt)
+		require.NoError(t, err)
+	}
+
+	teardown := func() {
+		pool.Close()
+		_ = postgresC.Terminate(ctx)
+	}
+
+	return pool, teardown
+}
+
+func TestGamePostgresSaverRepository_Save(t *testing.T) {
+	ctx := context.Background()
+	pool, teardown := setupPostgresContainer(t)
+	defer teardown()
+
+	repo := repositories.NewGamePostgresSaverRepository(repositories.WithPostgresPool(pool))
+
+	games := upsertGames()
+	require.NoError(t, repo.Save(ctx, games))
+
+	older := games[0]
+	older.Kills = 1
+	older.Version = 0
+	require.NoError(t, repo.Save(ctx, []types.GameDB{older}))
+
+	rows, err := pool.Query(ctx, "SELECT player_id, kills, version FROM games ORDER BY player_id")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var actual [][3]int64
+	for rows.Next() {
+		var r [3]int64
+		require.NoError(t, rows.Scan(&r[0], &r[1], &r[2]))
+		actual = append(actual, r)
+	}
+	require.NoError(t, rows.Err())
+
+	assert.Equal(t, [][3]int64{{90, 7, 2}, {91, 5, 1}}, actual)
+}
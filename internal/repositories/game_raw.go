@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type GameRawOption func(*GameRawRepository)
+
+// GameRawRepository keeps the source games verbatim in the games_raw
+// ClickHouse table. A game read again with the same content replaces its
+// previous copy; a changed game is kept next to it.
+type GameRawRepository struct {
+	db    clickhouse.Conn
+	retry *GameRetrySaverRepository
+}
+
+func WithRawDB(db clickhouse.Conn) GameRawOption {
+	return func(r *GameRawRepository) {
+		r.db = db
+	}
+}
+
+// WithRawRetry shares the retry of the games sink, so an open breaker stops
+// raw inserts too.
+func WithRawRetry(retry *GameRetrySaverRepository) GameRawOption {
+	return func(r *GameRawRepository) {
+		r.retry = retry
+	}
+}
+
+func NewGameRawRepository(opts ...GameRawOption) *GameRawRepository {
+	repo := &GameRawRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+// Verify checks that the games_raw table exists.
+func (r *GameRawRepository) Verify(ctx context.Context) error {
+	var exists uint8
+	if err := r.db.QueryRow(ctx, "EXISTS TABLE games_raw").Scan(&exists); err != nil {
+		return fmt.Errorf("failed to read games_raw schema: %w", err)
+	}
+	if exists == 0 {
+		return errors.New("table games_raw does not exist, run migrations first")
+	}
+	return nil
+}
+
+// Save inserts the games in one batch, retrying it if given a retry.
+func (r *GameRawRepository) Save(ctx context.Context, games []types.GameRaw) error {
+	if len(games) == 0 {
+		return nil
+	}
+	if r.retry != nil {
+		return r.retry.Do(ctx, len(games), func(ctx context.Context) error {
+			return r.save(ctx, games)
+		})
+	}
+	return r.save(ctx, games)
+}
+
+func (r *GameRawRepository) save(ctx context.Context, games []types.GameRaw) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "clickhouse insert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrDBSystem.String("clickhouse"),
+			tracing.AttrDBOperation.String("INSERT"),
+			tracing.AttrDBCollection.String("games_raw"),
+			tracing.AttrBatchRows.Int(len(games)),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	batch, err := r.db.PrepareBatch(ctx, saveGameRawQuery)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range games {
+		err := batch.Append(g.GameID, g.File, g.Hash, string(g.Payload), g.IngestedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Send()
+}
+
+const saveGameRawQuery = `
+INSERT INTO games_raw (game_id, file, hash, payload, ingested_at)
+`
@@ -0,0 +1,60 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameRawRepository_Save(t *testing.T) {
+	conn, teardown := setupClickHouseContainer(t)
+	defer teardown()
+
+	ctx := context.Background()
+	repo := repositories.NewGameRawRepository(repositories.WithRawDB(conn))
+	require.NoError(t, repo.Verify(ctx))
+
+	ingestedAt := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	raw := types.GameRaw{
+		GameID:     101,
+		File:       "game_1.json",
+		Hash:       "a1",
+		Payload:    []byte(`{"id":101,"vendor_field":true}`),
+		IngestedAt: ingestedAt,
+	}
+	changed := raw
+	changed.Hash = "b2"
+	changed.Payload = []byte(`{"id":101,"vendor_field":false}`)
+
+	require.NoError(t, repo.Save(ctx, []types.GameRaw{raw, changed}))
+
+	// The same content read again replaces its copy.
+	raw.IngestedAt = ingestedAt.Add(time.Hour)
+	require.NoError(t, repo.Save(ctx, []types.GameRaw{raw}))
+	require.NoError(t, repo.Save(ctx, nil))
+
+	rows, err := conn.Query(ctx, "SELECT hash, payload, ingested_at FROM games_raw FINAL WHERE game_id = 101 ORDER BY hash")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var got []types.GameRaw
+	for rows.Next() {
+		var g types.GameRaw
+		var payload string
+		require.NoError(t, rows.Scan(&g.Hash, &payload, &g.IngestedAt))
+		g.Payload = []byte(payload)
+		got = append(got, g)
+	}
+	require.NoError(t, rows.Err())
+
+	require.Len(t, got, 2)
+	assert.Equal(t, "a1", got[0].Hash)
+	assert.JSONEq(t, `{"id":101,"vendor_field":true}`, string(got[0].Payload))
+	assert.True(t, ingestedAt.Add(time.Hour).Equal(got[0].IngestedAt))
+	assert.Equal(t, "b2", got[1].Hash)
+}
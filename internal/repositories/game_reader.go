@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+type GameReaderOption func(*GameReaderRepository)
+
+type GameReaderRepository struct {
+	db clickhouse.Conn
+}
+
+func WithReaderDB(db clickhouse.Conn) GameReaderOption {
+	return func(r *GameReaderRepository) {
+		r.db = db
+	}
+}
+
+func NewGameReaderRepository(opts ...GameReaderOption) *GameReaderRepository {
+	repo := &GameReaderRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+func (r *GameReaderRepository) Stats(ctx context.Context) (*types.GameStats, error) {
+	var stats types.GameStats
+
+	row := r.db.QueryRow(ctx, gameStatsQuery)
+	if err := row.Scan(&stats.Games, &stats.Rows, &stats.FirstBeginAt, &stats.LastBeginAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, gameMonthStatsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m types.GameMonthStats
+		if err := rows.Scan(&m.Month, &m.Games, &m.Rows); err != nil {
+			return nil, err
+		}
+		stats.Months = append(stats.Months, m)
+	}
+
+	return &stats, rows.Err()
+}
+
+// Export streams the deduplicated rows with begin_at in [from, to) to fn,
+// ordered by begin_at. A zero from or to leaves that side unbounded.
+func (r *GameReaderRepository) Export(
+	ctx context.Context,
+	from, to time.Time,
+	fn func(types.GameDB) error,
+) error {
+	if to.IsZero() {
+		to = time.Date(2106, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	rows, err := r.db.Query(ctx, exportGamesQuery, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g types.GameDB
+		if err := rows.Scan(gameDBScanDest(&g)...); err != nil {
+			return err
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GameIDsSince returns the games that have rows saved at version or later.
+func (r *GameReaderRepository) GameIDsSince(ctx context.Context, version uint64) ([]int64, error) {
+	rows, err := r.db.Query(ctx, gameIDsSinceQuery, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const gameIDsSinceQuery = `
+SELECT DISTINCT game_id
+FROM games
+WHERE version >= ?
+`
+
+const gameStatsQuery = `
+SELECT uniqExact(game_id), count(), min(begin_at), max(begin_at)
+FROM games FINAL
+`
+
+const gameMonthStatsQuery = `
+SELECT toYYYYMM(begin_at) AS month, uniqExact(game_id), count()
+FROM games FINAL
+GROUP BY month
+ORDER BY month
+`
+
+var exportGamesQuery = `
+SELECT ` + gameColumnNames + `
+FROM games FINAL
+WHERE begin_at >= ? AND begin_at < ?
+ORDER BY begin_at, game_id
+`
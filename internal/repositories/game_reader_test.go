@@ -0,0 +1,48 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameReaderRepository_StatsAndExport(t *testing.T) {
+	ctx := context.Background()
+	conn, teardown := setupClickHouseContainer(t)
+	defer teardown()
+
+	jan := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC)
+
+	saver := repositories.NewGameSaverRepository(repositories.WithDB(conn))
+	require.NoError(t, saver.Save(ctx, []types.GameDB{
+		{GameID: 1, BeginAt: jan, PlayerID: 1, Version: 1, IngestedAt: jan},
+		{GameID: 1, BeginAt: jan, PlayerID: 2, Version: 1, IngestedAt: jan},
+		{GameID: 2, BeginAt: feb, PlayerID: 1, Version: 1, IngestedAt: feb},
+	}))
+
+	reader := repositories.NewGameReaderRepository(repositories.WithReaderDB(conn))
+
+	stats, err := reader.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Games)
+	require.Equal(t, uint64(3), stats.Rows)
+	require.True(t, stats.FirstBeginAt.Equal(jan))
+	require.True(t, stats.LastBeginAt.Equal(feb))
+	require.Equal(t, []types.GameMonthStats{
+		{Month: 202401, Games: 1, Rows: 2},
+		{Month: 202402, Games: 1, Rows: 1},
+	}, stats.Months)
+
+	var exported []int64
+	err = reader.Export(ctx, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Time{}, func(g types.GameDB) error {
+		exported = append(exported, g.GameID)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{2}, exported)
+}
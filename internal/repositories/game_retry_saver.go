@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// ClickHouse server error codes worth retrying.
+// See https://github.com/ClickHouse/ClickHouse/blob/master/src/Common/ErrorCodes.cpp
+var retryableClickhouseCodes = map[int32]string{
+	3:   "UNEXPECTED_END_OF_FILE",
+	159: "TIMEOUT_EXCEEDED",
+	164: "READONLY",
+	202: "TOO_MANY_SIMULTANEOUS_QUERIES",
+	209: "SOCKET_TIMEOUT",
+	210: "NETWORK_ERROR",
+	241: "MEMORY_LIMIT_EXCEEDED",
+	252: "TOO_MANY_PARTS",
+	285: "TOO_FEW_LIVE_REPLICAS",
+	319: "UNKNOWN_STATUS_OF_INSERT",
+	425: "SYSTEM_ERROR",
+	999: "KEEPER_EXCEPTION",
+}
+
+// IsRetryable reports whether a failed write may succeed if repeated.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		_, ok := retryableClickhouseCodes[ex.Code]
+		return ok
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, clickhouse.ErrAcquireConnTimeout):
+		return true
+	}
+
+	return false
+}
+
+type GameRetrySaverOption func(*GameRetrySaverRepository)
+
+// GameRetryObserver is notified before every retry.
+type GameRetryObserver interface {
+	ObserveRetry(attempt int, err error)
+}
+
+// GameRetrySaverRepository retries retryable Save errors with jittered
+// exponential backoff. Without a circuit breaker it gives up after
+// maxAttempts; with one, it keeps the batch while the breaker is open and
+// gives up once maxAttempts probes have failed with the breaker half-open,
+// or when the context is cancelled.
+type GameRetrySaverRepository struct {
+	saver          GameSaver
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	breaker        *CircuitBreaker
+	observer       GameRetryObserver
+
+	retries atomic.Int64
+}
+
+func WithRetrySaver(saver GameSaver) GameRetrySaverOption {
+	return func(r *GameRetrySaverRepository) {
+		r.saver = saver
+	}
+}
+
+func WithRetryMaxAttempts(attempts int) GameRetrySaverOption {
+	return func(r *GameRetrySaverRepository) {
+		r.maxAttempts = attempts
+	}
+}
+
+func WithRetryInitialBackoff(backoff time.Duration) GameRetrySaverOption {
+	return func(r *GameRetrySaverRepository) {
+		r.initialBackoff = backoff
+	}
+}
+
+func WithRetryMaxBackoff(backoff time.Duration) GameRetrySaverOption {
+	return func(r *GameRetrySaverRepository) {
+		r.maxBackoff = backoff
+	}
+}
+
+func WithRetryCircuitBreaker(cb *CircuitBreaker) GameRetrySaverOption {
+	return func(r *GameRetrySaverRepository) {
+		r.breaker = cb
+	}
+}
+
+func WithRetryObserver(observer GameRetryObserver) GameRetrySaverOption {
+	return func(r *GameRetrySaverRepository) {
+		r.observer = observer
+	}
+}
+
+func NewGameRetrySaverRepository(opts ...GameRetrySaverOption) *GameRetrySaverRepository {
+	repo := &GameRetrySaverRepository{
+		maxAttempts:    5,
+		initialBackoff: 200 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+func (r *GameRetrySaverRepository) Save(
+	ctx context.Context,
+	games []types.GameDB,
+) error {
+	return r.Do(ctx, len(games), func(ctx context.Context) error {
+		return r.saver.Save(ctx, games)
+	})
+}
+
+// Do runs a write of rows with the retries and the circuit breaker of the
+// saver, for the tables written next to the games on the same database.
+func (r *GameRetrySaverRepository) Do(
+	ctx context.Context,
+	rows int,
+	write func(ctx context.Context) error,
+) error {
+	logger := logging.FromContext(ctx).With(
+		logging.Stage(logging.StageSave),
+		logging.BatchRows(rows),
+	)
+
+	var probes int
+	for attempt := 1; ; attempt++ {
+		if r.breaker != nil {
+			if err := r.breaker.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		probe := r.breaker != nil && r.breaker.State() == CircuitHalfOpen
+
+		err := write(ctx)
+		if err == nil {
+			if r.breaker != nil {
+				r.breaker.Success()
+			}
+			return nil
+		}
+
+		if !IsRetryable(err) {
+			return fmt.Errorf("non-retryable save error: %w", err)
+		}
+
+		if r.breaker != nil {
+			wasOpen := r.breaker.State() == CircuitOpen
+			r.breaker.Failure()
+			if !wasOpen && r.breaker.State() == CircuitOpen {
+				logger.Warn("circuit breaker opened, pausing reads", "cooldown", r.breaker.cooldown)
+			}
+			if probe {
+				if probes++; probes >= r.maxAttempts {
+					return fmt.Errorf("save failed after %d attempts, %d with the circuit half-open: %w", attempt, probes, err)
+				}
+			}
+		} else if attempt >= r.maxAttempts {
+			return fmt.Errorf("save failed after %d attempts: %w", attempt, err)
+		}
+
+		r.retries.Add(1)
+		if r.observer != nil {
+			r.observer.ObserveRetry(attempt, err)
+		}
+
+		backoff := r.backoff(attempt)
+		logger.Warn("retrying save", "attempt", attempt, "backoff", backoff, logging.Err(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *GameRetrySaverRepository) Retries() int64 {
+	return r.retries.Load()
+}
+
+// backoff returns a delay in [d/2, d], where d doubles with every attempt up
+// to maxBackoff.
+func (r *GameRetrySaverRepository) backoff(attempt int) time.Duration {
+	d := r.initialBackoff
+	for i := 1; i < attempt && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
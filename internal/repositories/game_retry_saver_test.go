@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Nil", err: nil, expected: false},
+		{name: "Context canceled", err: context.Canceled, expected: false},
+		{name: "Deadline exceeded", err: context.DeadlineExceeded, expected: true},
+		{name: "Connection refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, expected: true},
+		{name: "Connection reset", err: fmt.Errorf("write: %w", syscall.ECONNRESET), expected: true},
+		{name: "Unexpected EOF", err: io.ErrUnexpectedEOF, expected: true},
+		{name: "Acquire conn timeout", err: clickhouse.ErrAcquireConnTimeout, expected: true},
+		{name: "Too many parts", err: &clickhouse.Exception{Code: 252, Name: "TOO_MANY_PARTS"}, expected: true},
+		{name: "Wrapped timeout exception", err: fmt.Errorf("send: %w", &clickhouse.Exception{Code: 159}), expected: true},
+		{name: "No such column", err: &clickhouse.Exception{Code: 16, Name: "NO_SUCH_COLUMN_IN_TABLE"}, expected: false},
+		{name: "Type mismatch", err: &clickhouse.Exception{Code: 53, Name: "TYPE_MISMATCH"}, expected: false},
+		{name: "Plain error", err: errors.New("boom"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsRetryable(tt.err))
+		})
+	}
+}
+
+type flakySaver struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (s *flakySaver) Save(ctx context.Context, games []types.GameDB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+type recordingRetryObserver struct {
+	attempts []int
+}
+
+func (o *recordingRetryObserver) ObserveRetry(attempt int, err error) {
+	o.attempts = append(o.attempts, attempt)
+}
+
+func TestGameRetrySaverRepository_RetriesThenSucceeds(t *testing.T) {
+	saver := &flakySaver{errs: []error{syscall.ECONNRESET, &clickhouse.Exception{Code: 252}}}
+	observer := &recordingRetryObserver{}
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(saver),
+		WithRetryInitialBackoff(time.Millisecond),
+		WithRetryMaxBackoff(2*time.Millisecond),
+		WithRetryObserver(observer),
+	)
+
+	err := repo.Save(context.Background(), rows(1))
+	require.NoError(t, err)
+	assert.Equal(t, 3, saver.calls)
+	assert.Equal(t, int64(2), repo.Retries())
+	assert.Equal(t, []int{1, 2}, observer.attempts)
+}
+
+func TestGameRetrySaverRepository_DoRetriesOtherWrites(t *testing.T) {
+	breaker := NewCircuitBreaker(WithBreakerThreshold(2))
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(&flakySaver{}),
+		WithRetryInitialBackoff(time.Millisecond),
+		WithRetryCircuitBreaker(breaker),
+	)
+
+	var calls int
+	err := repo.Do(context.Background(), 1, func(ctx context.Context) error {
+		if calls++; calls == 1 {
+			return io.EOF
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, int64(1), repo.Retries())
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestGameRetrySaverRepository_NonRetryableSurfacesImmediately(t *testing.T) {
+	schemaErr := &clickhouse.Exception{Code: 16, Name: "NO_SUCH_COLUMN_IN_TABLE"}
+	saver := &flakySaver{errs: []error{schemaErr}}
+	repo := NewGameRetrySaverRepository(WithRetrySaver(saver))
+
+	err := repo.Save(context.Background(), rows(1))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, schemaErr)
+	assert.Equal(t, 1, saver.calls)
+}
+
+func TestGameRetrySaverRepository_GivesUpAfterMaxAttempts(t *testing.T) {
+	saver := &flakySaver{errs: []error{io.EOF, io.EOF, io.EOF, io.EOF}}
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(saver),
+		WithRetryMaxAttempts(3),
+		WithRetryInitialBackoff(time.Millisecond),
+	)
+
+	err := repo.Save(context.Background(), rows(1))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.Equal(t, 3, saver.calls)
+}
+
+func TestGameRetrySaverRepository_BreakerHoldsBatchUntilRecovery(t *testing.T) {
+	saver := &flakySaver{errs: []error{io.EOF, io.EOF, io.EOF, io.EOF}}
+	breaker := NewCircuitBreaker(
+		WithBreakerThreshold(2),
+		WithBreakerCooldown(5*time.Millisecond),
+	)
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(saver),
+		WithRetryMaxAttempts(3),
+		WithRetryInitialBackoff(time.Millisecond),
+		WithRetryCircuitBreaker(breaker),
+	)
+
+	// Two failures open the breaker, two probes fail, the third succeeds.
+	err := repo.Save(context.Background(), rows(1))
+	require.NoError(t, err)
+	assert.Equal(t, 5, saver.calls)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestGameRetrySaverRepository_BreakerGivesUpAfterMaxProbes(t *testing.T) {
+	saver := &flakySaver{errs: []error{io.EOF, io.EOF, io.EOF, io.EOF, io.EOF, io.EOF}}
+	breaker := NewCircuitBreaker(
+		WithBreakerThreshold(2),
+		WithBreakerCooldown(time.Millisecond),
+	)
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(saver),
+		WithRetryMaxAttempts(2),
+		WithRetryInitialBackoff(time.Millisecond),
+		WithRetryCircuitBreaker(breaker),
+	)
+
+	err := repo.Save(context.Background(), rows(1))
+	require.ErrorIs(t, err, io.EOF)
+	assert.Contains(t, err.Error(), "2 with the circuit half-open")
+	assert.Equal(t, 4, saver.calls)
+	assert.Equal(t, CircuitOpen, breaker.State())
+}
+
+func TestGameRetrySaverRepository_ContextCancelStopsBreakerWait(t *testing.T) {
+	saver := &flakySaver{errs: []error{io.EOF}}
+	breaker := NewCircuitBreaker(
+		WithBreakerThreshold(1),
+		WithBreakerCooldown(time.Hour),
+	)
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(saver),
+		WithRetryInitialBackoff(time.Millisecond),
+		WithRetryCircuitBreaker(breaker),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := repo.Save(ctx, rows(1))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, saver.calls)
+}
+
+func TestGameRetrySaverRepository_ContextCancelStopsRetrying(t *testing.T) {
+	saver := &flakySaver{errs: []error{io.EOF, io.EOF, io.EOF}}
+	repo := NewGameRetrySaverRepository(
+		WithRetrySaver(saver),
+		WithRetryInitialBackoff(time.Hour),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := repo.Save(ctx, rows(1))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestGameRetrySaverRepository_Backoff(t *testing.T) {
+	repo := NewGameRetrySaverRepository(
+		WithRetryInitialBackoff(100*time.Millisecond),
+		WithRetryMaxBackoff(time.Second),
+	)
+
+	for attempt, max := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		10: time.Second,
+	} {
+		d := repo.backoff(attempt)
+		assert.GreaterOrEqual(t, d, max/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, d, max, "attempt %d", attempt)
+	}
+}
@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type GameRoundEventOption func(*GameRoundEventRepository)
+
+// GameRoundEventRepository keeps the round events of the games in the
+// round_events ClickHouse table, which keeps the latest version of an event.
+type GameRoundEventRepository struct {
+	db    clickhouse.Conn
+	retry *GameRetrySaverRepository
+}
+
+func WithRoundEventDB(db clickhouse.Conn) GameRoundEventOption {
+	return func(r *GameRoundEventRepository) {
+		r.db = db
+	}
+}
+
+// WithRoundEventRetry retries a failed round_events insert with the backoff
+// of the games sink.
+func WithRoundEventRetry(retry *GameRetrySaverRepository) GameRoundEventOption {
+	return func(r *GameRoundEventRepository) {
+		r.retry = retry
+	}
+}
+
+func NewGameRoundEventRepository(opts ...GameRoundEventOption) *GameRoundEventRepository {
+	repo := &GameRoundEventRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+// Verify checks that the round_events table exists.
+func (r *GameRoundEventRepository) Verify(ctx context.Context) error {
+	var exists uint8
+	if err := r.db.QueryRow(ctx, "EXISTS TABLE round_events").Scan(&exists); err != nil {
+		return fmt.Errorf("failed to read round_events schema: %w", err)
+	}
+	if exists == 0 {
+		return errors.New("table round_events does not exist, run migrations first")
+	}
+	return nil
+}
+
+// Save inserts the events in one batch, retrying it if given a retry.
+func (r *GameRoundEventRepository) Save(ctx context.Context, events []types.RoundEventDB) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if r.retry != nil {
+		return r.retry.Do(ctx, len(events), func(ctx context.Context) error {
+			return r.save(ctx, events)
+		})
+	}
+	return r.save(ctx, events)
+}
+
+func (r *GameRoundEventRepository) save(ctx context.Context, events []types.RoundEventDB) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "clickhouse insert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrDBSystem.String("clickhouse"),
+			tracing.AttrDBOperation.String("INSERT"),
+			tracing.AttrDBCollection.String("round_events"),
+			tracing.AttrBatchRows.Int(len(events)),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	batch, err := r.db.PrepareBatch(ctx, saveRoundEventQuery)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		err := batch.Append(
+			e.GameID,
+			e.BeginAt,
+			e.RoundID,
+			e.Event,
+			e.Seq,
+			e.TeamID,
+			e.PlayerID,
+			e.OpponentID,
+			e.Weapon,
+			e.Headshot,
+			e.FirstBlood,
+			e.ClutchOpponents,
+			e.EquipmentValue,
+			e.BuyType,
+			e.BombSite,
+			e.RoundWin,
+			e.Version,
+			e.IngestedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Send()
+}
+
+// DeleteStale deletes the events of the games older than version, once a
+// replay has saved them again. It waits for the mutations to finish.
+func (r *GameRoundEventRepository) DeleteStale(ctx context.Context, gameIDs []int64, version uint64) error {
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"mutations_sync": 2,
+	}))
+
+	for chunk := range slices.Chunk(gameIDs, staleGamesChunk) {
+		if err := r.db.Exec(ctx, deleteStaleRoundEventsQuery, chunk, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const saveRoundEventQuery = `
+INSERT INTO round_events (
+    game_id, begin_at, round_id, event, seq,
+    team_id, player_id, opponent_id,
+    weapon, headshot, first_blood, clutch_opponents, equipment_value, buy_type, bomb_site, round_win,
+    version, ingested_at
+)
+`
+
+const deleteStaleRoundEventsQuery = "ALTER TABLE round_events DELETE WHERE has(?, game_id) AND version < ?"
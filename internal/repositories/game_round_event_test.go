@@ -0,0 +1,51 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameRoundEventRepository(t *testing.T) {
+	conn, teardown := setupClickHouseContainer(t)
+	defer teardown()
+
+	ctx := context.Background()
+	repo := repositories.NewGameRoundEventRepository(repositories.WithRoundEventDB(conn))
+	require.NoError(t, repo.Verify(ctx))
+
+	beginAt := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	event := func(gameID int64, seq int64, version uint64) types.RoundEventDB {
+		return types.RoundEventDB{
+			GameID:     gameID,
+			BeginAt:    beginAt,
+			RoundID:    1,
+			Event:      "kill",
+			Seq:        seq,
+			TeamID:     1000,
+			PlayerID:   1,
+			OpponentID: 6,
+			Weapon:     "ak47",
+			FirstBlood: 1,
+			RoundWin:   1,
+			Version:    version,
+			IngestedAt: beginAt,
+		}
+	}
+
+	require.NoError(t, repo.Save(ctx, []types.RoundEventDB{event(101, 0, 1), event(101, 1, 1), event(102, 0, 1)}))
+	// A replay of game 101 that finds a single kill.
+	require.NoError(t, repo.Save(ctx, []types.RoundEventDB{event(101, 0, 2)}))
+	require.NoError(t, repo.DeleteStale(ctx, []int64{101}, 2))
+
+	var count uint64
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count() FROM round_events FINAL WHERE game_id = 101").Scan(&count))
+	assert.Equal(t, uint64(1), count)
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count() FROM round_events FINAL WHERE game_id = 102").Scan(&count))
+	assert.Equal(t, uint64(1), count)
+}
@@ -2,9 +2,14 @@ package repositories
 
 import (
 	"context"
+	"slices"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
 	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type GameSaverOption func(*GameSaverRepository)
@@ -27,13 +32,51 @@ func NewGameSaverRepository(opts ...GameSaverOption) *GameSaverRepository {
 	return repo
 }
 
+// Save inserts the rows of each game with an INSERT of its own, carrying a
+// deduplication token derived from that game alone, so a game re-sent in a
+// different batch is still recognised by ClickHouse. Each insert is sent with
+// its own query ID, recorded on the span so it can be found in
+// system.query_log.
 func (r *GameSaverRepository) Save(
 	ctx context.Context,
 	games []types.GameDB,
 ) error {
-	if len(games) == 0 {
-		return nil
+	for _, rows := range splitByGame(games) {
+		if err := r.insert(ctx, rows); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func (r *GameSaverRepository) insert(
+	ctx context.Context,
+	games []types.GameDB,
+) (err error) {
+	queryID := uuid.NewString()
+	ctx, span := tracing.Tracer().Start(ctx, "clickhouse insert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrDBSystem.String("clickhouse"),
+			tracing.AttrDBOperation.String("INSERT"),
+			tracing.AttrDBCollection.String("games"),
+			tracing.AttrGameID.Int64(games[0].GameID),
+			tracing.AttrBatchRows.Int(len(games)),
+			tracing.AttrQueryID.String(queryID),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	token := deduplicationToken(games)
+	ctx = clickhouse.Context(ctx,
+		clickhouse.WithQueryID(queryID),
+		clickhouse.WithSettings(clickhouse.Settings{
+			"insert_deduplication_token": token,
+		}),
+	)
 
 	batch, err := r.db.PrepareBatch(ctx, saveGamQuery)
 	if err != nil {
@@ -41,46 +84,43 @@ func (r *GameSaverRepository) Save(
 	}
 
 	for _, g := range games {
-		if err := batch.Append(
-			g.GameID,
-			g.BeginAt,
-			g.LeagueID,
-			g.SerieID,
-			g.TierID,
-			g.TournamentID,
-			g.MapID,
-			g.TeamID,
-			g.TeamOpponentID,
-			g.PlayerID,
-			g.PlayerOpponentID,
-			g.Kills,
-			g.Deaths,
-			g.Assists,
-			g.Headshots,
-			g.FlashAssists,
-			g.KDDiff,
-			g.FirstKillsDiff,
-			g.ADR,
-			g.Kast,
-			g.Rating,
-			g.RoundID,
-			g.RoundOutcomeID,
-			g.RoundWin,
-		); err != nil {
+		if err := batch.Append(gameDBValues(g)...); err != nil {
 			return err
 		}
 	}
 
-	return batch.Send()
+	if err := batch.Send(); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Debug("game inserted",
+		logging.Stage(logging.StageSave),
+		logging.GameID(games[0].GameID),
+		logging.BatchRows(len(games)),
+		"deduplication_token", token,
+		"query_id", queryID,
+	)
+
+	return nil
+}
+
+// staleGamesChunk bounds the game IDs sent with one delete mutation.
+const staleGamesChunk = 10000
+
+// DeleteStale deletes the rows of the games older than version, once a replay
+// has saved them again, including rows the current flattening no longer
+// produces. It waits for the mutations to finish.
+func (r *GameSaverRepository) DeleteStale(ctx context.Context, gameIDs []int64, version uint64) error {
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"mutations_sync": 2,
+	}))
+
+	for chunk := range slices.Chunk(gameIDs, staleGamesChunk) {
+		if err := r.db.Exec(ctx, deleteStaleGamesQuery, chunk, version); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-const saveGamQuery = `
-INSERT INTO games (
-	game_id, begin_at, 
-	league_id, serie_id, tier_id, tournament_id, 
-	map_id, 
-	team_id, team_opponent_id, player_id, player_opponent_id, 
-	kills, deaths, assists, headshots, flash_assists, kd_diff, first_kills_diff, adr, kast, rating, 
-	round_id, round_outcome_id, round_win
-) VALUES
-`
+const deleteStaleGamesQuery = "ALTER TABLE games DELETE WHERE has(?, game_id) AND version < ?"
@@ -2,6 +2,10 @@ package repositories_test
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,11 +18,15 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
+// clickhouseImage supports every setting the inserts send, such as
+// insert_deduplication_token. internal/apps tests pin the same image.
+const clickhouseImage = "clickhouse/clickhouse-server:24.8"
+
 func setupClickHouseContainer(t *testing.T) (clickhouse.Conn, func()) {
 	ctx := context.Background()
 
 	req := testcontainers.ContainerRequest{
-		Image:        "clickhouse/clickhouse-server:21.8.10.19",
+		Image:        clickhouseImage,
 		ExposedPorts: []string{"9000/tcp"},
 		WaitingFor:   wait.ForListeningPort("9000/tcp"),
 	}
@@ -47,35 +55,9 @@ func setupClickHouseContainer(t *testing.T) (clickhouse.Conn, func()) {
 	conn, err := clickhouse.Open(connOpts)
 	require.NoError(t, err)
 
-	createTableSQL := `
-CREATE TABLE IF NOT EXISTS games (
-    game_id UInt64,
-    begin_at DateTime,
-    league_id UInt64,
-    serie_id UInt64,
-    tier_id UInt64,
-    tournament_id UInt64,
-    map_id UInt64,
-    team_id UInt64,
-    team_opponent_id UInt64,
-    player_id UInt64,
-    player_opponent_id UInt64,
-    kills UInt32,
-    deaths UInt32,
-    assists UInt32,
-    headshots UInt32,
-    flash_assists UInt32,
-    kd_diff Float64,
-    first_kills_diff Float64,
-    adr Float64,
-    kast Float64,
-    rating Float64,
-    round_id UInt64,
-    round_outcome_id UInt64,
-    round_win UInt64
-) ENGINE = Memory
-`
-	require.NoError(t, conn.Exec(ctx, createTableSQL))
+	for _, stmt := range migrationUpStatements(t, "../../migrations") {
+		require.NoError(t, conn.Exec(ctx, stmt))
+	}
 
 	teardown := func() {
 		_ = conn.Close()
@@ -85,6 +67,27 @@ CREATE TABLE IF NOT EXISTS games (
 	return conn, teardown
 }
 
+// migrationUpStatements returns the goose Up statements of every migration in
+// dir, in the order goose would apply them.
+func migrationUpStatements(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	require.NoError(t, err)
+	sort.Strings(files)
+
+	var stmts []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		for _, block := range strings.Split(up, "-- +goose StatementBegin")[1:] {
+			stmt, _, _ := strings.Cut(block, "-- +goose StatementEnd")
+			stmts = append(stmts, strings.TrimSpace(stmt))
+		}
+	}
+	return stmts
+}
+
 func TestGameSaverRepository_Save(t *testing.T) {
 	ctx := context.Background()
 	conn, teardown := setupClickHouseContainer(t)
@@ -92,6 +95,8 @@ func TestGameSaverRepository_Save(t *testing.T) {
 
 	repo := repositories.NewGameSaverRepository(repositories.WithDB(conn))
 
+	require.NoError(t, repo.Verify(ctx))
+
 	games := []types.GameDB{
 		{
 			GameID:           1,
@@ -118,9 +123,25 @@ func TestGameSaverRepository_Save(t *testing.T) {
 			RoundID:          11,
 			RoundOutcomeID:   12,
 			RoundWin:         1,
+			Version:          1,
+			IngestedAt:       time.Now(),
 		},
 	}
 
 	err := repo.Save(ctx, games)
 	require.NoError(t, err)
 }
+
+func TestGameSaverRepository_Verify_Mismatch(t *testing.T) {
+	ctx := context.Background()
+	conn, teardown := setupClickHouseContainer(t)
+	defer teardown()
+
+	require.NoError(t, conn.Exec(ctx, "ALTER TABLE games RENAME COLUMN k_d_diff TO kd_diff"))
+
+	repo := repositories.NewGameSaverRepository(repositories.WithDB(conn))
+
+	err := repo.Verify(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing column k_d_diff Float64")
+}
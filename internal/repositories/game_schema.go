@@ -0,0 +1,230 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+type gameColumn struct {
+	Name string
+	Type string
+}
+
+// gameColumns lists the games columns in the order Save appends them, with
+// the types created by the migrations.
+var gameColumns = []gameColumn{
+	{Name: "game_id", Type: "Int64"},
+	{Name: "begin_at", Type: "DateTime"},
+	{Name: "league_id", Type: "Int64"},
+	{Name: "serie_id", Type: "Int64"},
+	{Name: "tier_id", Type: "Int64"},
+	{Name: "tournament_id", Type: "Int64"},
+	{Name: "map_id", Type: "Int64"},
+	{Name: "team_id", Type: "Int64"},
+	{Name: "team_opponent_id", Type: "Int64"},
+	{Name: "player_id", Type: "Int64"},
+	{Name: "player_opponent_id", Type: "Int64"},
+	{Name: "kills", Type: "Int64"},
+	{Name: "deaths", Type: "Int64"},
+	{Name: "assists", Type: "Int64"},
+	{Name: "headshots", Type: "Int64"},
+	{Name: "flash_assists", Type: "Int64"},
+	{Name: "k_d_diff", Type: "Float64"},
+	{Name: "first_kills_diff", Type: "Float64"},
+	{Name: "adr", Type: "Float64"},
+	{Name: "kast", Type: "Float64"},
+	{Name: "rating", Type: "Float64"},
+	{Name: "round_id", Type: "Int64"},
+	{Name: "round_outcome_id", Type: "Int64"},
+	{Name: "round_win", Type: "Int64"},
+	{Name: "version", Type: "UInt64"},
+	{Name: "ingested_at", Type: "DateTime64(3)"},
+	{Name: "length", Type: "Nullable(Int64)"},
+}
+
+var gameColumnNames = func() string {
+	names := make([]string, len(gameColumns))
+	for i, c := range gameColumns {
+		names[i] = c.Name
+	}
+	return strings.Join(names, ", ")
+}()
+
+var saveGamQuery = "INSERT INTO games (" + gameColumnNames + ") VALUES"
+
+// gameDBValues returns the row values in gameColumns order.
+func gameDBValues(g types.GameDB) []any {
+	return []any{
+		g.GameID,
+		g.BeginAt,
+		g.LeagueID,
+		g.SerieID,
+		g.TierID,
+		g.TournamentID,
+		g.MapID,
+		g.TeamID,
+		g.TeamOpponentID,
+		g.PlayerID,
+		g.PlayerOpponentID,
+		g.Kills,
+		g.Deaths,
+		g.Assists,
+		g.Headshots,
+		g.FlashAssists,
+		g.KDDiff,
+		g.FirstKillsDiff,
+		g.ADR,
+		g.Kast,
+		g.Rating,
+		g.RoundID,
+		g.RoundOutcomeID,
+		g.RoundWin,
+		g.Version,
+		g.IngestedAt,
+		g.Length,
+	}
+}
+
+// gameSortKey is the ORDER BY of the games table, which ReplacingMergeTree
+// deduplicates on. The Postgres and SQLite tables use it as primary key.
+var gameSortKey = []string{
+	"begin_at",
+	"game_id",
+	"league_id",
+	"serie_id",
+	"tier_id",
+	"tournament_id",
+	"map_id",
+	"round_id",
+	"team_id",
+	"team_opponent_id",
+	"player_id",
+	"player_opponent_id",
+}
+
+// gameUpsertClause makes an INSERT into games keep the row with the highest
+// version per sort key, as ReplacingMergeTree(version) does on merge. On a
+// tie the later insert wins.
+var gameUpsertClause = func() string {
+	var set []string
+	for _, c := range gameColumns {
+		if !slices.Contains(gameSortKey, c.Name) {
+			set = append(set, c.Name+" = excluded."+c.Name)
+		}
+	}
+	return "ON CONFLICT (" + strings.Join(gameSortKey, ", ") + ") DO UPDATE SET " +
+		strings.Join(set, ", ") + " WHERE games.version <= excluded.version"
+}()
+
+// sqlGameValues returns the row values in gameColumns order for databases
+// without unsigned integers. Times are stored in UTC.
+func sqlGameValues(g types.GameDB) []any {
+	values := gameDBValues(g)
+	for i, v := range values {
+		switch v := v.(type) {
+		case uint64:
+			values[i] = int64(v)
+		case time.Time:
+			values[i] = v.UTC()
+		}
+	}
+	return values
+}
+
+// gameDBScanDest returns scan destinations in gameColumns order.
+func gameDBScanDest(g *types.GameDB) []any {
+	return []any{
+		&g.GameID,
+		&g.BeginAt,
+		&g.LeagueID,
+		&g.SerieID,
+		&g.TierID,
+		&g.TournamentID,
+		&g.MapID,
+		&g.TeamID,
+		&g.TeamOpponentID,
+		&g.PlayerID,
+		&g.PlayerOpponentID,
+		&g.Kills,
+		&g.Deaths,
+		&g.Assists,
+		&g.Headshots,
+		&g.FlashAssists,
+		&g.KDDiff,
+		&g.FirstKillsDiff,
+		&g.ADR,
+		&g.Kast,
+		&g.Rating,
+		&g.RoundID,
+		&g.RoundOutcomeID,
+		&g.RoundWin,
+		&g.Version,
+		&g.IngestedAt,
+		&g.Length,
+	}
+}
+
+// Verify compares the games table in the current database with the columns
+// Save writes and returns a readable diff on mismatch.
+func (r *GameSaverRepository) Verify(ctx context.Context) error {
+	rows, err := r.db.Query(ctx, verifyGamesQuery)
+	if err != nil {
+		return fmt.Errorf("failed to read games schema: %w", err)
+	}
+	defer rows.Close()
+
+	var actual []gameColumn
+	for rows.Next() {
+		var c gameColumn
+		if err := rows.Scan(&c.Name, &c.Type); err != nil {
+			return fmt.Errorf("failed to read games schema: %w", err)
+		}
+		actual = append(actual, c)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read games schema: %w", err)
+	}
+
+	if len(actual) == 0 {
+		return errors.New("games schema mismatch: table games does not exist, run migrations first")
+	}
+
+	if diff := diffGameColumns(gameColumns, actual); len(diff) > 0 {
+		return fmt.Errorf("games schema mismatch:\n  %s", strings.Join(diff, "\n  "))
+	}
+
+	return nil
+}
+
+func diffGameColumns(expected, actual []gameColumn) []string {
+	actualTypes := make(map[string]string, len(actual))
+	for _, c := range actual {
+		actualTypes[c.Name] = c.Type
+	}
+
+	var diff []string
+	for _, c := range expected {
+		typ, ok := actualTypes[c.Name]
+		switch {
+		case !ok:
+			diff = append(diff, fmt.Sprintf("- missing column %s %s", c.Name, c.Type))
+		case typ != c.Type:
+			diff = append(diff, fmt.Sprintf("~ column %s: expected %s, got %s", c.Name, c.Type, typ))
+		}
+	}
+
+	return diff
+}
+
+const verifyGamesQuery = `
+SELECT name, type
+FROM system.columns
+WHERE database = currentDatabase() AND table = 'games'
+ORDER BY position
+`
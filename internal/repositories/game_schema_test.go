@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffGameColumns(t *testing.T) {
+	expected := []gameColumn{
+		{Name: "game_id", Type: "Int64"},
+		{Name: "k_d_diff", Type: "Float64"},
+		{Name: "version", Type: "UInt64"},
+	}
+
+	tests := []struct {
+		name   string
+		actual []gameColumn
+		diff   []string
+	}{
+		{
+			name:   "Match",
+			actual: expected,
+			diff:   nil,
+		},
+		{
+			name: "Extra columns are ignored",
+			actual: append([]gameColumn{
+				{Name: "comment", Type: "String"},
+			}, expected...),
+			diff: nil,
+		},
+		{
+			name: "Renamed column",
+			actual: []gameColumn{
+				{Name: "game_id", Type: "Int64"},
+				{Name: "kd_diff", Type: "Float64"},
+				{Name: "version", Type: "UInt64"},
+			},
+			diff: []string{"- missing column k_d_diff Float64"},
+		},
+		{
+			name: "Wrong types",
+			actual: []gameColumn{
+				{Name: "game_id", Type: "UInt64"},
+				{Name: "k_d_diff", Type: "Float64"},
+			},
+			diff: []string{
+				"~ column game_id: expected Int64, got UInt64",
+				"- missing column version UInt64",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.diff, diffGameColumns(expected, tt.actual))
+		})
+	}
+}
+
+func TestSaveGamQuery_MatchesGameColumns(t *testing.T) {
+	assert.True(t, strings.HasPrefix(saveGamQuery, "INSERT INTO games ("))
+	assert.Contains(t, saveGamQuery, " k_d_diff,")
+	assert.NotContains(t, saveGamQuery, " kd_diff,")
+	assert.Equal(t, len(gameColumns), strings.Count(saveGamQuery, ",")+1)
+}
+
+func TestGameDBValues_MatchGameColumns(t *testing.T) {
+	var g types.GameDB
+	assert.Len(t, gameDBValues(g), len(gameColumns))
+	assert.Len(t, gameDBScanDest(&g), len(gameColumns))
+}
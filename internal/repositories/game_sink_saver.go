@@ -0,0 +1,245 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+// What a sink does with a batch it failed to save.
+const (
+	SinkPolicyFail       = "fail"
+	SinkPolicySkip       = "skip"
+	SinkPolicyDeadLetter = "dead-letter"
+)
+
+// GameSinkObserver is notified after every save to a named sink, before the
+// error policy is applied.
+type GameSinkObserver interface {
+	ObserveSink(sink string, policy string, rows int, err error)
+}
+
+type GameSinkSaverOption func(*GameSinkSaverRepository)
+
+// GameSinkSaverRepository names a saver and applies its error policy: fail
+// returns the error, skip drops the batch and dead-letter hands it to the
+// dead-letter saver instead.
+//
+// Only fail lets the error reach the pipeline, which then puts the games in
+// the dead-letter store (the DLQ), if any, to be replayed to every sink. With
+// skip or dead-letter the games count as saved and never reach the DLQ: the
+// rows a dead-letter sink set aside are kept apart from it, per sink, and are
+// loaded by hand.
+type GameSinkSaverRepository struct {
+	name       string
+	saver      GameSaver
+	policy     string
+	deadLetter GameSaver
+	observer   GameSinkObserver
+}
+
+func WithSinkName(name string) GameSinkSaverOption {
+	return func(r *GameSinkSaverRepository) {
+		r.name = name
+	}
+}
+
+func WithSinkSaver(saver GameSaver) GameSinkSaverOption {
+	return func(r *GameSinkSaverRepository) {
+		r.saver = saver
+	}
+}
+
+func WithSinkPolicy(policy string) GameSinkSaverOption {
+	return func(r *GameSinkSaverRepository) {
+		r.policy = policy
+	}
+}
+
+func WithSinkDeadLetter(saver GameSaver) GameSinkSaverOption {
+	return func(r *GameSinkSaverRepository) {
+		r.deadLetter = saver
+	}
+}
+
+func WithSinkObserver(observer GameSinkObserver) GameSinkSaverOption {
+	return func(r *GameSinkSaverRepository) {
+		r.observer = observer
+	}
+}
+
+func NewGameSinkSaverRepository(opts ...GameSinkSaverOption) *GameSinkSaverRepository {
+	repo := &GameSinkSaverRepository{
+		policy: SinkPolicyFail,
+	}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+func (r *GameSinkSaverRepository) Save(
+	ctx context.Context,
+	games []types.GameDB,
+) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	err := r.saver.Save(ctx, games)
+	if r.observer != nil {
+		r.observer.ObserveSink(r.name, r.policy, len(games), err)
+	}
+	if err == nil {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx).With(
+		logging.Stage(logging.StageSave),
+		"sink", r.name,
+		logging.BatchRows(len(games)),
+		logging.Err(err),
+	)
+
+	switch r.policy {
+	case SinkPolicySkip:
+		logger.Warn("sink failed, batch skipped")
+		return nil
+	case SinkPolicyDeadLetter:
+		if dlErr := r.deadLetter.Save(ctx, games); dlErr != nil {
+			return fmt.Errorf("sink %s: %w, dead letter failed: %w", r.name, err, dlErr)
+		}
+		logger.Warn("sink failed, batch dead-lettered")
+		return nil
+	}
+
+	return fmt.Errorf("sink %s: %w", r.name, err)
+}
+
+type GameFanOutSaverOption func(*GameFanOutSaverRepository)
+
+// GameFanOutSaverRepository hands every batch to all of its savers at once
+// and waits for them.
+type GameFanOutSaverRepository struct {
+	savers []GameSaver
+
+	mu sync.Mutex
+	// joined is closed once the errors of the last Enqueue are joined.
+	joined chan struct{}
+	// last holds the errors of the savers for the previous Enqueue, and
+	// lastErr what it returned.
+	last    []error
+	lastErr error
+}
+
+// WithFanOutSaver adds a saver. It may be given several times.
+func WithFanOutSaver(saver GameSaver) GameFanOutSaverOption {
+	return func(r *GameFanOutSaverRepository) {
+		r.savers = append(r.savers, saver)
+	}
+}
+
+func NewGameFanOutSaverRepository(opts ...GameFanOutSaverOption) *GameFanOutSaverRepository {
+	repo := &GameFanOutSaverRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+func (r *GameFanOutSaverRepository) Save(
+	ctx context.Context,
+	games []types.GameDB,
+) error {
+	select {
+	case err := <-r.Enqueue(ctx, games):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// gameEnqueuer is a saver that takes rows without waiting for them to be
+// saved, like GameBatchSaverRepository.
+type gameEnqueuer interface {
+	Enqueue(ctx context.Context, games []types.GameDB) <-chan error
+}
+
+// Enqueue hands the rows to every saver and returns a channel that receives
+// their joined errors once all of them are done. Savers that cannot take rows
+// without waiting are called in the background.
+//
+// Consecutive calls failed by the same flushes of every saver receive the
+// same error, so the pipeline rejects their games together as it does for a
+// single sink. The errors are joined in the order of the calls to compare
+// each with the one before.
+func (r *GameFanOutSaverRepository) Enqueue(
+	ctx context.Context,
+	games []types.GameDB,
+) <-chan error {
+	dones := make([]<-chan error, len(r.savers))
+	for i, saver := range r.savers {
+		if e, ok := saver.(gameEnqueuer); ok {
+			dones[i] = e.Enqueue(ctx, games)
+			continue
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- saver.Save(ctx, games)
+		}()
+		dones[i] = done
+	}
+	if len(dones) == 1 {
+		return dones[0]
+	}
+
+	r.mu.Lock()
+	prev, joined := r.joined, make(chan struct{})
+	r.joined = joined
+	r.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		defer close(joined)
+
+		errs := make([]error, len(dones))
+		for i, d := range dones {
+			errs[i] = <-d
+		}
+		if prev != nil {
+			<-prev
+		}
+		done <- r.join(errs)
+	}()
+	return done
+}
+
+// join joins the errors of the savers, reusing the error of the previous
+// Enqueue when every saver returned it the same error.
+func (r *GameFanOutSaverRepository) join(errs []error) error {
+	same := r.last != nil
+	for i := range errs {
+		if same && !errors.Is(errs[i], r.last[i]) {
+			same = false
+		}
+	}
+	if !same {
+		r.last, r.lastErr = errs, errors.Join(errs...)
+	}
+	return r.lastErr
+}
+
+// Flush flushes the savers that buffer rows.
+func (r *GameFanOutSaverRepository) Flush(ctx context.Context) error {
+	var errs []error
+	for _, saver := range r.savers {
+		if f, ok := saver.(interface{ Flush(context.Context) error }); ok {
+			errs = append(errs, f.Flush(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
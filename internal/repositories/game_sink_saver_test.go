@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSinkObserver struct {
+	saves []string
+}
+
+func (o *recordingSinkObserver) ObserveSink(sink string, policy string, rows int, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	o.saves = append(o.saves, sink+":"+policy+":"+result)
+}
+
+func TestGameSinkSaverRepository_Policies(t *testing.T) {
+	boom := errors.New("boom")
+	games := make([]types.GameDB, 3)
+
+	tests := []struct {
+		name       string
+		policy     string
+		err        error
+		expected   string
+		deadLetter int
+	}{
+		{name: "Saved", policy: SinkPolicyFail},
+		{name: "Fail", policy: SinkPolicyFail, err: boom, expected: "sink archive: boom"},
+		{name: "Skip", policy: SinkPolicySkip, err: boom},
+		{name: "Dead letter", policy: SinkPolicyDeadLetter, err: boom, deadLetter: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetter := &recordingSaver{}
+			observer := &recordingSinkObserver{}
+			repo := NewGameSinkSaverRepository(
+				WithSinkName("archive"),
+				WithSinkSaver(&recordingSaver{err: tt.err}),
+				WithSinkPolicy(tt.policy),
+				WithSinkDeadLetter(deadLetter),
+				WithSinkObserver(observer),
+			)
+
+			err := repo.Save(context.Background(), games)
+			if tt.expected != "" {
+				assert.EqualError(t, err, tt.expected)
+				assert.ErrorIs(t, err, boom)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var deadLettered int
+			for _, size := range deadLetter.sizes() {
+				deadLettered += size
+			}
+			assert.Equal(t, tt.deadLetter, deadLettered)
+
+			result := "ok"
+			if tt.err != nil {
+				result = "error"
+			}
+			assert.Equal(t, []string{"archive:" + tt.policy + ":" + result}, observer.saves)
+		})
+	}
+}
+
+func TestGameSinkSaverRepository_DeadLetterFails(t *testing.T) {
+	repo := NewGameSinkSaverRepository(
+		WithSinkName("archive"),
+		WithSinkSaver(&recordingSaver{err: errors.New("boom")}),
+		WithSinkPolicy(SinkPolicyDeadLetter),
+		WithSinkDeadLetter(&recordingSaver{err: errors.New("disk full")}),
+	)
+
+	err := repo.Save(context.Background(), make([]types.GameDB, 1))
+	assert.EqualError(t, err, "sink archive: boom, dead letter failed: disk full")
+}
+
+func TestGameFanOutSaverRepository_Save(t *testing.T) {
+	first := &recordingSaver{}
+	failing := &recordingSaver{err: errors.New("boom")}
+	last := &recordingSaver{}
+	repo := NewGameFanOutSaverRepository(
+		WithFanOutSaver(first),
+		WithFanOutSaver(failing),
+		WithFanOutSaver(last),
+	)
+
+	err := repo.Save(context.Background(), make([]types.GameDB, 2))
+	assert.EqualError(t, err, "boom")
+
+	// One sink failing does not keep the batch from the others.
+	assert.Equal(t, []int{2}, first.sizes())
+	assert.Equal(t, []int{2}, last.sizes())
+}
+
+func TestGameFanOutSaverRepository_Enqueue_SameFlushSameError(t *testing.T) {
+	rejecting := NewGameBatchSaverRepository(
+		WithBatchSaver(NewGameSinkSaverRepository(
+			WithSinkName("bad"),
+			WithSinkSaver(&recordingSaver{err: errors.New("boom")}),
+		)),
+		WithBatchMaxRows(2),
+	)
+	accepted := &recordingSaver{}
+	accepting := NewGameBatchSaverRepository(
+		WithBatchSaver(NewGameSinkSaverRepository(
+			WithSinkName("good"),
+			WithSinkSaver(accepted),
+		)),
+		WithBatchMaxRows(3),
+	)
+	repo := NewGameFanOutSaverRepository(
+		WithFanOutSaver(rejecting),
+		WithFanOutSaver(accepting),
+	)
+
+	var dones []<-chan error
+	for range 4 {
+		dones = append(dones, repo.Enqueue(context.Background(), rows(1)))
+	}
+	require.NoError(t, repo.Flush(context.Background()))
+	errs := make([]error, len(dones))
+	for i, done := range dones {
+		errs[i] = <-done
+		assert.EqualError(t, errs[i], "sink bad: boom")
+	}
+
+	// The rejecting sink failed two flushes of two games each, while the
+	// accepting one took them in other batches.
+	assert.True(t, errs[0] == errs[1])
+	assert.True(t, errs[1] != errs[2])
+	assert.True(t, errs[2] == errs[3])
+	assert.Equal(t, []int{3, 1}, accepted.sizes())
+
+	require.NoError(t, rejecting.Close(context.Background()))
+	require.NoError(t, accepting.Close(context.Background()))
+}
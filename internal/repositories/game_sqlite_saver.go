@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type GameSQLiteSaverOption func(*GameSQLiteSaverRepository)
+
+// GameSQLiteSaverRepository upserts rows into a local SQLite games table.
+type GameSQLiteSaverRepository struct {
+	db *sql.DB
+}
+
+func WithSQLiteDB(db *sql.DB) GameSQLiteSaverOption {
+	return func(r *GameSQLiteSaverRepository) {
+		r.db = db
+	}
+}
+
+func NewGameSQLiteSaverRepository(opts ...GameSQLiteSaverOption) *GameSQLiteSaverRepository {
+	repo := &GameSQLiteSaverRepository{}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
+}
+
+// Save upserts the games in one transaction.
+func (r *GameSQLiteSaverRepository) Save(
+	ctx context.Context,
+	games []types.GameDB,
+) (err error) {
+	if len(games) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "sqlite insert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrDBSystem.String("sqlite"),
+			tracing.AttrDBOperation.String("INSERT"),
+			tracing.AttrDBCollection.String("games"),
+			tracing.AttrBatchRows.Int(len(games)),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, upsertSQLiteGameQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, g := range games {
+		if _, err := stmt.ExecContext(ctx, sqlGameValues(g)...); err != nil {
+			return fmt.Errorf("failed to upsert game %d: %w", g.GameID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Debug("batch inserted",
+		logging.Stage(logging.StageSave),
+		logging.BatchRows(len(games)),
+	)
+
+	return nil
+}
+
+var upsertSQLiteGameQuery = "INSERT INTO games (" + gameColumnNames + ") VALUES (" +
+	strings.TrimSuffix(strings.Repeat("?, ", len(gameColumns)), ", ") + ") " +
+	gameUpsertClause
@@ -0,0 +1,81 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func setupSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "games.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range migrationUpStatements(t, "../../migrations/sqlite") {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	return db
+}
+
+// upsertGames is one key saved at versions 1 and 2 in the same batch, plus a
+// second key.
+func upsertGames() []types.GameDB {
+	beginAt := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	game := types.GameDB{GameID: 1, BeginAt: beginAt, PlayerID: 90, Kills: 5, Version: 1, IngestedAt: beginAt}
+
+	newer := game
+	newer.Kills = 7
+	newer.Version = 2
+
+	other := game
+	other.PlayerID = 91
+
+	return []types.GameDB{game, newer, other}
+}
+
+func TestGameSQLiteSaverRepository_Save(t *testing.T) {
+	ctx := context.Background()
+	db := setupSQLite(t)
+	repo := repositories.NewGameSQLiteSaverRepository(repositories.WithSQLiteDB(db))
+
+	games := upsertGames()
+	require.NoError(t, repo.Save(ctx, games))
+
+	// An older version of a stored row does not replace it.
+	older := games[0]
+	older.Kills = 1
+	older.Version = 0
+	require.NoError(t, repo.Save(ctx, []types.GameDB{older}))
+
+	rows, err := db.QueryContext(ctx, "SELECT player_id, kills, version, begin_at FROM games ORDER BY player_id")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type row struct {
+		PlayerID, Kills, Version int64
+		BeginAt                  time.Time
+	}
+	var actual []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.PlayerID, &r.Kills, &r.Version, &r.BeginAt))
+		actual = append(actual, r)
+	}
+	require.NoError(t, rows.Err())
+
+	beginAt := games[0].BeginAt
+	assert.Equal(t, []row{
+		{PlayerID: 90, Kills: 7, Version: 2, BeginAt: beginAt},
+		{PlayerID: 91, Kills: 5, Version: 1, BeginAt: beginAt},
+	}, actual)
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/sbilibin2017/cs2"
+	serviceName = "cs2"
+)
+
+// Span attribute keys.
+const (
+	AttrGameID       = attribute.Key("cs2.game_id")
+	AttrFile         = attribute.Key("cs2.file.path")
+	AttrFileSize     = attribute.Key("cs2.file.size")
+	AttrRows         = attribute.Key("cs2.rows")
+	AttrDropReason   = attribute.Key("cs2.dropped_reason")
+	AttrBatchRows    = attribute.Key("cs2.batch.rows")
+	AttrQueryID      = attribute.Key("db.clickhouse.query_id")
+	AttrDBSystem     = attribute.Key("db.system")
+	AttrDBOperation  = attribute.Key("db.operation")
+	AttrDBCollection = attribute.Key("db.collection.name")
+)
+
+// Tracer returns the tracer of the global provider, so spans follow whatever
+// Setup (or a test) installed.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Setup installs a global tracer provider exporting spans with the named
+// exporter. Without an endpoint the OTLP exporters fall back to the standard
+// OTEL_EXPORTER_OTLP_* environment variables. The returned function flushes
+// and stops the provider.
+func Setup(ctx context.Context, exporter, endpoint string, sampleRatio float64, stdout io.Writer) (func(context.Context) error, error) {
+	var (
+		spanExporter sdktrace.SpanExporter
+		err          error
+	)
+
+	switch exporter {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case "otlp-grpc":
+		var opts []otlptracegrpc.Option
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracegrpc.New(ctx, opts...)
+	case "otlp-http":
+		var opts []otlptracehttp.Option
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		ratio    float64
+		spans    int
+		errMsg   string
+	}{
+		{name: "None", exporter: "none", ratio: 1},
+		{name: "Stdout", exporter: "stdout", ratio: 1, spans: 1},
+		{name: "Stdout unsampled", exporter: "stdout", ratio: 0},
+		{name: "Unknown exporter", exporter: "zipkin", ratio: 1, errMsg: `unknown trace exporter "zipkin"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := otel.GetTracerProvider()
+			t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+			var buf bytes.Buffer
+			shutdown, err := Setup(context.Background(), tt.exporter, "", tt.ratio, &buf)
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			_, span := Tracer().Start(context.Background(), "game")
+			span.SetAttributes(AttrGameID.Int64(7))
+			span.End()
+			require.NoError(t, shutdown(context.Background()))
+
+			var spans int
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var s map[string]any
+				require.NoError(t, dec.Decode(&s))
+				assert.Equal(t, "game", s["Name"])
+				spans++
+			}
+			assert.Equal(t, tt.spans, spans)
+		})
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	RecordError(ok, nil)
+	ok.End()
+
+	_, failed := tracer.Start(context.Background(), "failed")
+	RecordError(failed, errors.New("boom"))
+	failed.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "boom", spans[1].Status().Description)
+	assert.Len(t, spans[1].Events(), 1)
+}
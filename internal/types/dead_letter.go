@@ -0,0 +1,18 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is a game the pipeline rejected, kept with its raw GameParser
+// payload so that it can be corrected and replayed.
+type DeadLetter struct {
+	GameID   int64           `json:"game_id"`
+	File     string          `json:"file"`
+	Stage    string          `json:"stage"`
+	Error    string          `json:"error"`
+	Attempts int64           `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+	Payload  json.RawMessage `json:"payload"`
+}
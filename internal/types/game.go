@@ -50,14 +50,53 @@ type PlayerStatisticParser struct {
 	Rating         float64      `json:"rating"`
 }
 
+// RoundKillParser is a kill of a round's kill feed. FirstBlood is nil when
+// the feed does not mark the round's first kill.
+type RoundKillParser struct {
+	Killer     PlayerParser `json:"killer"`
+	Victim     PlayerParser `json:"victim"`
+	Weapon     string       `json:"weapon"`
+	Headshot   bool         `json:"headshot"`
+	FirstBlood *bool        `json:"first_blood"`
+}
+
+// RoundClutchParser is a player left alone against Opponents players.
+type RoundClutchParser struct {
+	Player    PlayerParser `json:"player"`
+	Opponents int64        `json:"opponents"`
+}
+
+type RoundEconomyParser struct {
+	Team           TeamParser `json:"team"`
+	EquipmentValue int64      `json:"equipment_value"`
+	BuyType        string     `json:"buy_type"`
+}
+
+// RoundParser is a round of a game. The kill feed, clutch, economy and bomb
+// site are only in the richer round payloads; they are nil when missing.
 type RoundParser struct {
 	Round      int64  `json:"round"`
 	CT         int64  `json:"ct"`
 	T          int64  `json:"terrorists"`
 	WinnerTeam int64  `json:"winner_team"`
 	Outcome    string `json:"outcome"`
+
+	// Kills are in the order they happened: without a first_blood mark on
+	// any of them, the first kill is taken as the round's first blood.
+	Kills    []RoundKillParser    `json:"kills"`
+	Clutch   *RoundClutchParser   `json:"clutch"`
+	Economy  []RoundEconomyParser `json:"economy"`
+	BombSite *string              `json:"bomb_site"`
 }
 
+// GameParser is a game as read from a game file. A field missing from the
+// file keeps its zero value: IDs and statistics are 0, a missing tier or
+// round outcome flattens to the unknown ID 0, and a game without players or
+// rounds is dropped.
+//
+// Fields added once games were already archived are pointers, nil when the
+// file predates them, and are stored as NULL. ClickHouse backfills them from
+// games_raw; other sinks fill them when the games are replayed.
 type GameParser struct {
 	ID      int64                   `json:"id"`
 	BeginAt time.Time               `json:"begin_at"`
@@ -65,36 +104,75 @@ type GameParser struct {
 	Map     MapParser               `json:"map"`
 	Players []PlayerStatisticParser `json:"players"`
 	Rounds  []RoundParser           `json:"rounds"`
+
+	// Length is the duration of the game in seconds.
+	Length *int64 `json:"length"`
+
+	// File is the game file the game was read from, and Raw its content.
+	File string `json:"-"`
+	Raw  []byte `json:"-"`
 }
 
 type GameDB struct {
+	GameID  int64     `json:"game_id" parquet:"game_id"`
+	BeginAt time.Time `json:"begin_at" parquet:"begin_at,timestamp(millisecond)"`
+
+	LeagueID     int64 `json:"league_id" parquet:"league_id"`
+	SerieID      int64 `json:"serie_id" parquet:"serie_id"`
+	TierID       int64 `json:"tier_id" parquet:"tier_id"`
+	TournamentID int64 `json:"tournament_id" parquet:"tournament_id"`
+
+	MapID int64 `json:"map_id" parquet:"map_id"`
+
+	TeamID           int64 `json:"team_id" parquet:"team_id"`
+	TeamOpponentID   int64 `json:"team_opponent_id" parquet:"team_opponent_id"`
+	PlayerID         int64 `json:"player_id" parquet:"player_id"`
+	PlayerOpponentID int64 `json:"player_opponent_id" parquet:"player_opponent_id"`
+
+	Kills          int64   `json:"kills" parquet:"kills"`
+	Deaths         int64   `json:"deaths" parquet:"deaths"`
+	Assists        int64   `json:"assists" parquet:"assists"`
+	Headshots      int64   `json:"headshots" parquet:"headshots"`
+	FlashAssists   int64   `json:"flash_assists" parquet:"flash_assists"`
+	KDDiff         float64 `json:"k_d_diff" parquet:"k_d_diff"`
+	FirstKillsDiff float64 `json:"first_kills_diff" parquet:"first_kills_diff"`
+	ADR            float64 `json:"adr" parquet:"adr"`
+	Kast           float64 `json:"kast" parquet:"kast"`
+	Rating         float64 `json:"rating" parquet:"rating"`
+
+	RoundID        int64 `json:"round_id" parquet:"round_id"`
+	RoundOutcomeID int64 `json:"round_outcome_id" parquet:"round_outcome_id"`
+	RoundWin       int64 `json:"round_win" parquet:"round_win"`
+
+	Version    uint64    `json:"version" parquet:"version"`
+	IngestedAt time.Time `json:"ingested_at" parquet:"ingested_at,timestamp(millisecond)"`
+
+	Length *int64 `json:"length" parquet:"length,optional"`
+}
+
+// RoundEventDB is one event of a round: a kill, a clutch, the economy of a
+// team or the bomb plant. Seq orders the events of the same kind in a round.
+// RoundWin is 1 when the team of the event won the round.
+type RoundEventDB struct {
 	GameID  int64     `json:"game_id"`
 	BeginAt time.Time `json:"begin_at"`
-
-	LeagueID     int64 `json:"league_id"`
-	SerieID      int64 `json:"serie_id"`
-	TierID       int64 `json:"tier_id"`
-	TournamentID int64 `json:"tournament_id"`
-
-	MapID int64 `json:"map_id"`
-
-	TeamID           int64 `json:"team_id"`
-	TeamOpponentID   int64 `json:"team_opponent_id"`
-	PlayerID         int64 `json:"player_id"`
-	PlayerOpponentID int64 `json:"player_opponent_id"`
-
-	Kills          int64   `json:"kills"`
-	Deaths         int64   `json:"deaths"`
-	Assists        int64   `json:"assists"`
-	Headshots      int64   `json:"headshots"`
-	FlashAssists   int64   `json:"flash_assists"`
-	KDDiff         float64 `json:"k_d_diff"`
-	FirstKillsDiff float64 `json:"first_kills_diff"`
-	ADR            float64 `json:"adr"`
-	Kast           float64 `json:"kast"`
-	Rating         float64 `json:"rating"`
-
-	RoundID        int64 `json:"round_id"`
-	RoundOutcomeID int64 `json:"round_outcome_id"`
-	RoundWin       int64 `json:"round_win"`
+	RoundID int64     `json:"round_id"`
+	Event   string    `json:"event"`
+	Seq     int64     `json:"seq"`
+
+	TeamID     int64 `json:"team_id"`
+	PlayerID   int64 `json:"player_id"`
+	OpponentID int64 `json:"opponent_id"`
+
+	Weapon          string `json:"weapon"`
+	Headshot        int64  `json:"headshot"`
+	FirstBlood      int64  `json:"first_blood"`
+	ClutchOpponents int64  `json:"clutch_opponents"`
+	EquipmentValue  int64  `json:"equipment_value"`
+	BuyType         string `json:"buy_type"`
+	BombSite        string `json:"bomb_site"`
+	RoundWin        int64  `json:"round_win"`
+
+	Version    uint64    `json:"version"`
+	IngestedAt time.Time `json:"ingested_at"`
 }
@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+// GameRaw is a source game kept verbatim, as read from its file. Hash is the
+// hex SHA-256 of the payload.
+type GameRaw struct {
+	GameID     int64
+	File       string
+	Hash       string
+	Payload    []byte
+	IngestedAt time.Time
+}
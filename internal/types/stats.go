@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+type GameMonthStats struct {
+	Month uint32 `json:"month"`
+	Games uint64 `json:"games"`
+	Rows  uint64 `json:"rows"`
+}
+
+type GameStats struct {
+	Games        uint64           `json:"games"`
+	Rows         uint64           `json:"rows"`
+	FirstBeginAt time.Time        `json:"first_begin_at"`
+	LastBeginAt  time.Time        `json:"last_begin_at"`
+	Months       []GameMonthStats `json:"months"`
+}
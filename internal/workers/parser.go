@@ -1,10 +1,23 @@
 package workers
 
 import (
+	"cmp"
+	"container/heap"
 	"context"
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
 
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/tracing"
 	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Parser interface {
@@ -15,9 +28,111 @@ type Saver interface {
 	Save(ctx context.Context, games []types.GameDB) error
 }
 
+// BatchSaver is a Saver that batches rows across calls. Enqueue takes rows
+// without waiting for them to be saved, keeping their order, and returns a
+// channel that receives the outcome. Flush saves whatever is buffered.
+type BatchSaver interface {
+	Saver
+	Enqueue(ctx context.Context, games []types.GameDB) <-chan error
+	Flush(ctx context.Context) error
+}
+
+// Gate blocks reading new games while downstream cannot accept them.
+type Gate interface {
+	Wait(ctx context.Context) error
+}
+
+// DeadLetter keeps the games the pipeline rejected, with their raw payload.
+// The games rejected together are put together.
+type DeadLetter interface {
+	Put(ctx context.Context, entries ...types.DeadLetter) error
+}
+
+// RawStore keeps the source games verbatim.
+type RawStore interface {
+	Save(ctx context.Context, games []types.GameRaw) error
+}
+
+// Reasons a decoded game produces no rows.
+const (
+	DropReasonTeams  = "not_two_teams"
+	DropReasonNoRows = "no_rows"
+	DropReasonRaw    = "raw_not_stored"
+
+	DropReasonRoundEvents = "round_events_not_saved"
+)
+
+// waitingBatchMax bounds the games already waiting that a stage stores
+// together.
+const waitingBatchMax = 100
+
+// pendingSavesMax bounds the games a save goroutine has handed to a
+// BatchSaver and not seen saved yet. Once reached, it flushes.
+const pendingSavesMax = 10000
+
+// Fields whose unknown values are flattened to 0.
+const (
+	FieldTier         = "tier"
+	FieldRoundOutcome = "round_outcome"
+	FieldBuyType      = "buy_type"
+)
+
+// Observer is notified about games moving through the pipeline. The file is
+// the one the game was read from, if any.
+type Observer interface {
+	ObserveGameDropped(file string, reason string)
+	ObserveFlattened(file string, rows int)
+	// ObserveUnknownValue is called once per game and distinct value of a
+	// field that has no ID.
+	ObserveUnknownValue(file string, field string, value string)
+	ObserveSaved(games []types.GameDB)
+	// ObserveQueue registers a channel of the given stage whose length may be
+	// sampled until ForgetQueues is called.
+	ObserveQueue(stage string, length func() int)
+	ForgetQueues()
+	// ObserveStage is called when a goroutine of the given stage starts. The
+	// returned function is called when it stops: with nil once its input is
+	// done or the pipeline stops, with the error that stopped it otherwise.
+	ObserveStage(stage string) (stopped func(err error))
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveGameDropped(string, string)          {}
+func (nopObserver) ObserveFlattened(string, int)               {}
+func (nopObserver) ObserveUnknownValue(string, string, string) {}
+func (nopObserver) ObserveSaved([]types.GameDB)                {}
+func (nopObserver) ObserveQueue(string, func() int)            {}
+func (nopObserver) ForgetQueues()                              {}
+func (nopObserver) ObserveStage(string) func(error)            { return func(error) {} }
+
+// parsedGame and gameRows carry the context of the game they belong to, so
+// that the spans of every stage end up under the span of the game.
+type parsedGame struct {
+	ctx  context.Context
+	game types.GameParser
+}
+
+type gameRows struct {
+	ctx  context.Context
+	game *types.GameParser
+	rows []types.GameDB
+}
+
 type parserWorkerConfig struct {
-	parser Parser
-	saver  Saver
+	parser     Parser
+	saver      Saver
+	gate       Gate
+	observer   Observer
+	deadLetter DeadLetter
+	rawStore   RawStore
+	roundEvent RoundEventSaver
+
+	parseConcurrency   int
+	flattenConcurrency int
+	saveConcurrency    int
+	orderWindow        int
+	gracePeriod        time.Duration
 }
 
 type ParserOpt func(*parserWorkerConfig)
@@ -34,46 +149,257 @@ func WithSaver(s Saver) ParserOpt {
 	}
 }
 
-func NewParserWorker(opts ...ParserOpt) func(ctx context.Context) error {
-	cfg := &parserWorkerConfig{}
+func WithGate(g Gate) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.gate = g
+	}
+}
+
+func WithObserver(o Observer) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.observer = o
+	}
+}
+
+// WithDeadLetter keeps the games dropped while flattening and the games
+// whose save failed. A failed save then no longer stops the saver.
+func WithDeadLetter(d DeadLetter) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.deadLetter = d
+	}
+}
+
+// WithRawStore stores the source of every game read before it is flattened.
+// A game whose source could not be stored is not flattened.
+func WithRawStore(s RawStore) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.rawStore = s
+	}
+}
+
+// WithRoundEventSaver saves the events of the rounds of every game once its
+// rows are saved. A game whose events could not be saved is dead-lettered.
+func WithRoundEventSaver(s RoundEventSaver) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.roundEvent = s
+	}
+}
+
+// WithParseConcurrency sets the number of goroutines reading and decoding games.
+func WithParseConcurrency(n int) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.parseConcurrency = n
+	}
+}
+
+// WithFlattenConcurrency sets the number of goroutines flattening games into rows.
+func WithFlattenConcurrency(n int) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.flattenConcurrency = n
+	}
+}
+
+// WithSaveConcurrency bounds the number of batches saved at the same time.
+func WithSaveConcurrency(n int) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.saveConcurrency = n
+	}
+}
+
+// WithOrdered makes the worker hand batches to the saver ordered by BeginAt.
+// Batches are reordered within a window of the given number of games, and
+// saving is serialized so the order is kept.
+func WithOrdered(window int) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.orderWindow = window
+	}
+}
+
+// WithGracePeriod lets the flatten and save stages finish the games already
+// read for up to d once the worker context is cancelled. Reading stops right
+// away. Without it in-flight games are dropped on cancellation.
+func WithGracePeriod(d time.Duration) ParserOpt {
+	return func(cfg *parserWorkerConfig) {
+		cfg.gracePeriod = d
+	}
+}
+
+func newParserWorkerConfig(opts ...ParserOpt) *parserWorkerConfig {
+	cfg := &parserWorkerConfig{observer: nopObserver{}}
 
 	for _, opt := range opts {
 		opt(cfg)
 	}
+
+	if cfg.parseConcurrency < 1 {
+		cfg.parseConcurrency = 1
+	}
+	if cfg.flattenConcurrency < 1 {
+		cfg.flattenConcurrency = 1
+	}
+	if cfg.saveConcurrency < 1 || cfg.orderWindow > 0 {
+		cfg.saveConcurrency = 1
+	}
+
+	return cfg
+}
+
+func NewParserWorker(opts ...ParserOpt) func(ctx context.Context) error {
+	cfg := newParserWorkerConfig(opts...)
+
 	return func(ctx context.Context) error {
-		return parse(ctx, cfg.parser, cfg.saver)
+		return parse(ctx, cfg)
 	}
 }
 
-func parse(
-	ctx context.Context,
-	p Parser,
-	s Saver,
-) error {
-	genCh := generatorGameParser(ctx, p)
-	flattenCh := flattenGameParser(ctx, genCh)
-	errCh := saveGameDB(ctx, s, flattenCh)
+func parse(ctx context.Context, cfg *parserWorkerConfig) error {
+	defer cfg.observer.ForgetQueues()
+
+	readCtx := ctx
+	ctx, cancel := drainContext(readCtx, cfg.gracePeriod)
+	defer cancel()
+
+	genChs := make([]<-chan parsedGame, cfg.parseConcurrency)
+	for i := range genChs {
+		genChs[i] = generatorGameParser(ctx, readCtx, gatedParser(cfg.parser, cfg.gate), cfg.observer)
+	}
+	genCh := merge(ctx, genChs...)
+	observeQueues(cfg.observer, logging.StageParse, genCh, genChs...)
+
+	if cfg.rawStore != nil {
+		rawChs := make([]<-chan parsedGame, cfg.parseConcurrency)
+		for i := range rawChs {
+			rawChs[i] = storeGameRaw(ctx, cfg.rawStore, genCh, cfg.observer, cfg.deadLetter)
+		}
+		genCh = merge(ctx, rawChs...)
+		observeQueues(cfg.observer, logging.StageRaw, genCh, rawChs...)
+	}
+
+	flattenChs := make([]<-chan gameRows, cfg.flattenConcurrency)
+	for i := range flattenChs {
+		flattenChs[i] = flattenGameParser(ctx, genCh, cfg.observer, cfg.deadLetter)
+	}
+	flattenCh := merge(ctx, flattenChs...)
+	observeQueues(cfg.observer, logging.StageFlatten, flattenCh, flattenChs...)
+
+	if cfg.orderWindow > 0 {
+		flattenCh = orderGameDB(ctx, flattenCh, cfg.orderWindow, cfg.observer)
+		observeQueues(cfg.observer, logging.StageOrder, flattenCh)
+	}
+
+	// The round events of a game are only saved once its rows are, so that
+	// no event is left without its game.
+	var saved chan gameRows
+	if cfg.roundEvent != nil {
+		saved = make(chan gameRows, 100)
+	}
+
+	errChs := make([]<-chan error, cfg.saveConcurrency)
+	for i := range errChs {
+		errChs[i] = saveGameDB(ctx, cfg.saver, flattenCh, cfg.observer, cfg.deadLetter, saved)
+	}
+	if saved != nil {
+		errChs = closeAfter(saved, errChs...)
+		observeQueues(cfg.observer, logging.StageRoundEvents, saved)
+		errChs = append(errChs, saveRoundEvents(ctx, cfg.roundEvent, saved, cfg.observer, cfg.deadLetter))
+	}
+	errCh := merge(ctx, errChs...)
+	observeQueues(cfg.observer, logging.StageSave, errCh, errChs...)
+
 	return logErrors(ctx, errCh)
 }
 
-func generatorGameParser(ctx context.Context, parser Parser) <-chan types.GameParser {
-	ch := make(chan types.GameParser, 100)
+// drainContext returns a context that outlives ctx by the grace period, so
+// the stages after the generators can empty their channels once reading has
+// stopped. Every stage returns as soon as its input is closed, so the
+// pipeline usually drains well before the grace period is over.
+func drainContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		if grace <= 0 {
+			cancel()
+			return
+		}
+
+		logger := logging.FromContext(ctx)
+		logger.Info("draining in-flight games", "grace_period", grace)
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-drainCtx.Done():
+		case <-timer.C:
+			logger.Warn("grace period expired, dropping in-flight games", "grace_period", grace)
+			cancel()
+		}
+	})
+
+	return drainCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// observeQueues registers the output channels of a stage and, when it is a
+// separate channel, the one they are merged into.
+func observeQueues[T any](o Observer, stage string, merged <-chan T, outs ...<-chan T) {
+	for _, ch := range outs {
+		if ch != merged {
+			o.ObserveQueue(stage, func() int { return len(ch) })
+		}
+	}
+	o.ObserveQueue(stage, func() int { return len(merged) })
+}
+
+// generatorGameParser reads games until readCtx is done; a game already read
+// is still handed on unless ctx is done too. Invalid game files are skipped.
+// The span of every game starts before it is read and ends once the game is
+// saved or dropped.
+func generatorGameParser(ctx, readCtx context.Context, parser Parser, observer Observer) <-chan parsedGame {
+	ch := make(chan parsedGame, 100)
+	logger := logging.FromContext(ctx).With(logging.Stage(logging.StageParse))
+	stopped := observer.ObserveStage(logging.StageParse)
 
 	go func() {
+		var stopErr error
 		defer close(ch)
+		defer func() { stopped(stopErr) }()
 		for {
 			select {
-			case <-ctx.Done():
+			case <-readCtx.Done():
 				return
 			default:
-				game, err := parser.Next(ctx)
+				gameCtx, span := tracing.Tracer().Start(ctx, "game")
+
+				game, err := parser.Next(trace.ContextWithSpan(readCtx, span))
 				if err != nil {
+					if errors.Is(err, io.EOF) || readCtx.Err() != nil {
+						endGameSpan(gameCtx, nil)
+						return
+					}
+					endGameSpan(gameCtx, err)
+					logger.Error("failed to read game", logging.Err(err))
+					// The parser has counted the file; the next one is read.
+					if errors.Is(err, repositories.ErrInvalidGameFile) {
+						continue
+					}
+					stopErr = err
 					return
 				}
 				if game == nil {
+					endGameSpan(gameCtx, nil)
 					continue
 				}
-				ch <- *game
+
+				trace.SpanFromContext(gameCtx).SetAttributes(tracing.AttrGameID.Int64(int64(game.ID)))
+				logger.Debug("game read", logging.GameID(int64(game.ID)))
+
+				select {
+				case <-ctx.Done():
+					endGameSpan(gameCtx, ctx.Err())
+					return
+				case ch <- parsedGame{ctx: gameCtx, game: *game}:
+				}
 			}
 		}
 	}()
@@ -81,8 +407,146 @@ func generatorGameParser(ctx context.Context, parser Parser) <-chan types.GamePa
 	return ch
 }
 
-func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan []types.GameDB {
-	out := make(chan []types.GameDB, 100)
+func endGameSpan(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	tracing.RecordError(span, err)
+	span.End()
+}
+
+type gatedParserFunc func(ctx context.Context) (*types.GameParser, error)
+
+func (f gatedParserFunc) Next(ctx context.Context) (*types.GameParser, error) {
+	return f(ctx)
+}
+
+func gatedParser(p Parser, g Gate) Parser {
+	if g == nil {
+		return p
+	}
+	return gatedParserFunc(func(ctx context.Context) (*types.GameParser, error) {
+		if err := g.Wait(ctx); err != nil {
+			return nil, err
+		}
+		return p.Next(ctx)
+	})
+}
+
+// storeGameRaw stores the source of the games before handing them on,
+// together with the games already waiting. Games without a source, such as
+// replayed dead letters, are handed on as is.
+func storeGameRaw(ctx context.Context, store RawStore, in <-chan parsedGame, observer Observer, deadLetter DeadLetter) <-chan parsedGame {
+	out := make(chan parsedGame, 100)
+	logger := logging.FromContext(ctx).With(logging.Stage(logging.StageRaw))
+	stopped := observer.ObserveStage(logging.StageRaw)
+
+	go func() {
+		defer close(out)
+		defer stopped(nil)
+
+		items := make([]parsedGame, 0, waitingBatchMax)
+		raws := make([]types.GameRaw, 0, waitingBatchMax)
+		for {
+			var ok bool
+			if items, ok = receiveWaiting(ctx, in, items[:0]); !ok {
+				return
+			}
+
+			raws = raws[:0]
+			ingestedAt := time.Now().UTC().Truncate(time.Millisecond)
+			for _, item := range items {
+				if item.game.Raw == nil {
+					continue
+				}
+				sum := sha256.Sum256(item.game.Raw)
+				raws = append(raws, types.GameRaw{
+					GameID:     item.game.ID,
+					File:       item.game.File,
+					Hash:       hex.EncodeToString(sum[:]),
+					Payload:    item.game.Raw,
+					IngestedAt: ingestedAt,
+				})
+			}
+
+			var err error
+			if len(raws) > 0 {
+				_, span := tracing.Tracer().Start(items[0].ctx, "store raw",
+					trace.WithAttributes(tracing.AttrBatchRows.Int(len(raws))),
+				)
+				err = store.Save(ctx, raws)
+				tracing.RecordError(span, err)
+				span.End()
+			}
+
+			var rejected []parsedGame
+			for _, item := range items {
+				game := item.game
+				if err != nil && game.Raw != nil {
+					if ctx.Err() != nil {
+						endGameSpan(item.ctx, ctx.Err())
+						continue
+					}
+					logger.Error("failed to store raw game",
+						logging.GameID(game.ID),
+						logging.File(game.File),
+						logging.Err(err),
+					)
+					observer.ObserveGameDropped(game.File, DropReasonRaw)
+					rejected = append(rejected, item)
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					endGameSpan(item.ctx, ctx.Err())
+				case out <- item:
+				}
+			}
+
+			games := make([]*types.GameParser, len(rejected))
+			for i := range rejected {
+				games[i] = &rejected[i].game
+			}
+			putDeadLetters(ctx, deadLetter, games, logging.StageRaw, err)
+			for _, item := range rejected {
+				endGameSpan(item.ctx, err)
+			}
+		}
+	}()
+
+	return out
+}
+
+// receiveWaiting waits for an item, then appends it and the items already
+// waiting, up to waitingBatchMax. It reports false once in is closed and
+// drained, or ctx is done.
+func receiveWaiting[T any](ctx context.Context, in <-chan T, items []T) ([]T, bool) {
+	select {
+	case <-ctx.Done():
+		return items, false
+	case item, ok := <-in:
+		if !ok {
+			return items, false
+		}
+		items = append(items, item)
+	}
+
+	for len(items) < waitingBatchMax {
+		select {
+		case item, ok := <-in:
+			if !ok {
+				return items, true
+			}
+			items = append(items, item)
+		default:
+			return items, true
+		}
+	}
+	return items, true
+}
+
+func flattenGameParser(ctx context.Context, in <-chan parsedGame, observer Observer, deadLetter DeadLetter) <-chan gameRows {
+	out := make(chan gameRows, 100)
+	logger := logging.FromContext(ctx).With(logging.Stage(logging.StageFlatten))
 
 	boolToInt64 := func(b bool) int64 {
 		if b {
@@ -104,17 +568,21 @@ func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan [
 	roundOutcomeMap["eliminated"] = 3
 	roundOutcomeMap["timeout"] = 4
 
+	stopped := observer.ObserveStage(logging.StageFlatten)
 	go func() {
 		defer close(out)
+		defer stopped(nil)
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case game, ok := <-in:
+			case item, ok := <-in:
 				if !ok {
 					return
 				}
+				game := item.game
+				_, span := tracing.Tracer().Start(item.ctx, "flatten")
 
 				teamPlayers := make(map[int][]types.PlayerStatisticParser)
 				for _, p := range game.Players {
@@ -127,6 +595,13 @@ func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan [
 				}
 
 				if len(teamIDs) != 2 {
+					logger.Warn("skipping game without two teams", logging.GameID(int64(game.ID)), "teams", len(teamIDs))
+					observer.ObserveGameDropped(game.File, DropReasonTeams)
+					putDeadLetter(item.ctx, deadLetter, &game, logging.StageFlatten,
+						fmt.Errorf("game has %d teams, expected 2", len(teamIDs)))
+					span.SetAttributes(tracing.AttrDropReason.String(DropReasonTeams))
+					span.End()
+					endGameSpan(item.ctx, nil)
 					continue
 				}
 
@@ -138,9 +613,20 @@ func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan [
 				tier, ok := serieTierMap[game.Match.Serie.Tier]
 				if !ok {
 					tier = 0
+					observer.ObserveUnknownValue(game.File, FieldTier, game.Match.Serie.Tier)
+				}
+
+				unknownOutcomes := make(map[string]bool)
+				for _, r := range game.Rounds {
+					if _, ok := roundOutcomeMap[r.Outcome]; !ok && !unknownOutcomes[r.Outcome] {
+						unknownOutcomes[r.Outcome] = true
+						observer.ObserveUnknownValue(game.File, FieldRoundOutcome, r.Outcome)
+					}
 				}
 
-				var batch []types.GameDB
+				ingestedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+				batch := make([]types.GameDB, 0, 2*len(teamPlayers[teamIDs[0]])*len(teamPlayers[teamIDs[1]])*len(game.Rounds))
 
 				for _, pair := range teamPairIDs {
 					tID, tOppID := pair[0], pair[1]
@@ -184,6 +670,11 @@ func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan [
 									RoundID:        int64(r.Round),
 									RoundOutcomeID: int64(outcomeID),
 									RoundWin:       boolToInt64(int(r.WinnerTeam) == tID),
+
+									Version:    uint64(ingestedAt.UnixMilli()),
+									IngestedAt: ingestedAt,
+
+									Length: game.Length,
 								}
 
 								batch = append(batch, gameDB)
@@ -192,8 +683,30 @@ func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan [
 					}
 				}
 
-				if len(batch) > 0 {
-					out <- batch
+				// One record per game, so only at debug level.
+				logger.Debug("game flattened",
+					logging.GameID(int64(game.ID)),
+					logging.BatchRows(len(batch)),
+					"rounds", len(game.Rounds),
+				)
+
+				span.SetAttributes(tracing.AttrRows.Int(len(batch)))
+				if len(batch) == 0 {
+					observer.ObserveGameDropped(game.File, DropReasonNoRows)
+					putDeadLetter(item.ctx, deadLetter, &game, logging.StageFlatten, errors.New("game has no rows"))
+					span.SetAttributes(tracing.AttrDropReason.String(DropReasonNoRows))
+					span.End()
+					endGameSpan(item.ctx, nil)
+					continue
+				}
+				span.End()
+				observer.ObserveFlattened(game.File, len(batch))
+
+				select {
+				case <-ctx.Done():
+					endGameSpan(item.ctx, ctx.Err())
+					return
+				case out <- gameRows{ctx: item.ctx, game: &game, rows: batch}:
 				}
 			}
 		}
@@ -202,22 +715,37 @@ func flattenGameParser(ctx context.Context, in <-chan types.GameParser) <-chan [
 	return out
 }
 
-func saveGameDB(ctx context.Context, saver Saver, in <-chan []types.GameDB) <-chan error {
+// saveGameDB hands the rows of every game to the saver. A game counts as
+// saved, and its span ends, once the saver has written its rows; it is then
+// sent to saved, if given. A BatchSaver is handed games without waiting, and
+// they are confirmed in order as their batches are flushed.
+func saveGameDB(ctx context.Context, saver Saver, in <-chan gameRows, observer Observer, deadLetter DeadLetter, saved chan<- gameRows) <-chan error {
+	if batchSaver, ok := saver.(BatchSaver); ok {
+		return enqueueGameDB(ctx, batchSaver, in, observer, deadLetter, saved)
+	}
+
 	errCh := make(chan error, 1)
+	stopped := observer.ObserveStage(logging.StageSave)
 
 	go func() {
+		var stopErr error
 		defer close(errCh)
+		defer func() { stopped(stopErr) }()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case batch, ok := <-in:
+			case item, ok := <-in:
 				if !ok {
 					return
 				}
-				if err := saver.Save(ctx, batch); err != nil {
+
+				saveCtx, span := startSaveSpan(item)
+				err := saver.Save(saveCtx, item.rows)
+				if err = confirmSaved(ctx, item, span, err, observer, deadLetter, saved); err != nil {
 					errCh <- err
+					stopErr = err
 					return
 				}
 			}
@@ -227,21 +755,365 @@ func saveGameDB(ctx context.Context, saver Saver, in <-chan []types.GameDB) <-ch
 	return errCh
 }
 
-func logErrors(ctx context.Context, in <-chan error) error {
+func enqueueGameDB(ctx context.Context, saver BatchSaver, in <-chan gameRows, observer Observer, deadLetter DeadLetter, saved chan<- gameRows) <-chan error {
+	errCh := make(chan error, 1)
+	logger := logging.FromContext(ctx).With(logging.Stage(logging.StageSave))
+
+	type pendingSave struct {
+		item gameRows
+		span trace.Span
+		done <-chan error
+	}
+	pending := make(chan pendingSave, pendingSavesMax)
+	enqueueCtx, stop := context.WithCancel(ctx)
+	enqueued := observer.ObserveStage(logging.StageSave)
+	confirmed := observer.ObserveStage(logging.StageSave)
+
+	go func() {
+		defer close(pending)
+		defer enqueued(nil)
+
+		for {
+			select {
+			case <-enqueueCtx.Done():
+				return
+			case item, ok := <-in:
+				if !ok {
+					// Games below the batch thresholds must not wait for the
+					// next interval, or forever without one.
+					if err := saver.Flush(enqueueCtx); err != nil {
+						logger.Debug("flush at end of input failed", logging.Err(err))
+					}
+					return
+				}
+				if len(pending) == cap(pending) {
+					if err := saver.Flush(enqueueCtx); err != nil {
+						logger.Debug("flush of pending games failed", logging.Err(err))
+					}
+				}
+
+				saveCtx, span := startSaveSpan(item)
+				p := pendingSave{item: item, span: span, done: saver.Enqueue(saveCtx, item.rows)}
+				select {
+				case <-enqueueCtx.Done():
+					span.End()
+					endGameSpan(item.ctx, enqueueCtx.Err())
+					return
+				case pending <- p:
+				}
+			}
+		}
+	}()
+
+	go func() {
+		var stopErr error
+		defer close(errCh)
+		defer func() { confirmed(stopErr) }()
+		defer stop()
+
+		var failed bool
+		fail := func(err error) {
+			errCh <- err
+			failed = true
+			stopErr = err
+			stop()
+		}
+
+		// The games of a failed flush are rejected with the same error at
+		// once, and dead-lettered together.
+		var rejected []pendingSave
+		var rejectedErr error
+		putRejected := func() {
+			if len(rejected) == 0 {
+				return
+			}
+			games := make([]*types.GameParser, len(rejected))
+			for i, p := range rejected {
+				tracing.RecordError(p.span, rejectedErr)
+				p.span.End()
+				endGameSpan(p.item.ctx, rejectedErr)
+				games[i] = p.item.game
+			}
+			if !putDeadLetters(ctx, deadLetter, games, logging.StageSave, rejectedErr) {
+				logger.Error("failed to save game",
+					logging.GameID(games[0].ID),
+					logging.BatchRows(len(rejected[0].item.rows)),
+					logging.Err(rejectedErr),
+				)
+				fail(rejectedErr)
+			}
+			rejected, rejectedErr = nil, nil
+		}
+
+		for p := range pending {
+			var err error
+			select {
+			case err = <-p.done:
+			default:
+				putRejected()
+				select {
+				case err = <-p.done:
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
+			if !errors.Is(err, rejectedErr) {
+				putRejected()
+			}
+
+			// Once a game failed, the others handed over are not confirmed:
+			// the pipeline is stopping.
+			if failed {
+				err = cmp.Or(err, errors.New("not confirmed after an earlier save failed"))
+				tracing.RecordError(p.span, err)
+				p.span.End()
+				endGameSpan(p.item.ctx, err)
+				continue
+			}
+
+			// Errors from cancellation are not the game's fault.
+			if err != nil && deadLetter != nil && p.item.game != nil && ctx.Err() == nil {
+				rejected, rejectedErr = append(rejected, p), err
+				continue
+			}
+			if err = confirmSaved(ctx, p.item, p.span, err, observer, deadLetter, saved); err != nil {
+				fail(err)
+			}
+		}
+		putRejected()
+	}()
+
+	return errCh
+}
+
+func startSaveSpan(item gameRows) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(item.ctx, "save",
+		trace.WithAttributes(tracing.AttrBatchRows.Int(len(item.rows))),
+	)
+}
+
+// confirmSaved ends the spans of a game once the saver is done with it and,
+// if its rows were not saved, dead-letters it. It returns the error unless
+// the game was dead-lettered.
+func confirmSaved(ctx context.Context, item gameRows, span trace.Span, err error, observer Observer, deadLetter DeadLetter, saved chan<- gameRows) error {
+	tracing.RecordError(span, err)
+	span.End()
+	endGameSpan(item.ctx, err)
+
+	batch := item.rows
+	// Errors from cancellation are not the game's fault.
+	if err != nil && deadLetter != nil && item.game != nil && ctx.Err() == nil {
+		if putDeadLetter(item.ctx, deadLetter, item.game, logging.StageSave, err) {
+			return nil
+		}
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to save game",
+			logging.Stage(logging.StageSave),
+			logging.GameID(batch[0].GameID),
+			logging.BatchRows(len(batch)),
+			logging.Err(err),
+		)
+		return err
+	}
+	observer.ObserveSaved(batch)
+
+	if saved != nil {
+		select {
+		case <-ctx.Done():
+		case saved <- item:
+		}
+	}
+	return nil
+}
+
+// putDeadLetter hands a rejected game to the dead letter, if any, and
+// reports whether it was kept.
+func putDeadLetter(ctx context.Context, deadLetter DeadLetter, game *types.GameParser, stage string, cause error) bool {
+	return putDeadLetters(ctx, deadLetter, []*types.GameParser{game}, stage, cause)
+}
+
+// putDeadLetters hands games rejected for the same cause to the dead letter
+// at once, and reports whether they were kept.
+func putDeadLetters(ctx context.Context, deadLetter DeadLetter, games []*types.GameParser, stage string, cause error) bool {
+	if deadLetter == nil || len(games) == 0 {
+		return false
+	}
+
+	logger := logging.FromContext(ctx).With(logging.Stage(stage))
+
+	failedAt := time.Now().UTC()
+	entries := make([]types.DeadLetter, len(games))
+	for i, game := range games {
+		// The source is kept as read, so that fields not decoded are not lost.
+		payload := json.RawMessage(game.Raw)
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(game); err != nil {
+				logger.Error("failed to dead-letter game", logging.GameID(game.ID), logging.File(game.File), "cause", cause, logging.Err(err))
+				return false
+			}
+		}
+		entries[i] = types.DeadLetter{
+			GameID:   game.ID,
+			File:     game.File,
+			Stage:    stage,
+			Error:    cause.Error(),
+			FailedAt: failedAt,
+			Payload:  payload,
+		}
+	}
+
+	if err := deadLetter.Put(ctx, entries...); err != nil {
+		for _, game := range games {
+			logger.Error("failed to dead-letter game", logging.GameID(game.ID), logging.File(game.File), "cause", cause, logging.Err(err))
+		}
+		return false
+	}
+
+	for _, game := range games {
+		logger.Warn("game dead-lettered", logging.GameID(game.ID), logging.File(game.File), logging.Err(cause))
+	}
+	return true
+}
+
+func orderGameDB(ctx context.Context, in <-chan gameRows, window int, observer Observer) <-chan gameRows {
+	out := make(chan gameRows, 100)
+	stopped := observer.ObserveStage(logging.StageOrder)
+
 	go func() {
+		defer close(out)
+		defer stopped(nil)
+
+		var pending gameDBHeap
+
+		send := func(batch gameRows) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case out <- batch:
+				return true
+			}
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case err, ok := <-in:
+			case batch, ok := <-in:
 				if !ok {
+					for pending.Len() > 0 {
+						if !send(heap.Pop(&pending).(gameRows)) {
+							return
+						}
+					}
 					return
 				}
-				if err != nil {
-					log.Printf("error: %v", err)
+				if len(batch.rows) == 0 {
+					continue
+				}
+
+				heap.Push(&pending, batch)
+				if pending.Len() > window {
+					if !send(heap.Pop(&pending).(gameRows)) {
+						return
+					}
 				}
 			}
 		}
 	}()
+
+	return out
+}
+
+// gameDBHeap is a min-heap of per-game batches keyed by (BeginAt, GameID).
+type gameDBHeap []gameRows
+
+func (h gameDBHeap) Len() int { return len(h) }
+
+func (h gameDBHeap) Less(i, j int) bool {
+	a, b := h[i].rows[0], h[j].rows[0]
+	if !a.BeginAt.Equal(b.BeginAt) {
+		return a.BeginAt.Before(b.BeginAt)
+	}
+	return a.GameID < b.GameID
+}
+
+func (h gameDBHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *gameDBHeap) Push(x any) { *h = append(*h, x.(gameRows)) }
+
+func (h *gameDBHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+func merge[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	if len(ins) == 1 {
+		return ins[0]
+	}
+
+	out := make(chan T, 100)
+
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go func(in <-chan T) {
+			defer wg.Done()
+			for v := range in {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- v:
+				}
+			}
+		}(in)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// closeAfter forwards every channel of ins, with the same buffer, and closes
+// done once they are all closed: then nothing is sent to done anymore.
+func closeAfter[T, U any](done chan U, ins ...<-chan T) []<-chan T {
+	outs := make([]<-chan T, len(ins))
+
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for i, in := range ins {
+		out := make(chan T, cap(in))
+		outs[i] = out
+		go func() {
+			defer wg.Done()
+			defer close(out)
+			for v := range in {
+				out <- v
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return outs
+}
+
+func logErrors(ctx context.Context, in <-chan error) error {
+	logger := logging.FromContext(ctx)
+	for err := range in {
+		if err != nil {
+			logger.Error("saver stopped", logging.Stage(logging.StageSave), logging.Err(err))
+		}
+	}
 	return nil
 }
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: /home/sergey/Go/cs2/internal/workers/parser.go
+// Source: internal/workers/parser.go
 
 // Package workers is a generated GoMock package.
 package workers
@@ -86,3 +86,156 @@ func (mr *MockSaverMockRecorder) Save(ctx, games interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockSaver)(nil).Save), ctx, games)
 }
+
+// MockGate is a mock of Gate interface.
+type MockGate struct {
+	ctrl     *gomock.Controller
+	recorder *MockGateMockRecorder
+}
+
+// MockGateMockRecorder is the mock recorder for MockGate.
+type MockGateMockRecorder struct {
+	mock *MockGate
+}
+
+// NewMockGate creates a new mock instance.
+func NewMockGate(ctrl *gomock.Controller) *MockGate {
+	mock := &MockGate{ctrl: ctrl}
+	mock.recorder = &MockGateMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockGate) EXPECT() *MockGateMockRecorder {
+	return m.recorder
+}
+
+// Wait mocks base method.
+func (m *MockGate) Wait(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Wait", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Wait indicates an expected call of Wait.
+func (mr *MockGateMockRecorder) Wait(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wait", reflect.TypeOf((*MockGate)(nil).Wait), ctx)
+}
+
+// MockDeadLetter is a mock of DeadLetter interface.
+type MockDeadLetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterMockRecorder
+}
+
+// MockDeadLetterMockRecorder is the mock recorder for MockDeadLetter.
+type MockDeadLetterMockRecorder struct {
+	mock *MockDeadLetter
+}
+
+// NewMockDeadLetter creates a new mock instance.
+func NewMockDeadLetter(ctrl *gomock.Controller) *MockDeadLetter {
+	mock := &MockDeadLetter{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetter) EXPECT() *MockDeadLetterMockRecorder {
+	return m.recorder
+}
+
+// Put mocks base method.
+func (m *MockDeadLetter) Put(ctx context.Context, entries ...types.DeadLetter) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range entries {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Put", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockDeadLetterMockRecorder) Put(ctx interface{}, entries ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, entries...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockDeadLetter)(nil).Put), varargs...)
+}
+
+// MockRawStore is a mock of RawStore interface.
+type MockRawStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRawStoreMockRecorder
+}
+
+// MockRawStoreMockRecorder is the mock recorder for MockRawStore.
+type MockRawStoreMockRecorder struct {
+	mock *MockRawStore
+}
+
+// NewMockRawStore creates a new mock instance.
+func NewMockRawStore(ctrl *gomock.Controller) *MockRawStore {
+	mock := &MockRawStore{ctrl: ctrl}
+	mock.recorder = &MockRawStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRawStore) EXPECT() *MockRawStoreMockRecorder {
+	return m.recorder
+}
+
+// Save mocks base method.
+func (m *MockRawStore) Save(ctx context.Context, games []types.GameRaw) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, games)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockRawStoreMockRecorder) Save(ctx, games interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockRawStore)(nil).Save), ctx, games)
+}
+
+// MockRoundEventSaver is a mock of RoundEventSaver interface.
+type MockRoundEventSaver struct {
+	ctrl     *gomock.Controller
+	recorder *MockRoundEventSaverMockRecorder
+}
+
+// MockRoundEventSaverMockRecorder is the mock recorder for MockRoundEventSaver.
+type MockRoundEventSaverMockRecorder struct {
+	mock *MockRoundEventSaver
+}
+
+// NewMockRoundEventSaver creates a new mock instance.
+func NewMockRoundEventSaver(ctrl *gomock.Controller) *MockRoundEventSaver {
+	mock := &MockRoundEventSaver{ctrl: ctrl}
+	mock.recorder = &MockRoundEventSaverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRoundEventSaver) EXPECT() *MockRoundEventSaverMockRecorder {
+	return m.recorder
+}
+
+// Save mocks base method.
+func (m *MockRoundEventSaver) Save(ctx context.Context, events []types.RoundEventDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, events)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockRoundEventSaverMockRecorder) Save(ctx, events interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockRoundEventSaver)(nil).Save), ctx, events)
+}
@@ -1,14 +1,30 @@
 package workers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/repositories"
+	"github.com/sbilibin2017/cs2/internal/tracing"
 	"github.com/sbilibin2017/cs2/internal/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // --- Test NewParserWorker wrapper ---
@@ -41,7 +57,7 @@ func TestGeneratorGameParser_ContextDone(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // cancel immediately
 
-	ch := generatorGameParser(ctx, mockParser)
+	ch := generatorGameParser(ctx, ctx, mockParser, nopObserver{})
 
 	// channel should be closed immediately
 	_, ok := <-ch
@@ -68,10 +84,58 @@ func TestGeneratorGameParser_ReceivesGame(t *testing.T) {
 		return nil, errors.New("stop") // stop after 2 calls
 	}).AnyTimes()
 
-	ch := generatorGameParser(ctx, mockParser)
+	ch := generatorGameParser(ctx, ctx, mockParser, nopObserver{})
 
 	received := <-ch
-	assert.Equal(t, *expectedGame, received)
+	assert.Equal(t, *expectedGame, received.game)
+}
+
+func TestGeneratorGameParser_SkipsInvalidGameFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := NewMockParser(ctrl)
+	ctx := context.Background()
+
+	gomock.InOrder(
+		mockParser.EXPECT().Next(gomock.Any()).Return(nil, fmt.Errorf("0.json: %w", repositories.ErrInvalidGameFile)),
+		mockParser.EXPECT().Next(gomock.Any()).Return(&types.GameParser{ID: 1}, nil),
+		mockParser.EXPECT().Next(gomock.Any()).Return(&types.GameParser{ID: 2}, nil),
+		mockParser.EXPECT().Next(gomock.Any()).Return(nil, io.EOF),
+	)
+
+	var ids []int64
+	for item := range generatorGameParser(ctx, ctx, mockParser, nopObserver{}) {
+		ids = append(ids, item.game.ID)
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+}
+
+func TestGeneratorGameParser_ObservesStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected []string
+	}{
+		{name: "End of input", err: io.EOF, expected: []string{"parse"}},
+		{name: "Read error", err: errors.New("disk gone"), expected: []string{"parse: disk gone"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockParser := NewMockParser(ctrl)
+			mockParser.EXPECT().Next(gomock.Any()).Return(nil, tt.err)
+
+			observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+			ctx := context.Background()
+			for range generatorGameParser(ctx, ctx, mockParser, observer) {
+			}
+			assert.Equal(t, tt.expected, observer.stopped)
+		})
+	}
 }
 
 // --- Test flattenGameParser ---
@@ -80,8 +144,9 @@ func TestFlattenGameParser_ProperOutput(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	in := make(chan types.GameParser, 1)
+	in := make(chan parsedGame, 1)
 
+	length := int64(2400)
 	game := types.GameParser{
 		ID:      1,
 		BeginAt: time.Now(),
@@ -99,14 +164,16 @@ func TestFlattenGameParser_ProperOutput(t *testing.T) {
 			{Round: 1, Outcome: "defused", WinnerTeam: 1000},
 			{Round: 2, Outcome: "exploded", WinnerTeam: 2000},
 		},
+		Length: &length,
 	}
 
-	in <- game
+	in <- parsedGame{ctx: ctx, game: game}
 	close(in)
 
-	out := flattenGameParser(ctx, in)
+	out := flattenGameParser(ctx, in, nopObserver{}, nil)
 
-	batch, ok := <-out
+	item, ok := <-out
+	batch := item.rows
 	assert.True(t, ok)
 	assert.Greater(t, len(batch), 0)
 
@@ -114,17 +181,79 @@ func TestFlattenGameParser_ProperOutput(t *testing.T) {
 		assert.Equal(t, int64(game.ID), g.GameID)
 		assert.Contains(t, []int64{1000, 2000}, g.TeamID)
 		assert.Contains(t, []int64{1000, 2000}, g.TeamOpponentID)
+		assert.Equal(t, batch[0].Version, g.Version)
+		assert.Equal(t, uint64(g.IngestedAt.UnixMilli()), g.Version)
+		assert.Equal(t, game.Length, g.Length)
 	}
 
 	_, ok = <-out
 	assert.False(t, ok)
 }
 
+func TestFlattenGameParser_LogsGameFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := logging.WithLogger(context.Background(), logger)
+
+	in := make(chan parsedGame, 2)
+	in <- parsedGame{ctx: ctx, game: types.GameParser{
+		ID: 7,
+		Players: []types.PlayerStatisticParser{
+			{Player: types.PlayerParser{ID: 1}, Team: types.TeamParser{ID: 1000}},
+			{Player: types.PlayerParser{ID: 2}, Team: types.TeamParser{ID: 2000}},
+		},
+		Rounds: []types.RoundParser{{Round: 1}, {Round: 2}},
+	}}
+	in <- parsedGame{ctx: ctx, game: types.GameParser{ID: 8}}
+	close(in)
+
+	for range flattenGameParser(ctx, in, nopObserver{}, nil) {
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var flattened, skipped map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &flattened))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &skipped))
+
+	assert.Equal(t, "game flattened", flattened["msg"])
+	assert.Equal(t, "DEBUG", flattened["level"])
+	assert.Equal(t, "flatten", flattened[logging.KeyStage])
+	assert.EqualValues(t, 7, flattened[logging.KeyGameID])
+	assert.EqualValues(t, 4, flattened[logging.KeyBatchRows])
+
+	assert.Equal(t, "WARN", skipped["level"])
+	assert.EqualValues(t, 8, skipped[logging.KeyGameID])
+}
+
+func TestFlattenGameParser_GameFlattenedOnlyAtDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	ctx := logging.WithLogger(context.Background(), logger)
+
+	in := make(chan parsedGame, 1)
+	in <- parsedGame{ctx: ctx, game: types.GameParser{
+		ID: 7,
+		Players: []types.PlayerStatisticParser{
+			{Player: types.PlayerParser{ID: 1}, Team: types.TeamParser{ID: 1000}},
+			{Player: types.PlayerParser{ID: 2}, Team: types.TeamParser{ID: 2000}},
+		},
+		Rounds: []types.RoundParser{{Round: 1}},
+	}}
+	close(in)
+
+	for range flattenGameParser(ctx, in, nopObserver{}, nil) {
+	}
+
+	assert.Empty(t, buf.String())
+}
+
 func TestFlattenGameParser_ContextCancelStops(t *testing.T) {
-	in := make(chan types.GameParser)
+	in := make(chan parsedGame)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	out := flattenGameParser(ctx, in)
+	out := flattenGameParser(ctx, in, nopObserver{}, nil)
 
 	cancel() // cancel context
 
@@ -132,6 +261,102 @@ func TestFlattenGameParser_ContextCancelStops(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestFlattenGameParser_DeadLettersDroppedGame(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	game := types.GameParser{
+		ID:      8,
+		Players: []types.PlayerStatisticParser{{Team: types.TeamParser{ID: 1000}}},
+		File:    "8.json",
+	}
+
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, entry types.DeadLetter) error {
+		assert.Equal(t, int64(8), entry.GameID)
+		assert.Equal(t, "8.json", entry.File)
+		assert.Equal(t, logging.StageFlatten, entry.Stage)
+		assert.Equal(t, "game has 1 teams, expected 2", entry.Error)
+		assert.False(t, entry.FailedAt.IsZero())
+
+		var payload types.GameParser
+		require.NoError(t, json.Unmarshal(entry.Payload, &payload))
+		assert.Equal(t, int64(8), payload.ID)
+		assert.Len(t, payload.Players, 1)
+		return nil
+	})
+
+	in := make(chan parsedGame, 1)
+	in <- parsedGame{ctx: ctx, game: game}
+	close(in)
+
+	for range flattenGameParser(ctx, in, nopObserver{}, mockDeadLetter) {
+		t.Fatal("dropped game was flattened")
+	}
+}
+
+// --- Test storeGameRaw ---
+
+func TestStoreGameRaw_StoresWaitingGamesTogether(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockRawStore(ctrl)
+	ctx := context.Background()
+
+	in := make(chan parsedGame, 3)
+	in <- parsedGame{ctx: ctx, game: types.GameParser{ID: 1, File: "1.json", Raw: []byte(`{"id":1}`)}}
+	in <- parsedGame{ctx: ctx, game: types.GameParser{ID: 2, File: "2.json", Raw: []byte(`{"id":2}`)}}
+	// A replayed dead letter has no source to store.
+	in <- parsedGame{ctx: ctx, game: types.GameParser{ID: 3}}
+	close(in)
+
+	mockStore.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, games []types.GameRaw) error {
+		require.Len(t, games, 2)
+		assert.Equal(t, int64(1), games[0].GameID)
+		assert.Equal(t, "1.json", games[0].File)
+		assert.Equal(t, `{"id":1}`, string(games[0].Payload))
+		assert.Equal(t, "037c9214eef74cc3887f3a4f085b4e17d76280dafd273b0ee160c09c4ba1cfd4", games[0].Hash)
+		assert.NotEqual(t, games[0].Hash, games[1].Hash)
+		assert.False(t, games[0].IngestedAt.IsZero())
+		return nil
+	})
+
+	var ids []int64
+	for item := range storeGameRaw(ctx, mockStore, in, nopObserver{}, nil) {
+		ids = append(ids, item.game.ID)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+}
+
+func TestStoreGameRaw_DropsGameNotStored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := NewMockRawStore(ctrl)
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	ctx := context.Background()
+
+	in := make(chan parsedGame, 1)
+	in <- parsedGame{ctx: ctx, game: types.GameParser{ID: 1, File: "1.json", Raw: []byte(`{"id":1,"vendor":"x"}`)}}
+	close(in)
+
+	mockStore.EXPECT().Save(gomock.Any(), gomock.Any()).Return(errors.New("fail"))
+	mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, entry types.DeadLetter) error {
+		assert.Equal(t, int64(1), entry.GameID)
+		assert.Equal(t, logging.StageRaw, entry.Stage)
+		assert.Equal(t, "fail", entry.Error)
+		// The source is kept as read.
+		assert.JSONEq(t, `{"id":1,"vendor":"x"}`, string(entry.Payload))
+		return nil
+	})
+
+	for range storeGameRaw(ctx, mockStore, in, nopObserver{}, mockDeadLetter) {
+		t.Fatal("game not stored was handed on")
+	}
+}
+
 // --- Test saveGameDB ---
 
 func TestSaveGameDB_SavesBatches(t *testing.T) {
@@ -142,13 +367,13 @@ func TestSaveGameDB_SavesBatches(t *testing.T) {
 	ctx := context.Background()
 
 	batch := []types.GameDB{{GameID: 1}}
-	in := make(chan []types.GameDB, 1)
-	in <- batch
+	in := make(chan gameRows, 1)
+	in <- gameRows{ctx: ctx, rows: batch}
 	close(in)
 
-	mockSaver.EXPECT().Save(ctx, batch).Return(nil)
+	mockSaver.EXPECT().Save(gomock.Any(), batch).Return(nil)
 
-	errCh := saveGameDB(ctx, mockSaver, in)
+	errCh := saveGameDB(ctx, mockSaver, in, nopObserver{}, nil, nil)
 
 	err, ok := <-errCh
 	assert.False(t, ok) // channel closed without error
@@ -163,13 +388,14 @@ func TestSaveGameDB_SaveErrorPropagated(t *testing.T) {
 	ctx := context.Background()
 
 	batch := []types.GameDB{{GameID: 1}}
-	in := make(chan []types.GameDB, 1)
-	in <- batch
+	in := make(chan gameRows, 1)
+	in <- gameRows{ctx: ctx, rows: batch}
 	close(in)
 
-	mockSaver.EXPECT().Save(ctx, batch).Return(errors.New("fail"))
+	mockSaver.EXPECT().Save(gomock.Any(), batch).Return(errors.New("fail"))
 
-	errCh := saveGameDB(ctx, mockSaver, in)
+	observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+	errCh := saveGameDB(ctx, mockSaver, in, observer, nil, nil)
 
 	err, ok := <-errCh
 	assert.True(t, ok)
@@ -178,6 +404,63 @@ func TestSaveGameDB_SaveErrorPropagated(t *testing.T) {
 	// channel closes after sending error
 	_, ok = <-errCh
 	assert.False(t, ok)
+	assert.Equal(t, []string{"save: fail"}, observer.stopped)
+}
+
+func TestSaveGameDB_DeadLettersFailedGame(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSaver := NewMockSaver(ctrl)
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	ctx := context.Background()
+
+	failed := []types.GameDB{{GameID: 1}}
+	saved := []types.GameDB{{GameID: 2}}
+	in := make(chan gameRows, 2)
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 1}, rows: failed}
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 2}, rows: saved}
+	close(in)
+
+	gomock.InOrder(
+		mockSaver.EXPECT().Save(gomock.Any(), failed).Return(errors.New("fail")),
+		mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, entry types.DeadLetter) error {
+			assert.Equal(t, int64(1), entry.GameID)
+			assert.Equal(t, logging.StageSave, entry.Stage)
+			assert.Equal(t, "fail", entry.Error)
+			return nil
+		}),
+		// The saver carries on with the next game.
+		mockSaver.EXPECT().Save(gomock.Any(), saved).Return(nil),
+	)
+
+	errCh := saveGameDB(ctx, mockSaver, in, nopObserver{}, mockDeadLetter, nil)
+
+	_, ok := <-errCh
+	assert.False(t, ok)
+}
+
+func TestSaveGameDB_DeadLetterErrorPropagated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSaver := NewMockSaver(ctrl)
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	ctx := context.Background()
+
+	batch := []types.GameDB{{GameID: 1}}
+	in := make(chan gameRows, 1)
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 1}, rows: batch}
+	close(in)
+
+	mockSaver.EXPECT().Save(gomock.Any(), batch).Return(errors.New("fail"))
+	mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any()).Return(errors.New("disk full"))
+
+	errCh := saveGameDB(ctx, mockSaver, in, nopObserver{}, mockDeadLetter, nil)
+
+	err, ok := <-errCh
+	assert.True(t, ok)
+	assert.EqualError(t, err, "fail")
 }
 
 func TestSaveGameDB_ContextCancelStops(t *testing.T) {
@@ -185,10 +468,10 @@ func TestSaveGameDB_ContextCancelStops(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockSaver := NewMockSaver(ctrl)
-	in := make(chan []types.GameDB)
+	in := make(chan gameRows)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	errCh := saveGameDB(ctx, mockSaver, in)
+	errCh := saveGameDB(ctx, mockSaver, in, nopObserver{}, nil, nil)
 
 	cancel()
 
@@ -196,6 +479,91 @@ func TestSaveGameDB_ContextCancelStops(t *testing.T) {
 	assert.False(t, ok)
 }
 
+// fakeBatchSaver holds the enqueued games until Flush, which fails them all
+// with err.
+type fakeBatchSaver struct {
+	mu      sync.Mutex
+	err     error
+	waiting []chan error
+	flushed [][]types.GameDB
+	batch   []types.GameDB
+}
+
+func (s *fakeBatchSaver) Save(ctx context.Context, games []types.GameDB) error {
+	return <-s.Enqueue(ctx, games)
+}
+
+func (s *fakeBatchSaver) Enqueue(ctx context.Context, games []types.GameDB) <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done := make(chan error, 1)
+	s.waiting = append(s.waiting, done)
+	s.batch = append(s.batch, games...)
+	return done
+}
+
+func (s *fakeBatchSaver) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.batch) > 0 {
+		s.flushed = append(s.flushed, s.batch)
+	}
+	for _, done := range s.waiting {
+		done <- s.err
+	}
+	s.waiting, s.batch = nil, nil
+	return s.err
+}
+
+func TestSaveGameDB_BatchSaverConfirmsGamesOnFlush(t *testing.T) {
+	saver := &fakeBatchSaver{}
+	observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+	ctx := context.Background()
+
+	in := make(chan gameRows, 2)
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 1}, rows: []types.GameDB{{GameID: 1}}}
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 2}, rows: []types.GameDB{{GameID: 2}}}
+	close(in)
+
+	_, ok := <-saveGameDB(ctx, saver, in, observer, nil, nil)
+	assert.False(t, ok)
+
+	// Both games went out in one batch, flushed at the end of input.
+	assert.Equal(t, [][]types.GameDB{{{GameID: 1}, {GameID: 2}}}, saver.flushed)
+	assert.Equal(t, 2, observer.saved)
+}
+
+func TestSaveGameDB_BatchSaverDeadLettersEveryGameOfFailedBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	saver := &fakeBatchSaver{err: errors.New("fail")}
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+	ctx := context.Background()
+
+	in := make(chan gameRows, 2)
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 1}, rows: []types.GameDB{{GameID: 1}}}
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 2}, rows: []types.GameDB{{GameID: 2}}}
+	close(in)
+
+	// The games rejected by the same flush are put together.
+	var ids []int64
+	mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, entries ...types.DeadLetter) error {
+		for _, entry := range entries {
+			ids = append(ids, entry.GameID)
+			assert.Equal(t, "fail", entry.Error)
+		}
+		return nil
+	})
+
+	_, ok := <-saveGameDB(ctx, saver, in, observer, mockDeadLetter, nil)
+	assert.False(t, ok)
+
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Zero(t, observer.saved)
+}
+
 // --- Test logErrors ---
 
 func TestLogErrors_LogsErrorsAndReturnsNil(t *testing.T) {
@@ -218,7 +586,7 @@ func TestParse(t *testing.T) {
 	mockParser := NewMockParser(ctrl)
 	mockSaver := NewMockSaver(ctrl)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
 	game := &types.GameParser{
@@ -270,7 +638,10 @@ func TestParse(t *testing.T) {
 		Return(nil).
 		AnyTimes()
 
-	err := parse(ctx, mockParser, mockSaver)
+	err := parse(ctx, newParserWorkerConfig(
+		WithParser(mockParser),
+		WithSaver(mockSaver),
+	))
 	assert.NoError(t, err)
 }
 
@@ -281,7 +652,7 @@ func TestNewParserWorker(t *testing.T) {
 	mockParser := NewMockParser(ctrl)
 	mockSaver := NewMockSaver(ctrl)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
 	game := &types.GameParser{
@@ -341,3 +712,484 @@ func TestNewParserWorker(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+// --- Test concurrency options ---
+
+func TestNewParserWorkerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ParserOpt
+		parse   int
+		flatten int
+		save    int
+		window  int
+	}{
+		{
+			name:    "Defaults",
+			opts:    nil,
+			parse:   1,
+			flatten: 1,
+			save:    1,
+		},
+		{
+			name: "Custom concurrency",
+			opts: []ParserOpt{
+				WithParseConcurrency(4),
+				WithFlattenConcurrency(3),
+				WithSaveConcurrency(2),
+			},
+			parse:   4,
+			flatten: 3,
+			save:    2,
+		},
+		{
+			name: "Ordered forces single saver",
+			opts: []ParserOpt{
+				WithParseConcurrency(4),
+				WithSaveConcurrency(2),
+				WithOrdered(10),
+			},
+			parse:   4,
+			flatten: 1,
+			save:    1,
+			window:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newParserWorkerConfig(tt.opts...)
+			assert.Equal(t, tt.parse, cfg.parseConcurrency)
+			assert.Equal(t, tt.flatten, cfg.flattenConcurrency)
+			assert.Equal(t, tt.save, cfg.saveConcurrency)
+			assert.Equal(t, tt.window, cfg.orderWindow)
+		})
+	}
+}
+
+func TestOrderGameDB_SortsWithinWindow(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	in := make(chan gameRows, 4)
+	in <- gameRows{ctx: ctx, rows: []types.GameDB{{GameID: 3, BeginAt: base.Add(3 * time.Hour)}}}
+	in <- gameRows{ctx: ctx, rows: []types.GameDB{{GameID: 1, BeginAt: base.Add(1 * time.Hour)}}}
+	in <- gameRows{ctx: ctx, rows: []types.GameDB{{GameID: 4, BeginAt: base.Add(4 * time.Hour)}}}
+	in <- gameRows{ctx: ctx, rows: []types.GameDB{{GameID: 2, BeginAt: base.Add(2 * time.Hour)}}}
+	close(in)
+
+	var ids []int64
+	for batch := range orderGameDB(ctx, in, 10, nopObserver{}) {
+		ids = append(ids, batch.rows[0].GameID)
+	}
+
+	assert.Equal(t, []int64{1, 2, 3, 4}, ids)
+}
+
+func TestOrderGameDB_ContextCancelStops(t *testing.T) {
+	in := make(chan gameRows)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	out := orderGameDB(ctx, in, 10, nopObserver{})
+
+	cancel()
+
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+
+	a := make(chan int, 2)
+	b := make(chan int, 2)
+	a <- 1
+	a <- 2
+	b <- 3
+	close(a)
+	close(b)
+
+	var got []int
+	for v := range merge(ctx, a, b) {
+		got = append(got, v)
+	}
+
+	assert.ElementsMatch(t, []int{1, 2, 3}, got)
+}
+
+// countingParser decodes the same payload n times and then reports exhaustion.
+type countingParser struct {
+	payload []byte
+	left    atomic.Int64
+}
+
+func (p *countingParser) Next(ctx context.Context) (*types.GameParser, error) {
+	if p.left.Add(-1) < 0 {
+		return nil, errors.New("exhausted")
+	}
+	var game types.GameParser
+	if err := json.Unmarshal(p.payload, &game); err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+type countingSaver struct {
+	mu   sync.Mutex
+	rows int
+}
+
+func (s *countingSaver) Save(ctx context.Context, games []types.GameDB) error {
+	s.mu.Lock()
+	s.rows += len(games)
+	s.mu.Unlock()
+	return nil
+}
+
+func newBenchGamePayload(tb testing.TB) []byte {
+	game := types.GameParser{
+		ID:      1,
+		BeginAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Match: types.MatchParser{
+			League:     types.LeagueParser{ID: 10},
+			Serie:      types.SerieParser{ID: 20, Tier: "a"},
+			Tournament: types.TournamentParser{ID: 30},
+		},
+		Map: types.MapParser{ID: 100},
+	}
+	for i := 0; i < 10; i++ {
+		game.Players = append(game.Players, types.PlayerStatisticParser{
+			Player: types.PlayerParser{ID: int64(i)},
+			Team:   types.TeamParser{ID: int64(1000 + i%2)},
+			Kills:  20, Deaths: 15, ADR: 80.0, Rating: 1.1,
+		})
+	}
+	for r := 1; r <= 24; r++ {
+		game.Rounds = append(game.Rounds, types.RoundParser{
+			Round: int64(r), Outcome: "eliminated", WinnerTeam: int64(1000 + r%2),
+		})
+	}
+
+	payload, err := json.Marshal(game)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return payload
+}
+
+type recordingObserver struct {
+	mu      sync.Mutex
+	dropped map[string]int
+	rows    int
+	unknown []string
+	saved   int
+	stages  map[string]int
+	// stopped lists the stage goroutines that stopped, with their error.
+	stopped []string
+}
+
+func (o *recordingObserver) ObserveGameDropped(file string, reason string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.dropped[file+":"+reason]++
+}
+
+func (o *recordingObserver) ObserveFlattened(file string, rows int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.rows += rows
+}
+
+func (o *recordingObserver) ObserveUnknownValue(file string, field string, value string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.unknown = append(o.unknown, file+":"+field+"="+value)
+}
+
+func (o *recordingObserver) ObserveSaved(games []types.GameDB) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.saved++
+}
+
+func (o *recordingObserver) ObserveQueue(stage string, length func() int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stages[stage]++
+}
+
+func (o *recordingObserver) ForgetQueues() {}
+
+func (o *recordingObserver) ObserveStage(stage string) func(err error) {
+	return func(err error) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if err != nil {
+			stage += ": " + err.Error()
+		}
+		o.stopped = append(o.stopped, stage)
+	}
+}
+
+func TestParse_Observer(t *testing.T) {
+	payload := newBenchGamePayload(t)
+	parser := &sequenceParser{games: []types.GameParser{{ID: 2}}}
+	require.NoError(t, json.Unmarshal(payload, &parser.games[0]))
+	parser.games[0].File = "game2.json"
+	parser.games[0].Match.Serie.Tier = "z"
+	parser.games[0].Rounds[0].Outcome = "planted"
+	parser.games[0].Rounds[1].Outcome = "planted"
+	parser.games = append(parser.games, types.GameParser{ID: 3, File: "game3.json"})
+
+	observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+	cfg := newParserWorkerConfig(
+		WithParser(parser),
+		WithSaver(&countingSaver{}),
+		WithObserver(observer),
+		WithParseConcurrency(2),
+		WithOrdered(10),
+	)
+
+	require.NoError(t, parse(context.Background(), cfg))
+
+	assert.Equal(t, map[string]int{"game3.json:" + DropReasonTeams: 1}, observer.dropped)
+	assert.Equal(t, 5*5*2*24, observer.rows)
+	assert.Equal(t, []string{"game2.json:tier=z", "game2.json:round_outcome=planted"}, observer.unknown)
+	assert.Equal(t, 1, observer.saved)
+	// Two generator channels plus the merged one, then one channel for each
+	// of the other stages.
+	assert.Equal(t, map[string]int{
+		logging.StageParse:   3,
+		logging.StageFlatten: 1,
+		logging.StageOrder:   1,
+		logging.StageSave:    1,
+	}, observer.stages)
+	// Every stage goroutine stopped once its input was done.
+	assert.ElementsMatch(t, []string{
+		logging.StageParse, logging.StageParse,
+		logging.StageFlatten,
+		logging.StageOrder,
+		logging.StageSave,
+	}, observer.stopped)
+}
+
+func TestParse_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	payload := newBenchGamePayload(t)
+	parser := &sequenceParser{games: []types.GameParser{{ID: 2}}}
+	require.NoError(t, json.Unmarshal(payload, &parser.games[0]))
+	parser.games[0].ID = 2
+	parser.games = append(parser.games, types.GameParser{ID: 3})
+
+	cfg := newParserWorkerConfig(
+		WithParser(parser),
+		WithSaver(&countingSaver{}),
+		WithParseConcurrency(1),
+	)
+	require.NoError(t, parse(context.Background(), cfg))
+
+	games := map[int64]sdktrace.ReadOnlySpan{}
+	children := map[trace.SpanID][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "game" {
+			for _, attr := range span.Attributes() {
+				if attr.Key == tracing.AttrGameID {
+					games[attr.Value.AsInt64()] = span
+				}
+			}
+			continue
+		}
+		children[span.Parent().SpanID()] = append(children[span.Parent().SpanID()], span)
+	}
+	require.Len(t, games, 2)
+
+	saved := children[games[2].SpanContext().SpanID()]
+	require.Len(t, saved, 2)
+	assert.Equal(t, "flatten", saved[0].Name())
+	assert.Contains(t, saved[0].Attributes(), tracing.AttrRows.Int(5*5*2*24))
+	assert.Equal(t, "save", saved[1].Name())
+	assert.Contains(t, saved[1].Attributes(), tracing.AttrBatchRows.Int(5*5*2*24))
+
+	dropped := children[games[3].SpanContext().SpanID()]
+	require.Len(t, dropped, 1)
+	assert.Contains(t, dropped[0].Attributes(), tracing.AttrDropReason.String(DropReasonTeams))
+}
+
+func TestParse_DrainsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var read atomic.Int64
+	payload := newBenchGamePayload(t)
+	parser := parserFunc(func(ctx context.Context) (*types.GameParser, error) {
+		if read.Add(1) == 20 {
+			cancel()
+		}
+		var game types.GameParser
+		return &game, json.Unmarshal(payload, &game)
+	})
+	saver := &slowSaver{delay: time.Millisecond}
+
+	cfg := newParserWorkerConfig(
+		WithParser(parser),
+		WithSaver(saver),
+		WithParseConcurrency(2),
+		WithGracePeriod(time.Minute),
+	)
+	require.NoError(t, parse(ctx, cfg))
+
+	assert.Equal(t, int(read.Load())*5*5*2*24, saver.rows)
+}
+
+func TestParse_GracePeriodExpires(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payload := newBenchGamePayload(t)
+	parser := parserFunc(func(ctx context.Context) (*types.GameParser, error) {
+		var game types.GameParser
+		return &game, json.Unmarshal(payload, &game)
+	})
+	saver := saverFunc(func(saveCtx context.Context, games []types.GameDB) error {
+		cancel()
+		<-saveCtx.Done()
+		return saveCtx.Err()
+	})
+
+	cfg := newParserWorkerConfig(
+		WithParser(parser),
+		WithSaver(saver),
+		WithGracePeriod(10*time.Millisecond),
+	)
+
+	done := make(chan error)
+	go func() { done <- parse(ctx, cfg) }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("parse did not return after the grace period")
+	}
+}
+
+type parserFunc func(ctx context.Context) (*types.GameParser, error)
+
+func (f parserFunc) Next(ctx context.Context) (*types.GameParser, error) { return f(ctx) }
+
+type saverFunc func(ctx context.Context, games []types.GameDB) error
+
+func (f saverFunc) Save(ctx context.Context, games []types.GameDB) error { return f(ctx, games) }
+
+// slowSaver counts rows like countingSaver but takes a while per save, so
+// games pile up in the channels.
+type slowSaver struct {
+	countingSaver
+	delay time.Duration
+}
+
+func (s *slowSaver) Save(ctx context.Context, games []types.GameDB) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.delay):
+	}
+	return s.countingSaver.Save(ctx, games)
+}
+
+// sequenceParser returns its games once each and then io.EOF.
+type sequenceParser struct {
+	mu    sync.Mutex
+	games []types.GameParser
+}
+
+func (p *sequenceParser) Next(ctx context.Context) (*types.GameParser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.games) == 0 {
+		return nil, io.EOF
+	}
+	game := p.games[0]
+	p.games = p.games[1:]
+	return &game, nil
+}
+
+func TestParse_Concurrent(t *testing.T) {
+	parser := &countingParser{payload: newBenchGamePayload(t)}
+	parser.left.Store(20)
+	saver := &countingSaver{}
+
+	err := parse(context.Background(), newParserWorkerConfig(
+		WithParser(parser),
+		WithSaver(saver),
+		WithParseConcurrency(4),
+		WithFlattenConcurrency(4),
+		WithSaveConcurrency(2),
+	))
+	assert.NoError(t, err)
+
+	// 5 players x 5 opponents x 2 sides x 24 rounds per game
+	assert.Equal(t, 20*5*5*2*24, saver.rows)
+}
+
+func BenchmarkParse(b *testing.B) {
+	payload := newBenchGamePayload(b)
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			parser := &countingParser{payload: payload}
+			parser.left.Store(int64(b.N))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			err := parse(context.Background(), newParserWorkerConfig(
+				WithParser(parser),
+				WithSaver(&countingSaver{}),
+				WithParseConcurrency(n),
+				WithFlattenConcurrency(n),
+				WithSaveConcurrency(n),
+			))
+			if err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGatedParser_WaitsBeforeNext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := NewMockParser(ctrl)
+	mockGate := NewMockGate(ctrl)
+	ctx := context.Background()
+
+	gomock.InOrder(
+		mockGate.EXPECT().Wait(ctx).Return(nil),
+		mockParser.EXPECT().Next(ctx).Return(&types.GameParser{ID: 7}, nil),
+	)
+
+	game, err := gatedParser(mockParser, mockGate).Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), game.ID)
+}
+
+func TestGatedParser_GateErrorSkipsNext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := NewMockParser(ctrl)
+	mockGate := NewMockGate(ctrl)
+	ctx := context.Background()
+
+	mockGate.EXPECT().Wait(ctx).Return(context.Canceled)
+
+	_, err := gatedParser(mockParser, mockGate).Next(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
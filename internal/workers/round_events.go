@@ -0,0 +1,171 @@
+package workers
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/tracing"
+	"github.com/sbilibin2017/cs2/internal/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RoundEventSaver keeps the events of the rounds of the games.
+type RoundEventSaver interface {
+	Save(ctx context.Context, events []types.RoundEventDB) error
+}
+
+// Kinds of round events.
+const (
+	RoundEventKill    = "kill"
+	RoundEventClutch  = "clutch"
+	RoundEventEconomy = "economy"
+	RoundEventPlant   = "plant"
+)
+
+// BuyTypes are the known buy types of a team in a round. Others are stored
+// as they are and reported as unknown values.
+var BuyTypes = []string{"eco", "force", "full"}
+
+// flattenRoundEvents returns the events of the rounds of a game, with the
+// version of its rows. A game without the richer round payload has none.
+func flattenRoundEvents(game *types.GameParser, version uint64, ingestedAt time.Time, observer Observer) []types.RoundEventDB {
+	playerTeams := make(map[int64]int64, len(game.Players))
+	for _, p := range game.Players {
+		playerTeams[p.Player.ID] = p.Team.ID
+	}
+
+	boolToInt64 := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	var events []types.RoundEventDB
+	unknownBuyTypes := make(map[string]bool)
+	for _, r := range game.Rounds {
+		event := func(kind string, seq int64, teamID int64) types.RoundEventDB {
+			return types.RoundEventDB{
+				GameID:     game.ID,
+				BeginAt:    game.BeginAt,
+				RoundID:    r.Round,
+				Event:      kind,
+				Seq:        seq,
+				TeamID:     teamID,
+				RoundWin:   boolToInt64(teamID == r.WinnerTeam),
+				Version:    version,
+				IngestedAt: ingestedAt,
+			}
+		}
+
+		marked := slices.ContainsFunc(r.Kills, func(k types.RoundKillParser) bool { return k.FirstBlood != nil })
+		for i, k := range r.Kills {
+			e := event(RoundEventKill, int64(i), playerTeams[k.Killer.ID])
+			e.PlayerID = k.Killer.ID
+			e.OpponentID = k.Victim.ID
+			e.Weapon = k.Weapon
+			e.Headshot = boolToInt64(k.Headshot)
+			if marked {
+				e.FirstBlood = boolToInt64(k.FirstBlood != nil && *k.FirstBlood)
+			} else {
+				e.FirstBlood = boolToInt64(i == 0)
+			}
+			events = append(events, e)
+		}
+
+		if c := r.Clutch; c != nil {
+			e := event(RoundEventClutch, 0, playerTeams[c.Player.ID])
+			e.PlayerID = c.Player.ID
+			e.ClutchOpponents = c.Opponents
+			events = append(events, e)
+		}
+
+		for i, eco := range r.Economy {
+			e := event(RoundEventEconomy, int64(i), eco.Team.ID)
+			e.EquipmentValue = eco.EquipmentValue
+			e.BuyType = eco.BuyType
+			events = append(events, e)
+
+			if !slices.Contains(BuyTypes, eco.BuyType) && !unknownBuyTypes[eco.BuyType] {
+				unknownBuyTypes[eco.BuyType] = true
+				observer.ObserveUnknownValue(game.File, FieldBuyType, eco.BuyType)
+			}
+		}
+
+		if r.BombSite != nil {
+			e := event(RoundEventPlant, 0, r.T)
+			e.BombSite = *r.BombSite
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// saveRoundEvents saves the round events of the games whose rows are
+// saved. The games already waiting are saved together. A game whose events
+// could not be saved is dead-lettered, to be replayed whole. It never
+// reports an error, and its channel is closed once in is.
+func saveRoundEvents(ctx context.Context, saver RoundEventSaver, in <-chan gameRows, observer Observer, deadLetter DeadLetter) <-chan error {
+	done := make(chan error)
+	logger := logging.FromContext(ctx).With(logging.Stage(logging.StageRoundEvents))
+	stopped := observer.ObserveStage(logging.StageRoundEvents)
+
+	go func() {
+		defer close(done)
+		defer stopped(nil)
+
+		items := make([]gameRows, 0, waitingBatchMax)
+		var events []types.RoundEventDB
+		for {
+			var ok bool
+			if items, ok = receiveWaiting(ctx, in, items[:0]); !ok {
+				return
+			}
+
+			events = events[:0]
+			var withEvents []gameRows
+			for _, item := range items {
+				if item.game == nil || len(item.rows) == 0 {
+					continue
+				}
+				gameEvents := flattenRoundEvents(item.game, item.rows[0].Version, item.rows[0].IngestedAt, observer)
+				if len(gameEvents) > 0 {
+					withEvents = append(withEvents, item)
+					events = append(events, gameEvents...)
+				}
+			}
+			if len(events) == 0 {
+				continue
+			}
+
+			_, span := tracing.Tracer().Start(withEvents[0].ctx, "save round events",
+				trace.WithAttributes(tracing.AttrBatchRows.Int(len(events))),
+			)
+			err := saver.Save(ctx, events)
+			tracing.RecordError(span, err)
+			span.End()
+
+			// Errors from cancellation are not the games' fault.
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+
+			games := make([]*types.GameParser, len(withEvents))
+			for i, item := range withEvents {
+				logger.Error("failed to save round events",
+					logging.GameID(item.game.ID),
+					logging.File(item.game.File),
+					logging.Err(err),
+				)
+				observer.ObserveGameDropped(item.game.File, DropReasonRoundEvents)
+				games[i] = item.game
+			}
+			putDeadLetters(ctx, deadLetter, games, logging.StageRoundEvents, err)
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,270 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sbilibin2017/cs2/internal/logging"
+	"github.com/sbilibin2017/cs2/internal/types"
+)
+
+func newRoundEventsGame() *types.GameParser {
+	site := "a"
+	return &types.GameParser{
+		ID:      1,
+		File:    "1.json",
+		BeginAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Players: []types.PlayerStatisticParser{
+			{Player: types.PlayerParser{ID: 10}, Team: types.TeamParser{ID: 100}},
+			{Player: types.PlayerParser{ID: 20}, Team: types.TeamParser{ID: 200}},
+		},
+		Rounds: []types.RoundParser{
+			{
+				Round: 1, CT: 100, T: 200, WinnerTeam: 100,
+				Kills: []types.RoundKillParser{
+					{Killer: types.PlayerParser{ID: 10}, Victim: types.PlayerParser{ID: 20}, Weapon: "ak47", Headshot: true},
+					{Killer: types.PlayerParser{ID: 20}, Victim: types.PlayerParser{ID: 10}, Weapon: "awp"},
+				},
+				Clutch: &types.RoundClutchParser{Player: types.PlayerParser{ID: 10}, Opponents: 2},
+				Economy: []types.RoundEconomyParser{
+					{Team: types.TeamParser{ID: 100}, EquipmentValue: 4000, BuyType: "full"},
+					{Team: types.TeamParser{ID: 200}, EquipmentValue: 900, BuyType: "half"},
+				},
+				BombSite: &site,
+			},
+			// A round without the kill feed has no events.
+			{Round: 2, CT: 100, T: 200, WinnerTeam: 200},
+		},
+	}
+}
+
+func TestFlattenRoundEvents(t *testing.T) {
+	ingestedAt := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+
+	events := flattenRoundEvents(newRoundEventsGame(), 7, ingestedAt, observer)
+
+	base := types.RoundEventDB{
+		GameID:     1,
+		BeginAt:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		RoundID:    1,
+		Version:    7,
+		IngestedAt: ingestedAt,
+	}
+	event := func(f func(e *types.RoundEventDB)) types.RoundEventDB {
+		e := base
+		f(&e)
+		return e
+	}
+	assert.Equal(t, []types.RoundEventDB{
+		event(func(e *types.RoundEventDB) {
+			e.Event, e.TeamID, e.PlayerID, e.OpponentID = RoundEventKill, 100, 10, 20
+			e.Weapon, e.Headshot, e.FirstBlood, e.RoundWin = "ak47", 1, 1, 1
+		}),
+		event(func(e *types.RoundEventDB) {
+			e.Event, e.Seq, e.TeamID, e.PlayerID, e.OpponentID = RoundEventKill, 1, 200, 20, 10
+			e.Weapon = "awp"
+		}),
+		event(func(e *types.RoundEventDB) {
+			e.Event, e.TeamID, e.PlayerID, e.ClutchOpponents, e.RoundWin = RoundEventClutch, 100, 10, 2, 1
+		}),
+		event(func(e *types.RoundEventDB) {
+			e.Event, e.TeamID, e.EquipmentValue, e.BuyType, e.RoundWin = RoundEventEconomy, 100, 4000, "full", 1
+		}),
+		event(func(e *types.RoundEventDB) {
+			e.Event, e.Seq, e.TeamID, e.EquipmentValue, e.BuyType = RoundEventEconomy, 1, 200, 900, "half"
+		}),
+		event(func(e *types.RoundEventDB) {
+			e.Event, e.TeamID, e.BombSite = RoundEventPlant, 200, "a"
+		}),
+	}, events)
+	assert.Equal(t, []string{"1.json:buy_type=half"}, observer.unknown)
+
+	assert.Empty(t, flattenRoundEvents(&types.GameParser{ID: 2, Rounds: []types.RoundParser{{Round: 1}}}, 7, ingestedAt, nopObserver{}))
+}
+
+func TestFlattenRoundEvents_FirstBlood(t *testing.T) {
+	yes, no := true, false
+	kill := func(firstBlood *bool) types.RoundKillParser {
+		return types.RoundKillParser{FirstBlood: firstBlood}
+	}
+
+	tests := []struct {
+		name  string
+		kills []types.RoundKillParser
+		want  []int64
+	}{
+		{name: "unmarked feed takes the first kill", kills: []types.RoundKillParser{kill(nil), kill(nil)}, want: []int64{1, 0}},
+		{name: "marked feed", kills: []types.RoundKillParser{kill(&no), kill(&yes), kill(nil)}, want: []int64{0, 1, 0}},
+		{name: "marked feed without first blood", kills: []types.RoundKillParser{kill(&no), kill(nil)}, want: []int64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &types.GameParser{ID: 1, Rounds: []types.RoundParser{{Round: 1, Kills: tt.kills}}}
+			var got []int64
+			for _, e := range flattenRoundEvents(game, 1, time.Time{}, nopObserver{}) {
+				got = append(got, e.FirstBlood)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSaveRoundEvents_SavesWaitingGamesTogether(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSaver := NewMockRoundEventSaver(ctrl)
+	ctx := context.Background()
+
+	in := make(chan gameRows, 3)
+	in <- gameRows{ctx: ctx, game: newRoundEventsGame(), rows: []types.GameDB{{GameID: 1, Version: 7}}}
+	// A game without the richer round payload has no events to save.
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 2}, rows: []types.GameDB{{GameID: 2, Version: 7}}}
+	game := newRoundEventsGame()
+	game.ID = 3
+	in <- gameRows{ctx: ctx, game: game, rows: []types.GameDB{{GameID: 3, Version: 8}}}
+	close(in)
+
+	mockSaver.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, events []types.RoundEventDB) error {
+		require.Len(t, events, 12)
+		assert.Equal(t, int64(1), events[0].GameID)
+		assert.Equal(t, uint64(7), events[0].Version)
+		assert.Equal(t, int64(3), events[6].GameID)
+		assert.Equal(t, uint64(8), events[6].Version)
+		return nil
+	})
+
+	_, ok := <-saveRoundEvents(ctx, mockSaver, in, nopObserver{}, nil)
+	assert.False(t, ok)
+}
+
+func TestSaveRoundEvents_DeadLettersGamesNotSaved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSaver := NewMockRoundEventSaver(ctrl)
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	observer := &recordingObserver{dropped: map[string]int{}, stages: map[string]int{}}
+	ctx := context.Background()
+
+	in := make(chan gameRows, 2)
+	in <- gameRows{ctx: ctx, game: newRoundEventsGame(), rows: []types.GameDB{{GameID: 1}}}
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 2, File: "2.json"}, rows: []types.GameDB{{GameID: 2}}}
+	close(in)
+
+	mockSaver.EXPECT().Save(gomock.Any(), gomock.Any()).Return(errors.New("fail"))
+	// The game without events was not part of the failed save.
+	mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, entries ...types.DeadLetter) error {
+		require.Len(t, entries, 1)
+		assert.Equal(t, int64(1), entries[0].GameID)
+		assert.Equal(t, logging.StageRoundEvents, entries[0].Stage)
+		assert.Equal(t, "fail", entries[0].Error)
+		return nil
+	})
+
+	_, ok := <-saveRoundEvents(ctx, mockSaver, in, observer, mockDeadLetter)
+	assert.False(t, ok)
+	assert.Equal(t, map[string]int{"1.json:" + DropReasonRoundEvents: 1}, observer.dropped)
+}
+
+func TestSaveGameDB_SendsSavedGamesOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSaver := NewMockSaver(ctrl)
+	mockDeadLetter := NewMockDeadLetter(ctrl)
+	ctx := context.Background()
+
+	in := make(chan gameRows, 2)
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 1}, rows: []types.GameDB{{GameID: 1}}}
+	in <- gameRows{ctx: ctx, game: &types.GameParser{ID: 2}, rows: []types.GameDB{{GameID: 2}}}
+	close(in)
+
+	gomock.InOrder(
+		mockSaver.EXPECT().Save(gomock.Any(), []types.GameDB{{GameID: 1}}).Return(errors.New("fail")),
+		mockDeadLetter.EXPECT().Put(gomock.Any(), gomock.Any()).Return(nil),
+		mockSaver.EXPECT().Save(gomock.Any(), []types.GameDB{{GameID: 2}}).Return(nil),
+	)
+
+	// Round events follow the games whose rows are saved, and no others.
+	saved := make(chan gameRows, 2)
+	_, ok := <-saveGameDB(ctx, mockSaver, in, nopObserver{}, mockDeadLetter, saved)
+	assert.False(t, ok)
+	close(saved)
+
+	var ids []int64
+	for item := range saved {
+		ids = append(ids, item.game.ID)
+	}
+	assert.Equal(t, []int64{2}, ids)
+}
+
+// orderLog records the games whose rows and events were saved, in order.
+type orderLog struct {
+	mu    sync.Mutex
+	saves []string
+}
+
+func (l *orderLog) add(kind string, id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.saves = append(l.saves, fmt.Sprintf("%s %d", kind, id))
+}
+
+type orderLogSaver struct{ log *orderLog }
+
+func (s orderLogSaver) Save(ctx context.Context, games []types.GameDB) error {
+	s.log.add("rows", games[0].GameID)
+	return nil
+}
+
+type orderLogEventSaver struct{ log *orderLog }
+
+func (s orderLogEventSaver) Save(ctx context.Context, events []types.RoundEventDB) error {
+	for i, e := range events {
+		if i == 0 || e.GameID != events[i-1].GameID {
+			s.log.add("events", e.GameID)
+		}
+	}
+	return nil
+}
+
+func TestParse_SavesRoundEventsAfterGameRows(t *testing.T) {
+	var game types.GameParser
+	require.NoError(t, json.Unmarshal(newBenchGamePayload(t), &game))
+	game.Rounds[0].Kills = []types.RoundKillParser{{Killer: types.PlayerParser{ID: 0}, Victim: types.PlayerParser{ID: 1}}}
+
+	parser := &sequenceParser{}
+	for id := int64(1); id <= 3; id++ {
+		game.ID = id
+		parser.games = append(parser.games, game)
+	}
+
+	log := &orderLog{}
+	err := parse(context.Background(), newParserWorkerConfig(
+		WithParser(parser),
+		WithSaver(orderLogSaver{log}),
+		WithRoundEventSaver(orderLogEventSaver{log}),
+		WithSaveConcurrency(2),
+	))
+	require.NoError(t, err)
+
+	require.Len(t, log.saves, 6)
+	for id := int64(1); id <= 3; id++ {
+		rows := slices.Index(log.saves, fmt.Sprintf("rows %d", id))
+		events := slices.Index(log.saves, fmt.Sprintf("events %d", id))
+		assert.Less(t, rows, events, "game %d", id)
+	}
+}
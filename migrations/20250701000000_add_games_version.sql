@@ -0,0 +1,149 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS games_versioned (
+    game_id Int64,
+    begin_at DateTime,
+
+    league_id Int64,
+    serie_id Int64,
+    tier_id Int64,
+    tournament_id Int64,
+
+    map_id Int64,
+
+    team_id Int64,
+    team_opponent_id Int64,
+    player_id Int64,
+    player_opponent_id Int64,
+
+    kills Int64,
+    deaths Int64,
+    assists Int64,
+    headshots Int64,
+    flash_assists Int64,
+    k_d_diff Float64,
+    first_kills_diff Float64,
+    adr Float64,
+    kast Float64,
+    rating Float64,
+
+    round_id Int64,
+    round_outcome_id Int64,
+    round_win Int64,
+
+    version UInt64,
+    ingested_at DateTime64(3)
+)
+ENGINE = ReplacingMergeTree(version)
+PARTITION BY toYYYYMM(begin_at)
+ORDER BY (
+    begin_at, 
+    game_id,   
+    league_id,
+    serie_id,
+    tier_id,
+    tournament_id,
+    map_id,
+    round_id,
+    team_id,
+    team_opponent_id,
+    player_id,
+    player_opponent_id
+)
+SETTINGS non_replicated_deduplication_window = 1000;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+INSERT INTO games_versioned
+SELECT *, 0 AS version, now64(3) AS ingested_at
+FROM games;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+EXCHANGE TABLES games AND games_versioned;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS games_versioned;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS games_unversioned (
+    game_id Int64,
+    begin_at DateTime,
+
+    league_id Int64,
+    serie_id Int64,
+    tier_id Int64,
+    tournament_id Int64,
+
+    map_id Int64,
+
+    team_id Int64,
+    team_opponent_id Int64,
+    player_id Int64,
+    player_opponent_id Int64,
+
+    kills Int64,
+    deaths Int64,
+    assists Int64,
+    headshots Int64,
+    flash_assists Int64,
+    k_d_diff Float64,
+    first_kills_diff Float64,
+    adr Float64,
+    kast Float64,
+    rating Float64,
+
+    round_id Int64,
+    round_outcome_id Int64,
+    round_win Int64
+)
+ENGINE = ReplacingMergeTree()
+PARTITION BY toYYYYMM(begin_at)
+ORDER BY (
+    begin_at, 
+    game_id,   
+    league_id,
+    serie_id,
+    tier_id,
+    tournament_id,
+    map_id,
+    round_id,
+    team_id,
+    team_opponent_id,
+    player_id,
+    player_opponent_id
+);
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+INSERT INTO games_unversioned
+SELECT * EXCEPT (version, ingested_at)
+FROM games FINAL;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+EXCHANGE TABLES games AND games_unversioned;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS games_unversioned;
+
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    game_id Int64,
+    file String,
+    stage LowCardinality(String),
+    error String,
+    attempts Int64,
+    failed_at DateTime64(3, 'UTC'),
+    payload String CODEC(ZSTD),
+
+    deleted UInt8,
+    version UInt64
+)
+ENGINE = ReplacingMergeTree(version)
+ORDER BY game_id;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS dead_letters;
+
+-- +goose StatementEnd
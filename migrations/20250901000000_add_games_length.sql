@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The games already saved are backfilled from games_raw by the Go migration
+-- of the next version, one month partition at a time.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS length Nullable(Int64);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE games DROP COLUMN IF EXISTS length;
+
+-- +goose StatementEnd
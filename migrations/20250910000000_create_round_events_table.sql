@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS round_events (
+    game_id Int64,
+    begin_at DateTime,
+    round_id Int64,
+    event LowCardinality(String),
+    seq Int64,
+
+    team_id Int64,
+    player_id Int64,
+    opponent_id Int64,
+
+    weapon LowCardinality(String),
+    headshot Int64,
+    first_blood Int64,
+    clutch_opponents Int64,
+    equipment_value Int64,
+    buy_type LowCardinality(String),
+    bomb_site LowCardinality(String),
+    round_win Int64,
+
+    version UInt64,
+    ingested_at DateTime64(3)
+)
+ENGINE = ReplacingMergeTree(version)
+PARTITION BY toYYYYMM(begin_at)
+ORDER BY (game_id, round_id, event, seq);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS round_events;
+
+-- +goose StatementEnd
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pressly/goose/v3"
+)
+
+// GoMigrations are the ClickHouse migrations that cannot be a single SQL
+// statement, applied along with the ones of FS.
+func GoMigrations() []*goose.Migration {
+	return []*goose.Migration{
+		goose.NewGoMigration(20250901000001,
+			&goose.GoFunc{RunDB: backfillGamesLength},
+			// Dropping the column undoes the backfill.
+			&goose.GoFunc{Mode: goose.TransactionDisabled},
+		),
+	}
+}
+
+// backfillGamesLengthQuery saves again, one version later, the rows of the
+// games of a month whose archived source has a length, which replaces them.
+const backfillGamesLengthQuery = `
+INSERT INTO games (
+    game_id, begin_at,
+    league_id, serie_id, tier_id, tournament_id,
+    map_id,
+    team_id, team_opponent_id, player_id, player_opponent_id,
+    kills, deaths, assists, headshots, flash_assists,
+    k_d_diff, first_kills_diff, adr, kast, rating,
+    round_id, round_outcome_id, round_win,
+    version, ingested_at,
+    length
+)
+SELECT
+    g.game_id, g.begin_at,
+    g.league_id, g.serie_id, g.tier_id, g.tournament_id,
+    g.map_id,
+    g.team_id, g.team_opponent_id, g.player_id, g.player_opponent_id,
+    g.kills, g.deaths, g.assists, g.headshots, g.flash_assists,
+    g.k_d_diff, g.first_kills_diff, g.adr, g.kast, g.rating,
+    g.round_id, g.round_outcome_id, g.round_win,
+    g.version + 1, g.ingested_at,
+    r.length
+FROM games AS g FINAL
+INNER JOIN (
+    SELECT game_id, argMax(JSONExtract(payload, 'length', 'Nullable(Int64)'), ingested_at) AS length
+    FROM games_raw
+    WHERE game_id IN (SELECT game_id FROM games WHERE toYYYYMM(begin_at) = ?)
+    GROUP BY game_id
+) AS r ON g.game_id = r.game_id
+WHERE toYYYYMM(g.begin_at) = ? AND r.length IS NOT NULL AND g.length IS NULL`
+
+// backfillGamesLength fills the length of the games saved before the column
+// was added from games_raw. Each month partition is a separate insert, so
+// the rows read with FINAL and the joined sources stay bounded by a month.
+func backfillGamesLength(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT toYYYYMM(begin_at) AS month FROM games WHERE length IS NULL ORDER BY month`)
+	if err != nil {
+		return fmt.Errorf("failed to list months to backfill: %w", err)
+	}
+	var months []uint32
+	for rows.Next() {
+		var month uint32
+		if err := rows.Scan(&month); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list months to backfill: %w", err)
+		}
+		months = append(months, month)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list months to backfill: %w", err)
+	}
+
+	for _, month := range months {
+		if _, err := db.ExecContext(ctx, backfillGamesLengthQuery, month, month); err != nil {
+			return fmt.Errorf("failed to backfill length of %d: %w", month, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package migrations_test
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sbilibin2017/cs2/migrations"
+	"github.com/sbilibin2017/cs2/migrations/postgres"
+	"github.com/sbilibin2017/cs2/migrations/sqlite"
+)
+
+func TestFS_ContainsGooseMigrations(t *testing.T) {
+	for name, fsys := range map[string]fs.FS{
+		"clickhouse": migrations.FS,
+		"postgres":   postgres.FS,
+		"sqlite":     sqlite.FS,
+	} {
+		t.Run(name, func(t *testing.T) {
+			files, err := fs.Glob(fsys, "*.sql")
+			require.NoError(t, err)
+			require.NotEmpty(t, files)
+
+			for _, file := range files {
+				data, err := fs.ReadFile(fsys, file)
+				require.NoError(t, err)
+
+				assert.Contains(t, string(data), "-- +goose Up", file)
+				assert.Contains(t, string(data), "-- +goose Down", file)
+				assert.Equal(t,
+					strings.Count(string(data), "-- +goose StatementBegin"),
+					strings.Count(string(data), "-- +goose StatementEnd"),
+					file,
+				)
+			}
+		})
+	}
+}
+
+func TestGoMigrations_VersionsFollowSQLMigrations(t *testing.T) {
+	files, err := fs.Glob(migrations.FS, "*.sql")
+	require.NoError(t, err)
+	versions := make(map[int64]bool)
+	for _, file := range files {
+		version, err := goose.NumericComponent(file)
+		require.NoError(t, err)
+		versions[version] = true
+	}
+
+	for _, m := range migrations.GoMigrations() {
+		assert.False(t, versions[m.Version], "version %d of a Go migration is taken", m.Version)
+		versions[m.Version] = true
+	}
+}
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The primary key is the ClickHouse sort key, so an upsert on it keeps one
+-- row per key like ReplacingMergeTree does.
+CREATE TABLE IF NOT EXISTS games (
+    game_id BIGINT NOT NULL,
+    begin_at TIMESTAMPTZ NOT NULL,
+
+    league_id BIGINT NOT NULL,
+    serie_id BIGINT NOT NULL,
+    tier_id BIGINT NOT NULL,
+    tournament_id BIGINT NOT NULL,
+
+    map_id BIGINT NOT NULL,
+
+    team_id BIGINT NOT NULL,
+    team_opponent_id BIGINT NOT NULL,
+    player_id BIGINT NOT NULL,
+    player_opponent_id BIGINT NOT NULL,
+
+    kills BIGINT NOT NULL,
+    deaths BIGINT NOT NULL,
+    assists BIGINT NOT NULL,
+    headshots BIGINT NOT NULL,
+    flash_assists BIGINT NOT NULL,
+    k_d_diff DOUBLE PRECISION NOT NULL,
+    first_kills_diff DOUBLE PRECISION NOT NULL,
+    adr DOUBLE PRECISION NOT NULL,
+    kast DOUBLE PRECISION NOT NULL,
+    rating DOUBLE PRECISION NOT NULL,
+
+    round_id BIGINT NOT NULL,
+    round_outcome_id BIGINT NOT NULL,
+    round_win BIGINT NOT NULL,
+
+    version BIGINT NOT NULL,
+    ingested_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (
+        begin_at,
+        game_id,
+        league_id,
+        serie_id,
+        tier_id,
+        tournament_id,
+        map_id,
+        round_id,
+        team_id,
+        team_opponent_id,
+        player_id,
+        player_opponent_id
+    )
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS games;
+
+-- +goose StatementEnd
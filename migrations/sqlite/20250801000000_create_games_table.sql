@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The primary key is the ClickHouse sort key, so an upsert on it keeps one
+-- row per key like ReplacingMergeTree does.
+CREATE TABLE IF NOT EXISTS games (
+    game_id INTEGER NOT NULL,
+    begin_at DATETIME NOT NULL,
+
+    league_id INTEGER NOT NULL,
+    serie_id INTEGER NOT NULL,
+    tier_id INTEGER NOT NULL,
+    tournament_id INTEGER NOT NULL,
+
+    map_id INTEGER NOT NULL,
+
+    team_id INTEGER NOT NULL,
+    team_opponent_id INTEGER NOT NULL,
+    player_id INTEGER NOT NULL,
+    player_opponent_id INTEGER NOT NULL,
+
+    kills INTEGER NOT NULL,
+    deaths INTEGER NOT NULL,
+    assists INTEGER NOT NULL,
+    headshots INTEGER NOT NULL,
+    flash_assists INTEGER NOT NULL,
+    k_d_diff REAL NOT NULL,
+    first_kills_diff REAL NOT NULL,
+    adr REAL NOT NULL,
+    kast REAL NOT NULL,
+    rating REAL NOT NULL,
+
+    round_id INTEGER NOT NULL,
+    round_outcome_id INTEGER NOT NULL,
+    round_win INTEGER NOT NULL,
+
+    version INTEGER NOT NULL,
+    ingested_at DATETIME NOT NULL,
+
+    PRIMARY KEY (
+        begin_at,
+        game_id,
+        league_id,
+        serie_id,
+        tier_id,
+        tournament_id,
+        map_id,
+        round_id,
+        team_id,
+        team_opponent_id,
+        player_id,
+        player_opponent_id
+    )
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS games;
+
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- There is no raw table to backfill from: replay the games to fill it.
+ALTER TABLE games ADD COLUMN length INTEGER;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE games DROP COLUMN length;
+
+-- +goose StatementEnd